@@ -0,0 +1,380 @@
+package gonymizer
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+// The map command suggests a processor for columns that look like they hold personal data, from the name and data type
+// of the column and, optionally, from a sample of its values. Suggestions replace the Identity processor of new columns
+// and are noted in the column's Comment, so they can be found and reviewed.
+
+// Confidence of a suggested processor
+const (
+	ConfidenceHigh   = "high"
+	ConfidenceMedium = "medium"
+	ConfidenceLow    = "low"
+)
+
+// classificationCommentPrefix starts the Comment of columns with a suggested processor.
+const classificationCommentPrefix = "Suggested by map"
+
+// sampleMatchRatio is the share of sampled values that must match a detector for the column to be classified by it.
+const sampleMatchRatio = 0.8
+
+// Classification is the processor suggested for a column.
+type Classification struct {
+	Column         string
+	DataType       string
+	Processor      string
+	Confidence     string
+	Reason         string
+	ReviewRequired bool
+}
+
+// nameHeuristic suggests a processor for columns whose name matches a pattern. Heuristics are tried in order and the
+// first one whose processor supports the column's data type is used.
+type nameHeuristic struct {
+	pattern    *regexp.Regexp
+	processor  ProcessorDefinition
+	confidence string
+	label      string
+}
+
+// valueDetector suggests a processor for columns whose sampled values it matches.
+type valueDetector struct {
+	label     string
+	processor ProcessorDefinition
+	match     func(value string) bool
+}
+
+// oneYear is the Variance in seconds used to shift dates of birth.
+const oneYear = 365 * 24 * 60 * 60
+
+// nameToken builds a pattern that matches one of the names as a whole word of a snake_case or camelCase column name.
+func nameToken(names string) *regexp.Regexp {
+	return regexp.MustCompile(`(^|_)(` + names + `)($|_)`)
+}
+
+var nameHeuristics = []nameHeuristic{
+	{nameToken(`e_?mail|e_?mail_?address`), ProcessorDefinition{Name: "FakeEmailAddress"}, ConfidenceHigh, "e-mail"},
+	{nameToken(`ssn|social_?security(_?(number|no|num))?|tax_?id|tin|national_?id`),
+		ProcessorDefinition{Name: "AlphaNumericScrambler"}, ConfidenceHigh, "national id"},
+	{nameToken(`(credit_?)?card_?(number|no|num)|cc_?(number|no|num)|credit_?card`),
+		ProcessorDefinition{Name: "AlphaNumericScrambler"}, ConfidenceHigh, "card number"},
+	{nameToken(`iban|bank_?account(_?(number|no|num))?|account_?(number|no|num)|routing_?(number|no|num)`),
+		ProcessorDefinition{Name: "AlphaNumericScrambler"}, ConfidenceMedium, "account number"},
+	{nameToken(`passport(_?(number|no|num))?|drivers?_?licen[cs]e(_?(number|no|num))?`),
+		ProcessorDefinition{Name: "AlphaNumericScrambler"}, ConfidenceMedium, "document number"},
+	{nameToken(`password|passwd|pass_?hash|password_?hash|secret|api_?key|access_?token|refresh_?token`),
+		ProcessorDefinition{Name: "ScrubString"}, ConfidenceHigh, "secret"},
+	{nameToken(`ip|ip_?addr(ess)?|ipv4|remote_?addr(ess)?|client_?ip|last_?login_?ip`),
+		ProcessorDefinition{Name: "FakeIPv4"}, ConfidenceMedium, "IP address"},
+	{nameToken(`ipv6`), ProcessorDefinition{Name: "FakeIPv6"}, ConfidenceMedium, "IPv6 address"},
+	{nameToken(`dob|birth_?date|date_?of_?birth|birthday|birth_?dt|born_?on`),
+		ProcessorDefinition{Name: "RandomDate"}, ConfidenceHigh, "date of birth"},
+	{nameToken(`dob|birth_?date|date_?of_?birth|birthday|birth_?dt|born_?on`),
+		ProcessorDefinition{Name: "JitterTimestamp", Variance: oneYear}, ConfidenceHigh, "date of birth"},
+	{nameToken(`phone|phone_?(number|no|num)|mobile|cell|cell_?phone|fax|tel|telephone`),
+		ProcessorDefinition{Name: "FakePhoneNumber"}, ConfidenceHigh, "phone number"},
+	{nameToken(`first_?name|given_?name|fname|forename`), ProcessorDefinition{Name: "FakeFirstName"},
+		ConfidenceHigh, "first name"},
+	{nameToken(`middle_?name`), ProcessorDefinition{Name: "FakeFirstName"}, ConfidenceMedium, "middle name"},
+	{nameToken(`last_?name|surname|family_?name|lname`), ProcessorDefinition{Name: "FakeLastName"},
+		ConfidenceHigh, "last name"},
+	{nameToken(`full_?name|display_?name|contact_?name|customer_?name|patient_?name`),
+		ProcessorDefinition{Name: "FakeFullName"}, ConfidenceHigh, "full name"},
+	{nameToken(`user_?name|login|screen_?name|nick_?name|handle`), ProcessorDefinition{Name: "FakeUsername"},
+		ConfidenceMedium, "username"},
+	{regexp.MustCompile(`^name$`), ProcessorDefinition{Name: "FakeFullName"}, ConfidenceLow, "name"},
+	{nameToken(`(street_?)?address(_?line)?_?\d?|street|addr_?\d?`), ProcessorDefinition{Name: "FakeStreetAddress"},
+		ConfidenceMedium, "street address"},
+	{nameToken(`city|town`), ProcessorDefinition{Name: "FakeCity"}, ConfidenceHigh, "city"},
+	{nameToken(`zip|zip_?code|postal_?code|post_?code`), ProcessorDefinition{Name: "FakeZip"}, ConfidenceHigh,
+		"postal code"},
+	{nameToken(`state|province`), ProcessorDefinition{Name: "FakeState"}, ConfidenceLow, "state"},
+	{nameToken(`lat|latitude`), ProcessorDefinition{Name: "FakeLatitude"}, ConfidenceMedium, "latitude"},
+	{nameToken(`lng|lon|longitude`), ProcessorDefinition{Name: "FakeLongitude"}, ConfidenceMedium, "longitude"},
+	{nameToken(`gender|sex`), ProcessorDefinition{Name: "FakeGender"}, ConfidenceMedium, "gender"},
+	{nameToken(`user_?agent`), ProcessorDefinition{Name: "FakeUserAgent"}, ConfidenceHigh, "user agent"},
+	{nameToken(`employer|company(_?name)?`), ProcessorDefinition{Name: "FakeCompanyName"}, ConfidenceLow,
+		"company name"},
+	{nameToken(`notes?|comments?|bio|biography|about_?me`), ProcessorDefinition{Name: "FakeParagraph"},
+		ConfidenceLow, "free text"},
+}
+
+// dataTypeHeuristics suggest a processor for columns whose data type holds personal data whatever their name.
+var dataTypeHeuristics = map[string]ProcessorDefinition{
+	"inet": {Name: "FakeIPv4"},
+}
+
+var (
+	emailValueRegex = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[A-Za-z]{2,}$`)
+	ssnValueRegex   = regexp.MustCompile(`^\d{3}-\d{2}-\d{4}$`)
+	phoneValueRegex = regexp.MustCompile(`^\+?[\d\s().-]+$`)
+	cardValueRegex  = regexp.MustCompile(`^\d(?:[ -]?\d){12,18}$`)
+)
+
+var valueDetectors = []valueDetector{
+	{"e-mail addresses", ProcessorDefinition{Name: "FakeEmailAddress"}, emailValueRegex.MatchString},
+	{"social security numbers", ProcessorDefinition{Name: "AlphaNumericScrambler"}, ssnValueRegex.MatchString},
+	{"card numbers", ProcessorDefinition{Name: "AlphaNumericScrambler"}, isCardNumber},
+	{"phone numbers", ProcessorDefinition{Name: "FakePhoneNumber"}, isPhoneNumber},
+	{"IPv4 addresses", ProcessorDefinition{Name: "FakeIPv4"}, func(value string) bool {
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil
+	}},
+	{"IPv6 addresses", ProcessorDefinition{Name: "FakeIPv6"}, func(value string) bool {
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() == nil
+	}},
+}
+
+// isCardNumber returns true for 13 to 19 digits, optionally grouped, that pass the Luhn check.
+func isCardNumber(value string) bool {
+	if !cardValueRegex.MatchString(value) {
+		return false
+	}
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(value)
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		digit := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+// isPhoneNumber returns true for 10 to 15 digits that are written with separators or a leading +, so plain numbers are
+// not taken for phone numbers.
+func isPhoneNumber(value string) bool {
+	if !phoneValueRegex.MatchString(value) || !strings.ContainsAny(value, "+-() .") {
+		return false
+	}
+	digits := 0
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits >= 10 && digits <= 15
+}
+
+// supportsDataType returns true if a processor can write values of the data type.
+func supportsDataType(processor, dataType string) bool {
+	info, ok := LookupProcessor(processor)
+	if !ok {
+		return false
+	}
+	if len(info.DataTypes) == 0 {
+		return true
+	}
+	for _, supported := range info.DataTypes {
+		if supported == dataType {
+			return true
+		}
+	}
+	return false
+}
+
+// isTextDataType returns true for the character data types.
+func isTextDataType(dataType string) bool {
+	for _, textType := range textDataTypes {
+		if textType == dataType {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCamelCase turns camelCase names into snake_case so both match the name heuristics.
+var splitCamelCase = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+// classifyName returns the heuristic that matches the name and data type of a column, if any.
+func classifyName(cmap ColumnMapper) (nameHeuristic, bool) {
+	name := strings.ToLower(splitCamelCase.ReplaceAllString(cmap.ColumnName, "${1}_${2}"))
+	for _, heuristic := range nameHeuristics {
+		if heuristic.pattern.MatchString(name) && supportsDataType(heuristic.processor.Name, cmap.DataType) {
+			return heuristic, true
+		}
+	}
+	return nameHeuristic{}, false
+}
+
+// classifySamples returns the detector that matches most of the sampled values and the share of values it matches.
+func classifySamples(cmap ColumnMapper, samples []string) (valueDetector, float64, bool) {
+	values := 0
+	counts := make([]int, len(valueDetectors))
+	for _, sample := range samples {
+		sample = strings.TrimSpace(sample)
+		if sample == "" {
+			continue
+		}
+		values++
+		for i, detector := range valueDetectors {
+			if detector.match(sample) {
+				counts[i]++
+				break
+			}
+		}
+	}
+	if values == 0 {
+		return valueDetector{}, 0, false
+	}
+
+	best := -1
+	for i, count := range counts {
+		if supportsDataType(valueDetectors[i].processor.Name, cmap.DataType) && (best < 0 || count > counts[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return valueDetector{}, 0, false
+	}
+	ratio := float64(counts[best]) / float64(values)
+	if ratio < sampleMatchRatio {
+		return valueDetector{}, ratio, false
+	}
+	return valueDetectors[best], ratio, true
+}
+
+// classifyColumn suggests a processor for a column from its name, data type and sampled values. ok is false if nothing
+// suggests the column holds personal data.
+func classifyColumn(cmap ColumnMapper, samples []string) (suggestion ProcessorDefinition, class Classification,
+	ok bool) {
+
+	class = Classification{
+		Column:   fmt.Sprintf("%s.%s.%s", cmap.TableSchema, cmap.TableName, cmap.ColumnName),
+		DataType: cmap.DataType,
+	}
+	heuristic, named := classifyName(cmap)
+	detector, ratio, detected := classifySamples(cmap, samples)
+	sampled := fmt.Sprintf("%.0f%% of %d sampled values look like %s", ratio*100, len(samples), detector.label)
+
+	switch {
+	case named && detected && heuristic.processor.Name == detector.processor.Name:
+		suggestion = heuristic.processor
+		class.Confidence = ConfidenceHigh
+		class.Reason = fmt.Sprintf("column name looks like %s and %s", heuristic.label, sampled)
+	case named && detected:
+		// the values win unless the name is a strong match
+		suggestion = detector.processor
+		class.Confidence = ConfidenceMedium
+		if heuristic.confidence == ConfidenceHigh {
+			suggestion = heuristic.processor
+		}
+		class.Reason = fmt.Sprintf("column name looks like %s but %s", heuristic.label, sampled)
+		class.ReviewRequired = true
+	case named:
+		suggestion = heuristic.processor
+		class.Confidence = heuristic.confidence
+		class.Reason = fmt.Sprintf("column name looks like %s", heuristic.label)
+	case detected:
+		suggestion = detector.processor
+		class.Confidence = ConfidenceMedium
+		if ratio < 1 {
+			class.Confidence = ConfidenceLow
+		}
+		class.Reason = sampled
+	default:
+		procDef, typed := dataTypeHeuristics[cmap.DataType]
+		if !typed {
+			return ProcessorDefinition{}, class, false
+		}
+		suggestion = procDef
+		class.Confidence = ConfidenceMedium
+		class.Reason = fmt.Sprintf("data type %s holds personal data", cmap.DataType)
+	}
+
+	class.Processor = suggestion.Name
+	if class.Confidence != ConfidenceHigh {
+		class.ReviewRequired = true
+	}
+	return suggestion, class, true
+}
+
+// isUnconfigured returns true for columns that only have the Identity processor that the map command gives new
+// columns.
+func isUnconfigured(cmap ColumnMapper) bool {
+	return len(cmap.Processors) == 0 || (len(cmap.Processors) == 1 && cmap.Processors[0].Name == "Identity" &&
+		len(cmap.Processors[0].Params) == 0)
+}
+
+// ClassifyColumns suggests processors for the columns of the map that have none besides Identity. The suggestion
+// replaces the Identity processor and is explained in the column's Comment. When sampleSize is larger than 0 that many
+// values of every text column are read from the database and checked for known formats of personal data. The returned
+// report lists every suggestion, ReviewRequired is set for suggestions that are not certain.
+func ClassifyColumns(conf PGConfig, dbMap *DBMapper, sampleSize int) ([]Classification, error) {
+	var db *sql.DB
+	if sampleSize > 0 {
+		var err error
+		if db, err = OpenDB(conf); err != nil {
+			return nil, err
+		}
+		defer db.Close()
+	}
+
+	var report []Classification
+	for i := range dbMap.ColumnMaps {
+		cmap := &dbMap.ColumnMaps[i]
+		if !isUnconfigured(*cmap) {
+			continue
+		}
+
+		var samples []string
+		if db != nil && isTextDataType(cmap.DataType) {
+			var err error
+			if samples, err = sampleColumn(db, *cmap, sampleSize); err != nil {
+				return nil, err
+			}
+		}
+
+		suggestion, class, ok := classifyColumn(*cmap, samples)
+		if !ok {
+			continue
+		}
+		cmap.Processors = []ProcessorDefinition{suggestion}
+		cmap.Comment = fmt.Sprintf("%s (%s confidence): %s", classificationCommentPrefix, class.Confidence,
+			class.Reason)
+		report = append(report, class)
+	}
+	return report, nil
+}
+
+// sampleColumn reads up to sampleSize values of a column that are not NULL. Columns of sharded schemas are not sampled.
+func sampleColumn(db *sql.DB, cmap ColumnMapper, sampleSize int) ([]string, error) {
+	if strings.HasSuffix(cmap.TableSchema, "*") {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf("SELECT %[1]s::text FROM %[2]s.%[3]s WHERE %[1]s IS NOT NULL LIMIT %[4]d",
+		pq.QuoteIdentifier(cmap.ColumnName), pq.QuoteIdentifier(cmap.TableSchema), pq.QuoteIdentifier(cmap.TableName),
+		sampleSize)
+	rows, err := db.Query(query)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []string
+	for rows.Next() {
+		var value string
+		if err = rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		samples = append(samples, value)
+	}
+	return samples, rows.Err()
+}
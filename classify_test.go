@@ -0,0 +1,134 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyName(t *testing.T) {
+	cases := []struct {
+		column, dataType, processor string
+	}{
+		{"email", "character varying", "FakeEmailAddress"},
+		{"contactEmail", "text", "FakeEmailAddress"},
+		{"home_phone", "text", "FakePhoneNumber"},
+		{"ssn", "character", "AlphaNumericScrambler"},
+		{"dob", "date", "RandomDate"},
+		{"date_of_birth", "timestamp without time zone", "JitterTimestamp"},
+		{"first_name", "text", "FakeFirstName"},
+		{"LastName", "text", "FakeLastName"},
+		{"ip_addr", "inet", "FakeIPv4"},
+		{"email_address", "text", "FakeEmailAddress"},
+		{"billing_address", "text", "FakeStreetAddress"},
+		{"zip_code", "text", "FakeZip"},
+	}
+	for _, c := range cases {
+		heuristic, ok := classifyName(ColumnMapper{ColumnName: c.column, DataType: c.dataType})
+		require.True(t, ok, c.column)
+		require.Equal(t, c.processor, heuristic.processor.Name, c.column)
+	}
+
+	for _, column := range []string{"id", "created_at", "emailed", "status", "tipping"} {
+		_, ok := classifyName(ColumnMapper{ColumnName: column, DataType: "text"})
+		require.False(t, ok, column)
+	}
+	// the processor must support the data type
+	_, ok := classifyName(ColumnMapper{ColumnName: "phone", DataType: "bigint"})
+	require.False(t, ok)
+}
+
+func TestClassifySamples(t *testing.T) {
+	text := ColumnMapper{DataType: "text"}
+	cases := []struct {
+		samples   []string
+		processor string
+	}{
+		{[]string{"a@example.com", "b.c@example.org", "d@mail.example.net"}, "FakeEmailAddress"},
+		{[]string{"123-45-6789", "987-65-4321"}, "AlphaNumericScrambler"},
+		{[]string{"4111 1111 1111 1111", "5500-0000-0000-0004"}, "AlphaNumericScrambler"},
+		{[]string{"+1 (555) 123-4567", "555-987-6543"}, "FakePhoneNumber"},
+		{[]string{"10.0.0.1", "192.168.1.20"}, "FakeIPv4"},
+		{[]string{"2001:db8::1", "fe80::1"}, "FakeIPv6"},
+	}
+	for _, c := range cases {
+		detector, ratio, ok := classifySamples(text, c.samples)
+		require.True(t, ok, c.samples)
+		require.Equal(t, c.processor, detector.processor.Name)
+		require.Equal(t, 1.0, ratio)
+	}
+
+	_, _, ok := classifySamples(text, []string{"a@example.com", "hello", "world"})
+	require.False(t, ok)
+	_, _, ok = classifySamples(text, []string{"4111 1111 1111 1112"})
+	require.False(t, ok)
+	_, _, ok = classifySamples(text, []string{"5551234567"})
+	require.False(t, ok)
+	_, _, ok = classifySamples(text, nil)
+	require.False(t, ok)
+}
+
+func TestClassifyColumn(t *testing.T) {
+	cmap := ColumnMapper{TableSchema: "public", TableName: "users", ColumnName: "email", DataType: "text"}
+	_, class, ok := classifyColumn(cmap, []string{"a@example.com"})
+	require.True(t, ok)
+	require.Equal(t, ConfidenceHigh, class.Confidence)
+	require.False(t, class.ReviewRequired)
+	require.Equal(t, "public.users.email", class.Column)
+
+	// name only
+	_, class, ok = classifyColumn(cmap, nil)
+	require.True(t, ok)
+	require.Equal(t, ConfidenceHigh, class.Confidence)
+
+	// values only need review
+	cmap.ColumnName = "contact"
+	suggestion, class, ok := classifyColumn(cmap, []string{"a@example.com"})
+	require.True(t, ok)
+	require.Equal(t, "FakeEmailAddress", suggestion.Name)
+	require.True(t, class.ReviewRequired)
+
+	// the name and the values disagree
+	cmap.ColumnName = "notes"
+	suggestion, class, ok = classifyColumn(cmap, []string{"a@example.com"})
+	require.True(t, ok)
+	require.Equal(t, "FakeEmailAddress", suggestion.Name)
+	require.True(t, class.ReviewRequired)
+
+	cmap.ColumnName = "client"
+	cmap.DataType = "inet"
+	suggestion, _, ok = classifyColumn(cmap, nil)
+	require.True(t, ok)
+	require.Equal(t, "FakeIPv4", suggestion.Name)
+
+	cmap.DataType = "integer"
+	_, _, ok = classifyColumn(cmap, nil)
+	require.False(t, ok)
+}
+
+func TestClassifyColumns(t *testing.T) {
+	dbMap := DBMapper{
+		DBName: "test",
+		ColumnMaps: []ColumnMapper{
+			{TableSchema: "public", TableName: "users", ColumnName: "email", DataType: "text",
+				Processors: []ProcessorDefinition{{Name: "Identity"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "phone", DataType: "text",
+				Processors: []ProcessorDefinition{{Name: "ScrubString"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "state", DataType: "text",
+				Processors: []ProcessorDefinition{{Name: "Identity"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "id", DataType: "integer",
+				Processors: []ProcessorDefinition{{Name: "Identity"}}},
+		},
+	}
+	report, err := ClassifyColumns(PGConfig{}, &dbMap, 0)
+	require.Nil(t, err)
+	require.Len(t, report, 2)
+
+	require.Equal(t, "FakeEmailAddress", dbMap.ColumnMaps[0].Processors[0].Name)
+	require.Contains(t, dbMap.ColumnMaps[0].Comment, "high confidence")
+	require.Equal(t, "ScrubString", dbMap.ColumnMaps[1].Processors[0].Name)
+	require.Equal(t, "FakeState", dbMap.ColumnMaps[2].Processors[0].Name)
+	require.True(t, report[1].ReviewRequired)
+	require.Equal(t, "Identity", dbMap.ColumnMaps[3].Processors[0].Name)
+	require.Nil(t, dbMap.Validate())
+}
@@ -20,6 +20,8 @@ import (
 
 // DumpCmd is the cobra.Command struct we use for "dump" command.
 var (
+	driftPolicy string
+
 	DumpCmd = &cobra.Command{
 		Use:   "dump",
 		Short: "Create a dump file that contains PHI/PII from a PostgreSQL database",
@@ -92,6 +94,31 @@ func init() {
 	)
 	_ = viper.BindPFlag("dump.dump-file", DumpCmd.Flags().Lookup("dump-file"))
 
+	DumpCmd.Flags().StringVar(
+		&driftPolicy,
+		"drift-policy",
+		gonymizer.DriftFail,
+		"What to do when --map-file does not match the columns of the database, one of: fail, warn, ignore",
+	)
+	_ = viper.BindPFlag("dump.drift-policy", DumpCmd.Flags().Lookup("drift-policy"))
+
+	DumpCmd.Flags().StringVarP(
+		&mapFile,
+		"map-file",
+		"m",
+		"",
+		"Map file to check the columns of the database against before dumping, and whose Subset is dumped if it has one",
+	)
+	_ = viper.BindPFlag("dump.map-file", DumpCmd.Flags().Lookup("map-file"))
+
+	DumpCmd.Flags().StringSliceVar(
+		&overlayFiles,
+		"overlay",
+		[]string{},
+		"Overlay files applied to the map file, in order, I.E. to use other processors in staging",
+	)
+	_ = viper.BindPFlag("dump.overlay", DumpCmd.Flags().Lookup("overlay"))
+
 	DumpCmd.Flags().StringSliceVar(
 		&schema,
 		"schema",
@@ -217,9 +244,28 @@ func cliCommandDump(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	// Check that the map file describes every column that will be dumped
+	var dbMap *gonymizer.DBMapper
+	if len(viper.GetString("dump.map-file")) > 0 {
+		log.Info("Checking the map file against the database: ", viper.GetString("dump.map-file"))
+		dbMap, err = gonymizer.LoadConfigSkeleton(
+			viper.GetString("dump.map-file"),
+			viper.GetStringSlice("dump.overlay")...,
+		)
+		if err == nil {
+			err = checkSchemaDrift(dbConf, dbMap)
+		}
+		if err != nil {
+			log.Error(err)
+			log.Error("❌ Gonymizer did not exit properly. See above for errors ❌")
+			os.Exit(1)
+		}
+	}
+
 	log.Info("🚜 ", aurora.Bold(aurora.Green("Creating dump file")), " 🚜")
 	err = dump(
 		dbConf,
+		dbMap,
 		viper.GetString("dump.dump-file"),
 		viper.GetString("dump.schema-prefix"),
 		viper.GetStringSlice("dump.exclude-table"),
@@ -238,9 +284,10 @@ func cliCommandDump(cmd *cobra.Command, args []string) {
 	}
 }
 
-// dump initiates the dump process.
+// dump initiates the dump process. Only the Subset of the map is dumped if it has one.
 func dump(
 	conf gonymizer.PGConfig,
+	dbMap *gonymizer.DBMapper,
 	dumpFile,
 	schemaPrefix string,
 	excludeTable,
@@ -249,6 +296,20 @@ func dump(
 	schema []string,
 	oids bool,
 ) (err error) {
+	if dbMap != nil && len(dbMap.Subset) > 0 {
+		log.Info("Dumping the subset of the map file")
+		return gonymizer.CreateSubsetDumpFile(
+			conf,
+			dbMap,
+			dumpFile,
+			schemaPrefix,
+			excludeTable,
+			excludeTableData,
+			excludeSchemas,
+			schema,
+			oids,
+		)
+	}
 	return gonymizer.CreateDumpFile(
 		conf,
 		dumpFile,
@@ -261,6 +322,24 @@ func dump(
 	)
 }
 
+// checkSchemaDrift compares the map file with the columns of the tables whose data will be dumped.
+func checkSchemaDrift(dbConf gonymizer.PGConfig, dbMap *gonymizer.DBMapper) error {
+	// tables without data in the dump can not leak anything
+	excludeAllTables := append(
+		viper.GetStringSlice("dump.exclude-table"),
+		viper.GetStringSlice("dump.exclude-table-data")...,
+	)
+	_, err := gonymizer.CheckSchemaDrift(
+		dbConf,
+		dbMap,
+		viper.GetString("dump.drift-policy"),
+		viper.GetString("dump.schema-prefix"),
+		viper.GetStringSlice("dump.schema"),
+		excludeAllTables,
+	)
+	return err
+}
+
 // storeRowCountFile stores the row counts for every table that was saved into the dump file. This can be used during
 // the load process to verify that all the included tables were anonymized and transferred properly.
 func storeRowCountFile(dbConf gonymizer.PGConfig, schemaPrefix, path string, excludeTable []string) (err error) {
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/smithoss/gonymizer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Exit codes of the lint command
+const (
+	lintExitClean    = 0
+	lintExitFindings = 1
+	lintExitFailure  = 2
+)
+
+var (
+	lintDisable []string
+	lintFailOn  string
+	lintFormat  string
+
+	// LintCmd is the cobra.Command struct we use for "lint" command.
+	LintCmd = &cobra.Command{
+		Use:   "lint",
+		Short: "Check the map file for columns that would leak personal data or break relationships",
+		Long: "Check the map file for columns that would leak personal data or break relationships.\n\n" +
+			"Exits with 0 when nothing is found, 1 when there are findings of the --fail-on severity or worse and 2 " +
+			"when the map file can not be read.",
+		Run: cliCommandLint,
+	}
+)
+
+// init initializes the Lint command for the application and adds application flags and options.
+func init() {
+	LintCmd.Flags().StringVarP(
+		&mapFile,
+		"map-file",
+		"m",
+		"",
+		"Map file location",
+	)
+	_ = viper.BindPFlag("lint.map-file", LintCmd.Flags().Lookup("map-file"))
+
+	LintCmd.Flags().StringSliceVar(
+		&overlayFiles,
+		"overlay",
+		[]string{},
+		"Overlay files applied to the map file, in order, I.E. to use other processors in staging",
+	)
+	_ = viper.BindPFlag("lint.overlay", LintCmd.Flags().Lookup("overlay"))
+
+	LintCmd.Flags().StringSliceVar(
+		&lintDisable,
+		"disable",
+		[]string{},
+		"Rules that are not checked",
+	)
+	_ = viper.BindPFlag("lint.disable", LintCmd.Flags().Lookup("disable"))
+
+	LintCmd.Flags().StringVar(
+		&lintFailOn,
+		"fail-on",
+		gonymizer.LintError,
+		"Lowest severity that makes the command fail, one of: error, warning",
+	)
+	_ = viper.BindPFlag("lint.fail-on", LintCmd.Flags().Lookup("fail-on"))
+
+	LintCmd.Flags().StringVar(
+		&lintFormat,
+		"format",
+		"text",
+		"Output format, one of: text, json",
+	)
+	_ = viper.BindPFlag("lint.format", LintCmd.Flags().Lookup("format"))
+}
+
+// cliCommandLint lints the map file and exits with a code that tells whether anything was found.
+func cliCommandLint(cmd *cobra.Command, args []string) {
+	failOn := viper.GetString("lint.fail-on")
+	format := viper.GetString("lint.format")
+	if failOn != gonymizer.LintError && failOn != gonymizer.LintWarning {
+		fmt.Fprintf(os.Stderr, "Unknown --fail-on severity %q\n", failOn)
+		os.Exit(lintExitFailure)
+	}
+	if format != "text" && format != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown --format %q\n", format)
+		os.Exit(lintExitFailure)
+	}
+	for _, rule := range viper.GetStringSlice("lint.disable") {
+		if _, ok := gonymizer.LintRules[rule]; !ok {
+			fmt.Fprintf(os.Stderr, "Unknown rule %q\n", rule)
+			os.Exit(lintExitFailure)
+		}
+	}
+
+	dbMap, err := gonymizer.ResolveConfigSkeleton(
+		viper.GetString("lint.map-file"),
+		viper.GetStringSlice("lint.overlay")...,
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(lintExitFailure)
+	}
+	findings := gonymizer.LintMap(dbMap, viper.GetStringSlice("lint.disable")...)
+
+	if format == "json" {
+		if findings == nil {
+			findings = []gonymizer.LintFinding{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+		if err = encoder.Encode(findings); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(lintExitFailure)
+		}
+	} else {
+		for _, finding := range findings {
+			fmt.Println(finding)
+		}
+	}
+
+	for _, finding := range findings {
+		if finding.Severity == gonymizer.LintError || failOn == gonymizer.LintWarning {
+			os.Exit(lintExitFindings)
+		}
+	}
+	os.Exit(lintExitClean)
+}
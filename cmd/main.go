@@ -68,6 +68,7 @@ var (
 	logFormat        string
 	logLevel         string
 	mapFile          string
+	overlayFiles     []string
 	dumpFile         string
 	postProcessFile  string
 	preProcessFile   string
@@ -167,9 +168,13 @@ func init() {
 	// Bind commands to root
 	rootCmd.AddCommand(
 		DumpCmd,
+		LintCmd,
 		LoadCmd,
 		MapCmd,
 		ProcessCmd,
+		ProcessorsCmd,
+		ResolveCmd,
+		RulesCmd,
 		UploadCmd,
 		VersionCmd,
 	)
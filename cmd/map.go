@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -13,8 +14,13 @@ import (
 	"github.com/spf13/viper"
 )
 
-// MapCmd is the cobra.Command struct we use for "map" command.
 var (
+	classify        bool
+	enumFrequencies bool
+	sampleSize      int
+	updateMap       bool
+
+	// MapCmd is the cobra.Command struct we use for "map" command.
 	MapCmd = &cobra.Command{
 		Use:   "map",
 		Short: "Map creates/modifies the map file for a PostgreSQL database",
@@ -34,6 +40,23 @@ func init() {
 	)
 	_ = viper.BindPFlag("map.disable-ssl", MapCmd.Flags().Lookup("disable-ssl"))
 
+	MapCmd.Flags().BoolVar(
+		&classify,
+		"classify",
+		false,
+		"Suggest processors for columns that look like they hold personal data",
+	)
+	_ = viper.BindPFlag("map.classify", MapCmd.Flags().Lookup("classify"))
+
+	MapCmd.Flags().BoolVar(
+		&enumFrequencies,
+		"enum-frequencies",
+		false,
+		"Count how often each value of enum and CHECK (column IN (...)) columns is used, for EnumRandom's observed "+
+			"distribution",
+	)
+	_ = viper.BindPFlag("map.enum-frequencies", MapCmd.Flags().Lookup("enum-frequencies"))
+
 	MapCmd.Flags().StringVarP(
 		&mapFile,
 		"map-file",
@@ -113,6 +136,22 @@ func init() {
 	)
 	_ = viper.BindPFlag("map.port", MapCmd.Flags().Lookup("port"))
 
+	MapCmd.Flags().IntVar(
+		&sampleSize,
+		"sample",
+		0,
+		"Number of values of each text column to check for personal data when suggesting processors (with --classify)",
+	)
+	_ = viper.BindPFlag("map.sample", MapCmd.Flags().Lookup("sample"))
+
+	MapCmd.Flags().BoolVar(
+		&updateMap,
+		"update",
+		false,
+		"Merge the database into the map file given by --map-file, keeping its processors and comments",
+	)
+	_ = viper.BindPFlag("map.update", MapCmd.Flags().Lookup("update"))
+
 	MapCmd.Flags().StringVarP(
 		&dbUser,
 		"username",
@@ -170,6 +209,10 @@ func cliCommandMap(cmd *cobra.Command, args []string) {
 		viper.GetStringSlice("map.exclude-table"),
 		viper.GetStringSlice("map.exclude-table-data"),
 		viper.GetStringSlice("map.schema"),
+		viper.GetBool("map.enum-frequencies"),
+		viper.GetBool("map.classify"),
+		viper.GetInt("map.sample"),
+		viper.GetBool("map.update"),
 	)
 	if err != nil {
 		log.Error(err)
@@ -188,11 +231,32 @@ func runMap(
 	excludeTable,
 	excludeTableData,
 	schema []string,
+	enumFrequencies,
+	classify bool,
+	sampleSize int,
+	update bool,
 ) (err error) {
 	var (
 		skeleton *gonymizer.DBMapper
+		existing *gonymizer.DBMapper
 	)
 
+	if update {
+		// TOML map files are written without the comments they were read with
+		if gonymizer.MapFormat(mapFile) == gonymizer.MapFormatTOML {
+			return fmt.Errorf("map --update does not support TOML map files since their comments would be lost, "+
+				"convert %s to YAML or JSON first", mapFile)
+		}
+		if existing, err = gonymizer.ReadConfigSkeleton(mapFile); err != nil {
+			return err
+		}
+		// the columns of included files are not in the map file itself and would be added to the skeleton again
+		if len(existing.Includes) > 0 {
+			return fmt.Errorf("map --update does not support map files with Includes, merge them into one file "+
+				"with gonymizer resolve -m %s first", mapFile)
+		}
+	}
+
 	// Concatenate lists since we do not care for mapping sake
 	excludeTablesLocal := append(excludeTable, excludeTableData...)
 
@@ -214,7 +278,41 @@ func runMap(
 		return err
 	}
 
+	if enumFrequencies {
+		log.Info("Counting the values of enum columns")
+		if err = gonymizer.CaptureValueCounts(conf, skeleton); err != nil {
+			return err
+		}
+	}
+
+	if sampleSize > 0 && !classify {
+		log.Warn("--sample is only used with --classify, no values are sampled")
+	}
+	if classify {
+		log.Info("Suggesting processors for columns with personal data")
+		report, err := gonymizer.ClassifyColumns(conf, skeleton, sampleSize)
+		if err != nil {
+			return err
+		}
+		logClassificationReport(report)
+	}
+
+	if update {
+		var changes []gonymizer.MapChange
+		skeleton, changes = gonymizer.MergeConfigSkeleton(existing, skeleton)
+		if len(changes) == 0 {
+			log.Info("The map file is up to date with the database")
+		} else {
+			log.Infof("Changes to %s:", mapFile)
+			fmt.Print(gonymizer.FormatMapChanges(changes))
+		}
+	}
+
+	// skeletons of YAML and TOML map files keep their format
 	skeletonFile := fmt.Sprint(mapFile + ".skeleton.json")
+	if gonymizer.MapFormat(mapFile) != gonymizer.MapFormatJSON {
+		skeletonFile = mapFile + ".skeleton" + filepath.Ext(mapFile)
+	}
 	err = gonymizer.WriteConfigSkeleton(skeleton, skeletonFile)
 	if err != nil {
 		return err
@@ -226,3 +324,23 @@ func runMap(
 	return nil
 
 }
+
+// logClassificationReport logs the processors suggested for the map and lists the suggestions that must be reviewed.
+func logClassificationReport(report []gonymizer.Classification) {
+	var review []gonymizer.Classification
+	for _, class := range report {
+		if class.ReviewRequired {
+			review = append(review, class)
+		}
+	}
+	log.Infof("Suggested processors for %d columns, %d of them require review", len(report), len(review))
+	if len(review) == 0 {
+		return
+	}
+
+	log.Warn(aurora.Bold(aurora.Yellow("Review required:")))
+	for _, class := range review {
+		log.Warnf("\t%s (%s): %s, %s confidence: %s", class.Column, class.DataType, class.Processor, class.Confidence,
+			class.Reason)
+	}
+}
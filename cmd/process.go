@@ -14,7 +14,9 @@ import (
 )
 
 var (
-	processedFile string
+	largeObjects   string
+	legacyChaining bool
+	processedFile  string
 
 	// ProcessCmd is the cobra.Command struct we use for the "process" command.
 	ProcessCmd = &cobra.Command{
@@ -42,6 +44,14 @@ func init() {
 	)
 	_ = viper.BindPFlag("process.map-file", ProcessCmd.Flags().Lookup("map-file"))
 
+	ProcessCmd.Flags().StringSliceVar(
+		&overlayFiles,
+		"overlay",
+		[]string{},
+		"Overlay files applied to the map file, in order, I.E. to use other processors in staging",
+	)
+	_ = viper.BindPFlag("process.overlay", ProcessCmd.Flags().Lookup("overlay"))
+
 	ProcessCmd.Flags().StringVar(
 		&dumpFile,
 		"dump-file",
@@ -59,6 +69,22 @@ func init() {
 	)
 	_ = viper.BindPFlag("process.inclusive", ProcessCmd.Flags().Lookup("inclusive"))
 
+	ProcessCmd.Flags().StringVar(
+		&largeObjects,
+		"large-objects",
+		gonymizer.LargeObjectsKeep,
+		"What to do with large object (pg_largeobject/lo_*) data in the dump file, one of: keep, drop, replace",
+	)
+	_ = viper.BindPFlag("process.large-objects", ProcessCmd.Flags().Lookup("large-objects"))
+
+	ProcessCmd.Flags().BoolVar(
+		&legacyChaining,
+		"legacy-chaining",
+		false,
+		"Give every processor of a column the original value, as older releases did, instead of the previous output",
+	)
+	_ = viper.BindPFlag("process.legacy-chaining", ProcessCmd.Flags().Lookup("legacy-chaining"))
+
 	ProcessCmd.Flags().StringVar(
 		&processedFile,
 		"processed-file",
@@ -114,7 +140,7 @@ func cliCommandProcess(cmd *cobra.Command, args []string) {
 // process is the entry point for processing a dump file according to the map file.
 func process(dumpFile, mapFile, processedDumpFile, preProcess, postProcess string, generateSeed bool) (err error) {
 	log.Info("Loading map file from: ", mapFile)
-	columnMap, err := gonymizer.LoadConfigSkeleton(mapFile)
+	columnMap, err := gonymizer.LoadConfigSkeleton(mapFile, viper.GetStringSlice("process.overlay")...)
 	if err != nil {
 		return err
 	}
@@ -128,6 +154,12 @@ func process(dumpFile, mapFile, processedDumpFile, preProcess, postProcess strin
 		GenerateSeed:        generateSeed,
 		NumWorkers:          viper.GetInt("num-workers"),
 		Inclusive:           viper.GetBool("process.inclusive"),
+		LargeObjects:        viper.GetString("process.large-objects"),
+		LegacyChaining:      viper.GetBool("process.legacy-chaining"),
+	}
+
+	if err = gonymizer.ValidateLargeObjectsPolicy(config.LargeObjects); err != nil {
+		return err
 	}
 
 	log.Info("Processing dump file: ", dumpFile)
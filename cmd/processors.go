@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/smithoss/gonymizer"
+	"github.com/spf13/cobra"
+)
+
+// ProcessorsCmd is the cobra.Command struct we use for "processors" command.
+var (
+	ProcessorsCmd = &cobra.Command{
+		Use:   "processors [name...]",
+		Short: "List the available processors, or document the named processors",
+		Run:   cliCommandProcessors,
+	}
+)
+
+// cliCommandProcessors lists every registered processor. When processor names are given each one is documented with
+// its data types and parameters.
+func cliCommandProcessors(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		for _, info := range gonymizer.RegisteredProcessors() {
+			fmt.Printf("%-28s %s\n", info.Name, info.Description)
+		}
+		return
+	}
+
+	for i, name := range args {
+		info, ok := gonymizer.LookupProcessor(name)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unrecognized Processor %s\n", name)
+			os.Exit(1)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(describeProcessor(info))
+	}
+}
+
+// describeProcessor returns the documentation for a single processor.
+func describeProcessor(info gonymizer.ProcessorInfo) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s\n    %s\n", info.Name, info.Description)
+
+	dataTypes := "any"
+	if len(info.DataTypes) > 0 {
+		dataTypes = strings.Join(info.DataTypes, ", ")
+	}
+	fmt.Fprintf(&b, "Data types:\n    %s\n", dataTypes)
+
+	fmt.Fprintf(&b, "Parameters:\n")
+	if len(info.Parameters) == 0 {
+		fmt.Fprintf(&b, "    none\n")
+	}
+	for _, param := range info.Parameters {
+		required := ""
+		if param.Required {
+			required = ", required"
+		}
+		fmt.Fprintf(&b, "    %s (%s%s): %s\n", param.Name, param.Type, required, param.Description)
+	}
+	return b.String()
+}
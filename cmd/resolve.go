@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/smithoss/gonymizer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	resolveFormat string
+
+	// ResolveCmd is the cobra.Command struct we use for "resolve" command.
+	ResolveCmd = &cobra.Command{
+		Use:   "resolve",
+		Short: "Print the map file with the fragments it includes and the overlays applied",
+		Run:   cliCommandResolve,
+	}
+)
+
+// init initializes the Resolve command for the application and adds application flags and options.
+func init() {
+	ResolveCmd.Flags().StringVarP(
+		&mapFile,
+		"map-file",
+		"m",
+		"",
+		"Map file location",
+	)
+	_ = viper.BindPFlag("resolve.map-file", ResolveCmd.Flags().Lookup("map-file"))
+
+	ResolveCmd.Flags().StringSliceVar(
+		&overlayFiles,
+		"overlay",
+		[]string{},
+		"Overlay files applied to the map file, in order, I.E. to use other processors in staging",
+	)
+	_ = viper.BindPFlag("resolve.overlay", ResolveCmd.Flags().Lookup("overlay"))
+
+	ResolveCmd.Flags().StringVar(
+		&resolveFormat,
+		"format",
+		"",
+		"Format of the output, one of: json, yaml, toml. Defaults to the format of the map file",
+	)
+	_ = viper.BindPFlag("resolve.format", ResolveCmd.Flags().Lookup("format"))
+}
+
+// cliCommandResolve prints the resolved map, after checking that it can be loaded.
+func cliCommandResolve(cmd *cobra.Command, args []string) {
+	path := viper.GetString("resolve.map-file")
+	dbMap, err := gonymizer.ResolveConfigSkeleton(path, viper.GetStringSlice("resolve.overlay")...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err = dbMap.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	format := viper.GetString("resolve.format")
+	if format == "" {
+		format = gonymizer.MapFormat(path)
+	}
+	data, err := gonymizer.EncodeConfigSkeleton(dbMap, format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	_, _ = os.Stdout.Write(data)
+}
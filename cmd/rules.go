@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/smithoss/gonymizer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// RulesCmd is the cobra.Command struct we use for "rules" command.
+var (
+	RulesCmd = &cobra.Command{
+		Use:   "rules",
+		Short: "Show which rule of the map file, if any, applies to each column",
+		Run:   cliCommandRules,
+	}
+)
+
+// init initializes the Rules command for the application and adds application flags and options.
+func init() {
+	RulesCmd.Flags().StringVarP(
+		&mapFile,
+		"map-file",
+		"m",
+		"",
+		"Map file location",
+	)
+	_ = viper.BindPFlag("rules.map-file", RulesCmd.Flags().Lookup("map-file"))
+
+	RulesCmd.Flags().StringSliceVar(
+		&overlayFiles,
+		"overlay",
+		[]string{},
+		"Overlay files applied to the map file, in order, I.E. to use other processors in staging",
+	)
+	_ = viper.BindPFlag("rules.overlay", RulesCmd.Flags().Lookup("overlay"))
+}
+
+// cliCommandRules prints where the processors of every column of the map file come from: its own entry, a rule, or
+// nowhere, in which case the column is left as it is.
+func cliCommandRules(cmd *cobra.Command, args []string) {
+	dbMap, err := gonymizer.LoadConfigSkeleton(
+		viper.GetString("rules.map-file"),
+		viper.GetStringSlice("rules.overlay")...,
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, match := range dbMap.RuleMatches() {
+		source := "-"
+		if match.Rule != nil {
+			source = fmt.Sprintf("Rules[%d] %s", match.RuleIndex, match.Rule.Name)
+		} else if match.Exact && len(match.Column.Processors) > 0 {
+			source = "map entry"
+		}
+
+		processors := ""
+		for i, procDef := range match.Column.Processors {
+			if i > 0 {
+				processors += ", "
+			}
+			processors += procDef.Name
+		}
+		column := fmt.Sprintf("%s.%s.%s", match.Column.TableSchema, match.Column.TableName, match.Column.ColumnName)
+		fmt.Printf("%-48s %-28s %-24s %s\n", column, match.Column.DataType, source, processors)
+	}
+}
@@ -17,6 +17,10 @@ import (
 // maxLinesPerChunk bounds the number of lines per chunk.
 const maxLinesPerChunk = 100000
 
+// rowsPerBatch bounds the number of rows of a chunk that are processed together, so batch processors such as plugins
+// receive many values at once.
+const rowsPerBatch = 500
+
 // Chunk is a section of Postgres' data dump together with metadata.
 // SubChunkNumber: 0 if chunk does not contain a COPY line or isn't a continuation of a COPY section from another chunk
 // before it; >= 1 otherwise.
@@ -31,6 +35,7 @@ type Chunk struct {
 	NumLines       int
 	DataBegins     int
 	Inclusive      bool
+	LargeObjects   string
 }
 
 // Filename returns a filename for a chunk.
@@ -44,12 +49,22 @@ type ProcessConfig struct {
 	DestinationFilename string
 	GenerateSeed        bool
 	Inclusive           bool
+	LargeObjects        string
+	LegacyChaining      bool
 	NumWorkers          int
 	PostprocessFilename string
 	PreprocessFilename  string
 	SourceFilename      string
 }
 
+// resolveChaining applies the LegacyChaining setting of the config, or else of the map file, to every column.
+func (config ProcessConfig) resolveChaining() {
+	if config.LegacyChaining {
+		config.DBMapper.LegacyChaining = true
+	}
+	config.DBMapper.resolveChaining()
+}
+
 // ColumnMapperContainer can return a reference to a ColumnMapper
 type ColumnMapperContainer interface {
 	ColumnMapper(schemaName, tableName, columnName string) *ColumnMapper
@@ -73,6 +88,14 @@ func ProcessConcurrently(config ProcessConfig) error {
 		return err
 	}
 
+	config.resolveChaining()
+	resetErrorPolicySummary()
+	defer logErrorPolicySummary()
+
+	// Plugins are started once per worker and stopped when processing is done
+	SetPluginWorkers(config.NumWorkers)
+	defer ClosePlugins()
+
 	srcFile, err := os.Open(config.SourceFilename)
 	if err != nil {
 		log.Error(err)
@@ -80,13 +103,14 @@ func ProcessConcurrently(config ProcessConfig) error {
 	}
 	defer srcFile.Close()
 
-	reader := bufio.NewReader(srcFile)
+	// rows the map's Tables do not keep are dropped before they are chunked
+	reader := bufio.NewReader(filterTables(config.DBMapper, srcFile))
 
 	var wg sync.WaitGroup
 	chunks := make(chan Chunk, config.NumWorkers*2)
 
 	// Start 1 worker to pull out chunks from the file and put it on a channel of size 2*N
-	go createChunks(chunks, reader, &wg, config.Inclusive, maxLinesPerChunk)
+	go createChunks(chunks, reader, &wg, config.Inclusive, config.LargeObjects, maxLinesPerChunk)
 
 	// Start N workers to read from the channel and process the chunks concurrently, writing results to file
 	startChunkWorkers(config.DBMapper, &wg, config.NumWorkers, chunks)
@@ -113,7 +137,8 @@ func startChunkWorkers(mapper ColumnMapperContainer, wg *sync.WaitGroup, numWork
 
 // createChunks takes a reader and splits it up into maxLinesPerChunk sized pieces. These pieces are sent
 // through a channel.
-func createChunks(chunks chan<- Chunk, reader *bufio.Reader, wg *sync.WaitGroup, inclusive bool, maxLinesPerChunk int) {
+func createChunks(chunks chan<- Chunk, reader *bufio.Reader, wg *sync.WaitGroup, inclusive bool, largeObjects string,
+	maxLinesPerChunk int) {
 	defer close(chunks)
 
 	defer wg.Done()
@@ -143,6 +168,7 @@ func createChunks(chunks chan<- Chunk, reader *bufio.Reader, wg *sync.WaitGroup,
 			TableName:      tableName,
 			ColumnNames:    columnNames,
 			Inclusive:      inclusive,
+			LargeObjects:   largeObjects,
 		}
 
 		for lineIndex = 0; lineIndex < maxLinesPerChunk; lineIndex++ {
@@ -296,6 +322,12 @@ func startChunkWorker(chunks <-chan Chunk, wg *sync.WaitGroup, mapper ColumnMapp
 func processChunk(chunk Chunk, dstFile StringWriter, mapper ColumnMapperContainer) {
 	reader := bufio.NewReader(strings.NewReader(chunk.Data.String()))
 
+	if isLargeObjectTable(chunk.SchemaName, chunk.TableName) && chunk.LargeObjects != LargeObjectsKeep &&
+		chunk.LargeObjects != "" {
+		processFromReader(chunk, dstFile, reader, nil)
+		return
+	}
+
 	cmaps, err := getColumnMappers(mapper, chunk)
 	if err != nil {
 		log.Fatalf("%s: Please add to Map file", err.Error())
@@ -306,6 +338,19 @@ func processChunk(chunk Chunk, dstFile StringWriter, mapper ColumnMapperContaine
 
 // processFromReader reads data from a StringReader line by line, processes it and sends it to a StringWriter
 func processFromReader(chunk Chunk, writer StringWriter, reader StringReader, cmaps []*ColumnMapper) {
+	var rows []string
+	flush := func() {
+		if len(rows) == 0 {
+			return
+		}
+		for _, output := range processRowsFromChunk(cmaps, rows, chunk) {
+			if _, err := writer.WriteString(output); err != nil {
+				log.Fatal(err)
+			}
+		}
+		rows = rows[:0]
+	}
+
 	for i := 0; i > -1; i++ {
 		input, err := reader.ReadString('\n')
 		if err != nil {
@@ -322,19 +367,36 @@ func processFromReader(chunk Chunk, writer StringWriter, reader StringReader, cm
 		hasNoData := chunk.ColumnNames == nil
 
 		if aboveData || isEnd || isEmpty || hasNoData {
-			_, err = writer.WriteString(input)
+			flush()
+			output, _, err := processLargeObjectWrite(chunk.LargeObjects, input)
+			if err != nil {
+				log.Fatal(err)
+			}
+			_, err = writer.WriteString(output)
 			if err != nil {
 				log.Fatal(err)
 			}
 			continue
 		}
 
-		output := processRowFromChunk(cmaps, input, chunk)
-		_, err = writer.WriteString(output)
-		if err != nil {
-			log.Fatal(err)
+		if isLargeObjectTable(chunk.SchemaName, chunk.TableName) && cmaps == nil {
+			output, err := processLargeObjectRow(chunk.LargeObjects, chunk.ColumnNames, input)
+			if err != nil {
+				log.Fatal(err)
+			}
+			_, err = writer.WriteString(output)
+			if err != nil {
+				log.Fatal(err)
+			}
+			continue
+		}
+
+		rows = append(rows, input)
+		if len(rows) >= rowsPerBatch {
+			flush()
 		}
 	}
+	flush()
 }
 
 // getColumnMappers returns a slice of references to ColumnMappers corresponding to the columns of the given Chunk.
@@ -362,17 +424,78 @@ func getColumnMappers(mapper ColumnMapperContainer, chunk Chunk) ([]*ColumnMappe
 
 // processRowFromChunk processes a data row from a given Chunk
 func processRowFromChunk(cmaps []*ColumnMapper, inputLine string, chunk Chunk) string {
-	rowValues := strings.Split(inputLine, "\t")
-	outputValues := make([]string, 0, len(rowValues))
+	return processRowsFromChunk(cmaps, []string{inputLine}, chunk)[0]
+}
+
+// processRowsFromChunk processes many data rows from a given Chunk. The values of each column are processed together.
+func processRowsFromChunk(cmaps []*ColumnMapper, inputLines []string, chunk Chunk) []string {
+	rows := make([][]string, len(inputLines))
+	for r, inputLine := range inputLines {
+		rows[r] = strings.Split(inputLine, "\t")[:len(cmaps)]
+	}
+
+	// original values of each row, only built when a processor reads other columns
+	var rowMaps []map[string]string
+	for _, cmap := range cmaps {
+		if cmap != nil && readsRow(cmap) {
+			rowMaps = make([]map[string]string, len(rows))
+			for r, row := range rows {
+				rowMaps[r] = rowValues(chunk.ColumnNames, row)
+			}
+			break
+		}
+	}
 
 	for i, cmap := range cmaps {
-		output := processRawValue(rowValues[i], chunk.ColumnNames[i], cmap)
+		if cmap == nil {
+			continue
+		}
+
+		var (
+			indexes   []int
+			values    []string
+			suffixes  []string
+			valueRows []map[string]string
+		)
+		for r, row := range rows {
+			value, suffix := trimRawValue(row[i])
+			if value == copyNull && !cmap.ProcessNulls {
+				continue
+			}
+			indexes = append(indexes, r)
+			values = append(values, value)
+			suffixes = append(suffixes, suffix)
+			if rowMaps != nil {
+				valueRows = append(valueRows, rowMaps[r])
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		outputs, err := processValuesInRows(cmap, values, valueRows)
+		if err != nil {
+			log.Debug("columnName: ", chunk.ColumnNames[i])
+			log.Fatal(err)
+		}
+		for k, r := range indexes {
+			rows[r][i] = outputs[k] + suffixes[k]
+		}
+	}
 
-		// Append the column to our new line
-		outputValues = append(outputValues, output)
+	outputLines := make([]string, len(rows))
+	for r, row := range rows {
+		outputLines[r] = strings.Join(row, "\t")
 	}
+	return outputLines
+}
 
-	return strings.Join(outputValues, "\t")
+// trimRawValue cuts the escape character from the end of the last value of a row so it can be added back later.
+func trimRawValue(rawValue string) (string, string) {
+	if strings.HasSuffix(rawValue, "\n") {
+		return strings.Replace(rawValue, "\n", "", -1), "\n"
+	}
+	return rawValue, ""
 }
 
 // processRawValue takes a rawValue of a row.column from the dump and anonymizes it
@@ -385,13 +508,10 @@ func processRawValue(rawValue, columnName string, cmap *ColumnMapper) string {
 
 	// Check to see if the column has an escape char at the end of it.
 	// If so cut it and keep it for later
-	if strings.HasSuffix(rawValue, "\n") {
-		escapeChar = "\n"
-		rawValue = strings.Replace(rawValue, "\n", "", -1)
-	}
+	rawValue, escapeChar = trimRawValue(rawValue)
 
 	// If column value is nil or if this column is not mapped, keep the value and continue on
-	if rawValue == "\\N" || cmap == nil {
+	if cmap == nil || (rawValue == copyNull && !cmap.ProcessNulls) {
 		output = rawValue
 	} else {
 		output, err = processValue(cmap, rawValue)
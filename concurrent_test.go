@@ -120,7 +120,7 @@ COPY public.bar_bar (id, name) FROM stdin;
 			var chunks = make(chan Chunk)
 			arg := tt.args
 
-			go createChunks(chunks, arg.reader, &wg, arg.inclusive, arg.maxLinesPerChunk)
+			go createChunks(chunks, arg.reader, &wg, arg.inclusive, LargeObjectsKeep, arg.maxLinesPerChunk)
 
 			wg.Add(1)
 			go func() {
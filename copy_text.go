@@ -0,0 +1,95 @@
+package gonymizer
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Values inside of a COPY ... FROM stdin block use PostgreSQL's text format. Backslashes, tabs, newlines and carriage
+// returns are escaped with a backslash and \N is used for NULL.
+// See: https://www.postgresql.org/docs/current/sql-copy.html#id-1.9.3.55.9.2
+
+// copyNull is the marker pg_dump uses for NULL values in COPY blocks.
+const copyNull = "\\N"
+
+// unescapeCopyText converts a value from a COPY block into the raw text stored in the column.
+func unescapeCopyText(input string) string {
+	if !strings.Contains(input, "\\") {
+		return input
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		if c != '\\' || i+1 >= len(input) {
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		switch c = input[i]; {
+		case c == 'b':
+			b.WriteByte('\b')
+		case c == 'f':
+			b.WriteByte('\f')
+		case c == 'n':
+			b.WriteByte('\n')
+		case c == 'r':
+			b.WriteByte('\r')
+		case c == 't':
+			b.WriteByte('\t')
+		case c == 'v':
+			b.WriteByte('\v')
+		case c >= '0' && c <= '7':
+			end := i + 1
+			for end < len(input) && end < i+3 && input[end] >= '0' && input[end] <= '7' {
+				end++
+			}
+			value, _ := strconv.ParseUint(input[i:end], 8, 8)
+			b.WriteByte(byte(value))
+			i = end - 1
+		case c == 'x' && i+1 < len(input) && isHexDigit(input[i+1]):
+			end := i + 2
+			if end < len(input) && isHexDigit(input[end]) {
+				end++
+			}
+			value, _ := strconv.ParseUint(input[i+1:end], 16, 8)
+			b.WriteByte(byte(value))
+			i = end - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// escapeCopyText converts raw column text into a value that can be written to a COPY block.
+func escapeCopyText(input string) string {
+	var b strings.Builder
+	for i := 0; i < len(input); i++ {
+		switch c := input[i]; c {
+		case '\\':
+			b.WriteString("\\\\")
+		case '\b':
+			b.WriteString("\\b")
+		case '\f':
+			b.WriteString("\\f")
+		case '\n':
+			b.WriteString("\\n")
+		case '\r':
+			b.WriteString("\\r")
+		case '\t':
+			b.WriteString("\\t")
+		case '\v':
+			b.WriteString("\\v")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// isHexDigit returns true for upper and lower case hexadecimal digits.
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,18 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyTextRoundTrip(t *testing.T) {
+	raw := "tab\there\nnewline \\ backslash \r\b\f\v"
+	escaped := escapeCopyText(raw)
+	require.NotContains(t, escaped, "\t")
+	require.NotContains(t, escaped, "\n")
+	require.Equal(t, raw, unescapeCopyText(escaped))
+
+	require.Equal(t, "A\x01B", unescapeCopyText("\\101\\x01B"))
+	require.Equal(t, "plain", unescapeCopyText("plain"))
+}
@@ -75,7 +75,8 @@ func GetAllSchemaColumns(db *sql.DB) (*sql.Rows, error) {
 			        TRUE
           WHEN is_nullable = 'NO' THEN
               FALSE
-					END AS is_nullable
+					END AS is_nullable,
+			character_maximum_length, numeric_precision, numeric_scale, udt_name
 			FROM information_schema.columns
 			WHERE table_schema NOT IN ('information_schema', 'pg_catalog')
 			ORDER BY table_schema, table_name, ordinal_position
@@ -107,22 +108,128 @@ func GetTablesName(db *sql.DB) (*sql.Rows, error) {
 	return rows, nil
 }
 
-// GetRelationalColumn will return a row pointer to a list of table and column names relations.
-func GetRelationalColumns(db *sql.DB, tables string) (*sql.Rows, error) {
+// GetRelationalColumns will return a row pointer to the columns of every foreign key, one row per column with the
+// column of the parent table it references. Columns of a foreign key with more than one are in the order of the
+// constraint, see column_position.
+func GetRelationalColumns(db *sql.DB) (*sql.Rows, error) {
 	query := `
 		SELECT
-			tc.table_schema,
-			tc.table_name, kcu.column_name, 
-			ccu.table_name AS foreign_table_name,
-			ccu.column_name AS foreign_column_name, tc.constraint_name
-		FROM 
-			information_schema.table_constraints AS tc 
-		JOIN information_schema.key_column_usage AS kcu
-			ON tc.constraint_name = kcu.constraint_name
-		JOIN information_schema.constraint_column_usage AS ccu
-			ON ccu.constraint_name = tc.constraint_name
-		WHERE constraint_type = 'FOREIGN KEY' AND tc.table_name IN
-	` + tables + ";"
+			n.nspname AS table_schema,
+			c.relname AS table_name,
+			a.attname AS column_name,
+			pn.nspname AS foreign_table_schema,
+			p.relname AS foreign_table_name,
+			pa.attname AS foreign_column_name,
+			con.conname AS constraint_name,
+			k.position AS column_position
+		FROM pg_catalog.pg_constraint AS con
+		CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, foreign_attnum, position)
+		JOIN pg_catalog.pg_class AS c ON c.oid = con.conrelid
+		JOIN pg_catalog.pg_namespace AS n ON n.oid = c.relnamespace
+		JOIN pg_catalog.pg_attribute AS a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+		JOIN pg_catalog.pg_class AS p ON p.oid = con.confrelid
+		JOIN pg_catalog.pg_namespace AS pn ON pn.oid = p.relnamespace
+		JOIN pg_catalog.pg_attribute AS pa ON pa.attrelid = con.confrelid AND pa.attnum = k.foreign_attnum
+		WHERE con.contype = 'f' AND n.nspname NOT IN ('information_schema', 'pg_catalog')
+		ORDER BY n.nspname, c.relname, con.conname, k.position
+	`
+
+	rows, err := db.Query(query)
+
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ForeignKey is a foreign key constraint: the Columns of a table reference the ParentColumns of its parent table, in
+// the same order.
+type ForeignKey struct {
+	Name          string
+	TableSchema   string
+	TableName     string
+	Columns       []string
+	ParentSchema  string
+	ParentTable   string
+	ParentColumns []string
+}
+
+// GetForeignKeys returns the foreign keys between the tables of the database.
+func GetForeignKeys(db *sql.DB) ([]ForeignKey, error) {
+	relationRows, err := GetRelationalColumns(db)
+	if err != nil {
+		return nil, err
+	}
+	defer relationRows.Close()
+	return foreignKeysFromRows(ProcessRowToMap(relationRows)), nil
+}
+
+// foreignKeysFromRows groups the rows of GetRelationalColumns by constraint.
+func foreignKeysFromRows(relationRows []map[string]interface{}) []ForeignKey {
+	var foreignKeys []ForeignKey
+	index := make(map[string]int)
+	for _, value := range relationRows {
+		schemaName := fmt.Sprint(value["table_schema"])
+		tableName := fmt.Sprint(value["table_name"])
+		name := fmt.Sprint(value["constraint_name"])
+
+		// constraint names are unique per table
+		key := fmt.Sprintf("%s.%s.%s", schemaName, tableName, name)
+		i, ok := index[key]
+		if !ok {
+			i = len(foreignKeys)
+			index[key] = i
+			foreignKeys = append(foreignKeys, ForeignKey{
+				Name:         name,
+				TableSchema:  schemaName,
+				TableName:    tableName,
+				ParentSchema: fmt.Sprint(value["foreign_table_schema"]),
+				ParentTable:  fmt.Sprint(value["foreign_table_name"]),
+			})
+		}
+		fk := &foreignKeys[i]
+		fk.Columns = append(fk.Columns, fmt.Sprint(value["column_name"]))
+		fk.ParentColumns = append(fk.ParentColumns, fmt.Sprint(value["foreign_column_name"]))
+	}
+	return foreignKeys
+}
+
+// GetEnumLabels will return a row pointer to the labels of every enum column, in the enum's sort order.
+func GetEnumLabels(db *sql.DB) (*sql.Rows, error) {
+	query := `
+		SELECT n.nspname AS table_schema, c.relname AS table_name, a.attname AS column_name, e.enumlabel
+		FROM pg_catalog.pg_attribute AS a
+		JOIN pg_catalog.pg_class AS c ON c.oid = a.attrelid
+		JOIN pg_catalog.pg_namespace AS n ON n.oid = c.relnamespace
+		JOIN pg_catalog.pg_enum AS e ON e.enumtypid = a.atttypid
+		WHERE a.attnum > 0 AND NOT a.attisdropped AND c.relkind IN ('r', 'p')
+			AND n.nspname NOT IN ('information_schema', 'pg_catalog')
+		ORDER BY n.nspname, c.relname, a.attname, e.enumsortorder
+	`
+
+	rows, err := db.Query(query)
+
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return rows, nil
+}
+
+// GetColumnCheckConstraints will return a row pointer to the definition of every CHECK constraint on a single column.
+func GetColumnCheckConstraints(db *sql.DB) (*sql.Rows, error) {
+	query := `
+		SELECT n.nspname AS table_schema, c.relname AS table_name, a.attname AS column_name,
+			pg_catalog.pg_get_constraintdef(con.oid) AS definition
+		FROM pg_catalog.pg_constraint AS con
+		JOIN pg_catalog.pg_class AS c ON c.oid = con.conrelid
+		JOIN pg_catalog.pg_namespace AS n ON n.oid = c.relnamespace
+		JOIN pg_catalog.pg_attribute AS a ON a.attrelid = c.oid AND a.attnum = con.conkey[1]
+		WHERE con.contype = 'c' AND array_length(con.conkey, 1) = 1
+			AND n.nspname NOT IN ('information_schema', 'pg_catalog')
+		ORDER BY n.nspname, c.relname, a.attname
+	`
 
 	rows, err := db.Query(query)
 
@@ -238,7 +345,8 @@ func GetSchemaColumnEquals(db *sql.DB, schema string) (*sql.Rows, error) {
 			        TRUE
           WHEN is_nullable = 'NO' THEN
               FALSE
-					END AS is_nullable
+					END AS is_nullable,
+			character_maximum_length, numeric_precision, numeric_scale, udt_name
 	FROM information_schema.columns
 	WHERE table_schema = $1
 	ORDER BY table_schema, table_name, ordinal_position`, schema)
@@ -277,7 +385,8 @@ func GetSchemaColumnsLike(db *sql.DB, schemaPrefix string) (*sql.Rows, error) {
 			        TRUE
           WHEN is_nullable = 'NO' THEN
               FALSE
-					END AS is_nullable
+					END AS is_nullable,
+			character_maximum_length, numeric_precision, numeric_scale, udt_name
 			FROM information_schema.columns
 			WHERE table_schema = $1
 			ORDER BY table_schema, table_name, ordinal_position`, selectedSchema)
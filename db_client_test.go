@@ -129,3 +129,44 @@ func TestRenameDatabase(t *testing.T) {
 	conf.DefaultDBName = tempDbTo
 	require.Nil(t, DropDatabase(conf))
 }
+
+func TestForeignKeysFromRows(t *testing.T) {
+	row := func(table, column, parentSchema, parentTable, parentColumn, name string) map[string]interface{} {
+		return map[string]interface{}{
+			"table_schema":         "public",
+			"table_name":           table,
+			"column_name":          column,
+			"foreign_table_schema": parentSchema,
+			"foreign_table_name":   parentTable,
+			"foreign_column_name":  parentColumn,
+			"constraint_name":      name,
+		}
+	}
+
+	// rows are in the order of the columns of each constraint, the same name on another table is another constraint
+	foreignKeys := foreignKeysFromRows([]map[string]interface{}{
+		row("items", "product_version", "catalog", "products", "version", "product_fkey"),
+		row("items", "product_id", "catalog", "products", "id", "product_fkey"),
+		row("reviews", "product_id", "catalog", "products", "id", "product_fkey"),
+	})
+	require.Equal(t, []ForeignKey{
+		{
+			Name:          "product_fkey",
+			TableSchema:   "public",
+			TableName:     "items",
+			Columns:       []string{"product_version", "product_id"},
+			ParentSchema:  "catalog",
+			ParentTable:   "products",
+			ParentColumns: []string{"version", "id"},
+		},
+		{
+			Name:          "product_fkey",
+			TableSchema:   "public",
+			TableName:     "reviews",
+			Columns:       []string{"product_id"},
+			ParentSchema:  "catalog",
+			ParentTable:   "products",
+			ParentColumns: []string{"id"},
+		},
+	}, foreignKeys)
+}
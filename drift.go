@@ -0,0 +1,120 @@
+package gonymizer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Policies of CheckSchemaDrift
+const (
+	DriftFail   = "fail"
+	DriftWarn   = "warn"
+	DriftIgnore = "ignore"
+)
+
+// DriftPolicies are the policies accepted by CheckSchemaDrift.
+var DriftPolicies = []string{DriftFail, DriftWarn, DriftIgnore}
+
+// Kinds of SchemaDrift
+const (
+	DriftUnmapped = "unmapped"
+	DriftMistyped = "mistyped"
+)
+
+// SchemaDrift is a column of the database that the map file does not describe: a column that is in neither ColumnMaps
+// nor matched by a rule, which is dumped and processed as it is, or a column whose data type differs from its entry.
+type SchemaDrift struct {
+	Kind   string
+	Column string
+
+	// the data type of the column in the map, for mistyped columns, and in the database
+	Mapped string `json:",omitempty"`
+	Live   string
+}
+
+// String returns the drift as a line of text.
+func (drift SchemaDrift) String() string {
+	if drift.Kind == DriftUnmapped {
+		return fmt.Sprintf("%s (%s) is not in the map", drift.Column, drift.Live)
+	}
+	return fmt.Sprintf("%s is %s in the map but %s in the database", drift.Column, drift.Mapped, drift.Live)
+}
+
+// FindSchemaDrift compares the columns of the database with a map and returns every column that is unmapped or
+// mistyped, sorted by column. The map must be validated for its rules to be applied, I.E. by LoadConfigSkeleton.
+func FindSchemaDrift(dbMap *DBMapper, live []ColumnMapper) []SchemaDrift {
+	var drifts []SchemaDrift
+	for _, col := range live {
+		key := columnKey(col)
+		exact := dbMap.exactColumnMapper(col.TableSchema, col.TableName, col.ColumnName)
+		if exact == nil {
+			if dbMap.ColumnMapper(col.TableSchema, col.TableName, col.ColumnName) == nil {
+				drifts = append(drifts, SchemaDrift{Kind: DriftUnmapped, Column: key, Live: columnType(col)})
+			}
+			continue
+		}
+		if !sameColumnType(*exact, col) {
+			drifts = append(drifts, SchemaDrift{
+				Kind:   DriftMistyped,
+				Column: key,
+				Mapped: columnType(*exact),
+				Live:   columnType(col),
+			})
+		}
+	}
+
+	sort.SliceStable(drifts, func(i, j int) bool {
+		return drifts[i].Column < drifts[j].Column
+	})
+	return drifts
+}
+
+// CheckSchemaDrift compares the columns of the database that will be dumped with a map before the dump is created.
+// Every drift is logged. With the DriftFail policy an error listing all of them is returned, with DriftWarn they are
+// only logged and with DriftIgnore the database is not checked.
+func CheckSchemaDrift(
+	conf PGConfig,
+	dbMap *DBMapper,
+	policy,
+	schemaPrefix string,
+	schemas,
+	excludeTables []string,
+) ([]SchemaDrift, error) {
+	switch policy {
+	case DriftIgnore:
+		return nil, nil
+	case DriftFail, DriftWarn:
+	default:
+		return nil, fmt.Errorf("Unknown drift policy %q, expected one of: %s", policy,
+			strings.Join(DriftPolicies, ", "))
+	}
+
+	// pg_dump dumps every schema when none is given, an empty schema maps all of them
+	if len(schemas) == 0 {
+		schemas = []string{""}
+	}
+	generated, err := GenerateConfigSkeleton(conf, schemaPrefix, schemas, excludeTables)
+	if err != nil {
+		return nil, err
+	}
+
+	drifts := FindSchemaDrift(dbMap, generated.ColumnMaps)
+	if len(drifts) == 0 {
+		log.Info("The map file matches the columns of the database")
+		return nil, nil
+	}
+
+	lines := make([]string, len(drifts))
+	for i, drift := range drifts {
+		lines[i] = drift.String()
+		log.Warn(lines[i])
+	}
+	if policy == DriftFail {
+		return drifts, fmt.Errorf("Found %d columns that do not match the map file:\n%s", len(drifts),
+			strings.Join(lines, "\n"))
+	}
+	return drifts, nil
+}
@@ -0,0 +1,84 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindSchemaDrift(t *testing.T) {
+	dbMap := DBMapper{
+		DBName: "test",
+		Rules:  []ColumnRule{{ColumnName: "*_email", Processors: []ProcessorDefinition{{Name: "FakeEmailAddress"}}}},
+		ColumnMaps: []ColumnMapper{
+			{TableSchema: "public", TableName: "users", ColumnName: "id", DataType: "integer",
+				Processors: []ProcessorDefinition{{Name: "Identity"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "name", DataType: "character varying",
+				CharacterMaximumLength: 50, Processors: []ProcessorDefinition{{Name: "FakeFirstName"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "fax", DataType: "text",
+				Processors: []ProcessorDefinition{{Name: "FakePhoneNumber"}}},
+		},
+	}
+	require.Nil(t, dbMap.Validate())
+
+	live := []ColumnMapper{
+		{TableSchema: "public", TableName: "users", ColumnName: "id", DataType: "bigint"},
+		{TableSchema: "public", TableName: "users", ColumnName: "name", DataType: "character varying",
+			CharacterMaximumLength: 50},
+		{TableSchema: "public", TableName: "users", ColumnName: "work_email", DataType: "text"},
+		{TableSchema: "public", TableName: "users", ColumnName: "ssn", DataType: "text"},
+		{TableSchema: "public", TableName: "accounts", ColumnName: "iban", DataType: "text"},
+	}
+
+	drifts := FindSchemaDrift(&dbMap, live)
+	require.Equal(t, []SchemaDrift{
+		{Kind: DriftUnmapped, Column: "public.accounts.iban", Live: "text"},
+		{Kind: DriftMistyped, Column: "public.users.id", Mapped: "integer", Live: "bigint"},
+		{Kind: DriftUnmapped, Column: "public.users.ssn", Live: "text"},
+	}, drifts)
+	require.Equal(t, "public.accounts.iban (text) is not in the map", drifts[0].String())
+	require.Equal(t, "public.users.id is integer in the map but bigint in the database", drifts[1].String())
+
+	require.Empty(t, FindSchemaDrift(&dbMap, live[1:3]))
+
+	// maps without the limits of the data types only compare the DataType
+	require.Empty(t, FindSchemaDrift(&dbMap, []ColumnMapper{
+		{TableSchema: "public", TableName: "users", ColumnName: "fax", DataType: "text", CharacterMaximumLength: 20},
+	}))
+	drifts = FindSchemaDrift(&dbMap, []ColumnMapper{
+		{TableSchema: "public", TableName: "users", ColumnName: "name", DataType: "character varying",
+			CharacterMaximumLength: 60},
+	})
+	require.Equal(t, "public.users.name is character varying(50) in the map but character varying(60) in the database",
+		drifts[0].String())
+}
+
+func TestCheckSchemaDrift(t *testing.T) {
+	conf := GetTestDbConf(TestDb)
+
+	// without schemas every schema is mapped, each column in the schema of its table
+	skeleton, err := GenerateConfigSkeleton(conf, TestSchemaPrefix, []string{""}, TestExcludeTable)
+	require.Nil(t, err)
+	require.NotEmpty(t, skeleton.ColumnMaps)
+	for _, col := range skeleton.ColumnMaps {
+		require.NotEmpty(t, col.TableSchema, col.ColumnName)
+		require.NotEqual(t, TestExcludeTable[0], col.TableName)
+	}
+
+	drifts, err := CheckSchemaDrift(conf, skeleton, DriftFail, TestSchemaPrefix, nil, TestExcludeTable)
+	require.Nil(t, err)
+	require.Empty(t, drifts)
+
+	drifts, err = CheckSchemaDrift(conf, &DBMapper{}, DriftWarn, TestSchemaPrefix, []string{}, TestExcludeTable)
+	require.Nil(t, err)
+	require.Len(t, drifts, len(skeleton.ColumnMaps))
+}
+
+func TestCheckSchemaDriftPolicy(t *testing.T) {
+	drifts, err := CheckSchemaDrift(PGConfig{}, &DBMapper{}, DriftIgnore, "", nil, nil)
+	require.Nil(t, err)
+	require.Nil(t, drifts)
+
+	_, err = CheckSchemaDrift(PGConfig{}, &DBMapper{}, "refuse", "", nil, nil)
+	require.EqualError(t, err, `Unknown drift policy "refuse", expected one of: fail, warn, ignore`)
+}
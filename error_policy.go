@@ -0,0 +1,181 @@
+package gonymizer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// OnErrorFail stops processing when a processor fails (default)
+// OnErrorNull writes NULL instead of the value. The column must be nullable
+// OnErrorFallback runs the Fallback processors on the value that the failed processor was given
+// OnErrorConstant writes the policy's Value instead of the value
+const (
+	OnErrorFail     = "fail"
+	OnErrorNull     = "null"
+	OnErrorFallback = "fallback"
+	OnErrorConstant = "constant"
+)
+
+// ErrorPolicy decides what happens to a value when a processor fails on it. It can be set on a ColumnMapper, and on a
+// ProcessorDefinition to override the column's policy for a single processor. The output of the policy takes the place
+// of the failed processor's output and is passed on to the next processor.
+type ErrorPolicy struct {
+	Action string
+
+	// processors used by the fallback action
+	Fallback []ProcessorDefinition `json:",omitempty"`
+
+	// text written by the constant action
+	Value string `json:",omitempty"`
+}
+
+// errorPolicyStats counts the values that took each action, by column, for the summary at the end of a run.
+var errorPolicyStats = struct {
+	mux    sync.Mutex
+	counts map[string]map[string]int
+}{
+	counts: make(map[string]map[string]int),
+}
+
+// ErrorPolicyCount is the number of values of a column that took an OnError action.
+type ErrorPolicyCount struct {
+	Column string
+	Action string
+	Count  int
+}
+
+// validateErrorPolicy checks the action of an ErrorPolicy and the processors of its fallback.
+func validateErrorPolicy(path string, policy *ErrorPolicy, isNullable bool) error {
+	switch policy.Action {
+	case OnErrorFail, OnErrorNull, OnErrorFallback, OnErrorConstant:
+	default:
+		return fmt.Errorf("%s: Unknown OnError action %q. Expected one of: %s, %s, %s, %s", path, policy.Action,
+			OnErrorFail, OnErrorNull, OnErrorFallback, OnErrorConstant)
+	}
+
+	if policy.Action == OnErrorNull && !isNullable {
+		return fmt.Errorf("%s: OnError %s requires a nullable column", path, OnErrorNull)
+	}
+	if policy.Action != OnErrorConstant && policy.Value != "" {
+		return fmt.Errorf("%s: OnError Value is only used by the %s action", path, OnErrorConstant)
+	}
+	if policy.Action != OnErrorFallback {
+		if len(policy.Fallback) > 0 {
+			return fmt.Errorf("%s: OnError Fallback is only used by the %s action", path, OnErrorFallback)
+		}
+		return nil
+	}
+
+	if len(policy.Fallback) == 0 {
+		return fmt.Errorf("%s: OnError %s requires Fallback processors", path, OnErrorFallback)
+	}
+	for i, procDef := range policy.Fallback {
+		if procDef.OnError != nil {
+			return fmt.Errorf("%s.Fallback[%d]: Fallback processors can not have an OnError policy", path, i)
+		}
+	}
+	return validateProcessors(path+".Fallback", policy.Fallback)
+}
+
+// errorPolicy returns the policy for a failure of procDef, which is the processor's own policy or else the column's.
+func errorPolicy(cmap *ColumnMapper, procDef ProcessorDefinition) *ErrorPolicy {
+	if procDef.OnError != nil {
+		return procDef.OnError
+	}
+	return cmap.OnError
+}
+
+// applyErrorPolicy returns the output of the error policy for an input that procDef failed on. The original error is
+// returned if the policy is to fail.
+func applyErrorPolicy(cmap *ColumnMapper, procDef ProcessorDefinition, input string, row map[string]string,
+	cause error) (string, error) {
+
+	policy := errorPolicy(cmap, procDef)
+	if policy == nil || policy.Action == "" || policy.Action == OnErrorFail {
+		return "", cause
+	}
+	log.Debugf("%s.%s.%s: Processor %s failed, using OnError %s: %s", cmap.TableSchema, cmap.TableName,
+		cmap.ColumnName, procDef.Name, policy.Action, cause)
+
+	var output string
+	switch policy.Action {
+	case OnErrorNull:
+		if !cmap.IsNullable {
+			return "", fmt.Errorf("%s (OnError %s requires a nullable column)", cause, OnErrorNull)
+		}
+		output = copyNull
+	case OnErrorConstant:
+		output = escapeCopyText(policy.Value)
+	case OnErrorFallback:
+		// the fallback runs as its own chain and its failures are not handled again
+		fallback := *cmap
+		fallback.OnError = nil
+		fallback.Processors = policy.Fallback
+		var err error
+		if output, err = processValueInRow(&fallback, input, row); err != nil {
+			return "", fmt.Errorf("%s (OnError %s failed: %s)", cause, OnErrorFallback, err)
+		}
+	default:
+		return "", errors.New("Unknown OnError action: " + policy.Action)
+	}
+
+	recordErrorPolicy(cmap, policy.Action)
+	return output, nil
+}
+
+// recordErrorPolicy counts a value of the column that took an OnError action.
+func recordErrorPolicy(cmap *ColumnMapper, action string) {
+	column := fmt.Sprintf("%s.%s.%s", cmap.TableSchema, cmap.TableName, cmap.ColumnName)
+
+	errorPolicyStats.mux.Lock()
+	defer errorPolicyStats.mux.Unlock()
+
+	if errorPolicyStats.counts[column] == nil {
+		errorPolicyStats.counts[column] = make(map[string]int)
+	}
+	errorPolicyStats.counts[column][action]++
+}
+
+// ErrorPolicySummary returns the number of values that took each OnError action, by column, since processing started.
+func ErrorPolicySummary() []ErrorPolicyCount {
+	errorPolicyStats.mux.Lock()
+	defer errorPolicyStats.mux.Unlock()
+
+	var summary []ErrorPolicyCount
+	for column, actions := range errorPolicyStats.counts {
+		for action, count := range actions {
+			summary = append(summary, ErrorPolicyCount{Column: column, Action: action, Count: count})
+		}
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Column != summary[j].Column {
+			return summary[i].Column < summary[j].Column
+		}
+		return summary[i].Action < summary[j].Action
+	})
+	return summary
+}
+
+// resetErrorPolicySummary clears the counts at the start of a run.
+func resetErrorPolicySummary() {
+	errorPolicyStats.mux.Lock()
+	defer errorPolicyStats.mux.Unlock()
+
+	errorPolicyStats.counts = make(map[string]map[string]int)
+}
+
+// logErrorPolicySummary logs the counts at the end of a run.
+func logErrorPolicySummary() {
+	summary := ErrorPolicySummary()
+	if len(summary) == 0 {
+		return
+	}
+	log.Warn("Some values could not be processed and were handled by their OnError policy:")
+	for _, count := range summary {
+		log.Warnf("  %s: %d value(s) used %s", count.Column, count.Count, count.Action)
+	}
+}
@@ -0,0 +1,128 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateErrorPolicy(t *testing.T) {
+	valid := []*ErrorPolicy{
+		{Action: OnErrorFail},
+		{Action: OnErrorNull},
+		{Action: OnErrorConstant, Value: "1970-01-01"},
+		{Action: OnErrorConstant},
+		{Action: OnErrorFallback, Fallback: []ProcessorDefinition{{Name: "ScrubString"}}},
+	}
+	for _, policy := range valid {
+		require.Nil(t, validateErrorPolicy("OnError", policy, true), policy.Action)
+	}
+
+	invalid := []*ErrorPolicy{
+		{},
+		{Action: "skip"},
+		{Action: OnErrorFail, Value: "x"},
+		{Action: OnErrorNull, Fallback: []ProcessorDefinition{{Name: "ScrubString"}}},
+		{Action: OnErrorFallback},
+		{Action: OnErrorFallback, Fallback: []ProcessorDefinition{{Name: "NotAProcessor"}}},
+		{Action: OnErrorFallback, Fallback: []ProcessorDefinition{
+			{Name: "ScrubString", OnError: &ErrorPolicy{Action: OnErrorNull}},
+		}},
+	}
+	for _, policy := range invalid {
+		require.NotNil(t, validateErrorPolicy("OnError", policy, true), policy.Action)
+	}
+	require.NotNil(t, validateErrorPolicy("OnError", &ErrorPolicy{Action: OnErrorNull}, false))
+
+	dbMap := DBMapper{
+		DBName: "test",
+		ColumnMaps: []ColumnMapper{{
+			TableSchema: "public",
+			TableName:   "people",
+			ColumnName:  "born",
+			Processors: []ProcessorDefinition{{
+				Name:    "Identity",
+				OnError: &ErrorPolicy{Action: OnErrorFallback, Fallback: []ProcessorDefinition{{Name: "Nope"}}},
+			}},
+		}},
+	}
+	err := dbMap.Validate()
+	require.NotNil(t, err)
+	require.Equal(t, "public.people.born Processors[0].OnError.Fallback[0]: Unrecognized Processor Nope", err.Error())
+
+	dbMap.ColumnMaps[0].Processors[0].OnError = nil
+	dbMap.ColumnMaps[0].OnError = &ErrorPolicy{Action: OnErrorNull}
+	err = dbMap.Validate()
+	require.NotNil(t, err)
+	require.Equal(t, "public.people.born OnError: OnError null requires a nullable column", err.Error())
+}
+
+func TestApplyErrorPolicy(t *testing.T) {
+	resetErrorPolicySummary()
+	defer resetErrorPolicySummary()
+
+	failing := expressionStep(`num(input) + 1`)
+	cases := []struct {
+		column   *ErrorPolicy
+		step     *ErrorPolicy
+		output   string
+		hasError bool
+	}{
+		{nil, nil, "", true},
+		{&ErrorPolicy{Action: OnErrorFail}, nil, "", true},
+		{&ErrorPolicy{Action: OnErrorNull}, nil, copyNull, false},
+		{&ErrorPolicy{Action: OnErrorConstant, Value: "tab\there"}, nil, "TAB\\tHERE!", false},
+		{&ErrorPolicy{Action: OnErrorConstant, Value: "column"}, &ErrorPolicy{Action: OnErrorConstant, Value: "step"},
+			"STEP!", false},
+		{&ErrorPolicy{Action: OnErrorNull}, &ErrorPolicy{Action: OnErrorFail}, "", true},
+		{&ErrorPolicy{Action: OnErrorFallback, Fallback: []ProcessorDefinition{expressionStep(`input + "?"`)}}, nil,
+			"ABC?!", false},
+		{&ErrorPolicy{Action: OnErrorFallback, Fallback: []ProcessorDefinition{failing}}, nil, "", true},
+	}
+	for i, c := range cases {
+		step := failing
+		step.OnError = c.step
+		cmap := ColumnMapper{
+			TableSchema: "public",
+			TableName:   "people",
+			ColumnName:  "age",
+			IsNullable:  true,
+			OnError:     c.column,
+			Processors:  []ProcessorDefinition{step, expressionStep(`upper(input) + "!"`)},
+		}
+		output, err := processValue(&cmap, "abc")
+		if c.hasError {
+			require.NotNil(t, err, i)
+			continue
+		}
+		require.Nil(t, err, i)
+		require.Equal(t, c.output, output, i)
+	}
+
+	// values that do not fail keep their output
+	cmap := ColumnMapper{
+		TableSchema: "public",
+		TableName:   "people",
+		ColumnName:  "height",
+		OnError:     &ErrorPolicy{Action: OnErrorConstant, Value: "0"},
+		Processors:  []ProcessorDefinition{failing},
+	}
+	outputs, err := processValues(&cmap, []string{"1", "x", "2", "y"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"2", "0", "3", "0"}, outputs)
+
+	// a failed batch applies the policy to every value of the batch
+	cmap.Processors = []ProcessorDefinition{{Name: "Plugin", Params: map[string]interface{}{"Command": "true"}}}
+	require.Nil(t, constructProcessors(cmap.Processors))
+	outputs, err = processValues(&cmap, []string{"1", "2"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"0", "0"}, outputs)
+	ClosePlugins()
+
+	require.Equal(t, []ErrorPolicyCount{
+		{Column: "public.people.age", Action: OnErrorConstant, Count: 2},
+		{Column: "public.people.age", Action: OnErrorFallback, Count: 1},
+		{Column: "public.people.age", Action: OnErrorNull, Count: 1},
+		{Column: "public.people.height", Action: OnErrorConstant, Count: 4},
+	}, ErrorPolicySummary())
+}
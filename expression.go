@@ -0,0 +1,887 @@
+package gonymizer
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The Expression processor evaluates a small expression language. Expressions can only read the column value, the
+// other values of the row, and call the built-in functions below, so they can not reach the file system or network.
+//
+// Values are strings, numbers, booleans, or null. The supported syntax is:
+//
+//	literals      "text" 'text' 12 1.5 true false null
+//	variables     input (null for NULL values, see ProcessNulls), row.column_name, row["column name"]
+//	operators     + (add or concatenate) - * / %  == != < <= > >=  && || !  cond ? a : b  ( )
+//	functions     lower(s) upper(s) trim(s) len(s) substr(s, start[, length]) mask(s[, keepStart[, keepEnd[, char]]])
+//	              hash(s[, "sha256"|"sha1"|"md5"]) match(s, "regex") replace(s, "regex", replacement)
+//	              fake("FirstName") empty(v) coalesce(v, ...) str(v) num(v)
+//
+// I.E. lower(input) + "@example.com", substr(input, 0, 1) + "***", empty(input) ? input : hash(lower(input))
+
+// expressionConfig is the Params of the Expression processor.
+type expressionConfig struct {
+	Expression string
+}
+
+// exprEnv is what an expression can read while it is evaluated.
+type exprEnv struct {
+	cmap  *ColumnMapper
+	input interface{}
+	row   map[string]string
+}
+
+// exprNode is a node of a compiled expression.
+type exprNode interface {
+	eval(env *exprEnv) (interface{}, error)
+}
+
+// ProcessorExpression will evaluate the column's Expression. The other columns of the row are not available.
+func ProcessorExpression(cmap *ColumnMapper, input string) (string, error) {
+	return runConstructed(cmap, input, "Expression", newExpressionValue)
+}
+
+// newExpression is the row constructor for the Expression processor and compiles the expression.
+func newExpression(procDef ProcessorDefinition) (RowProcessorFunc, error) {
+	var config expressionConfig
+	if err := procDef.DecodeParams(&config); err != nil {
+		return nil, err
+	}
+	node, err := compileExpression(config.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(cmap *ColumnMapper, input string, row map[string]string) (string, error) {
+		env := exprEnv{cmap: cmap, row: row}
+		if input != copyNull {
+			env.input = unescapeCopyText(input)
+		}
+		value, err := node.eval(&env)
+		if err != nil {
+			return "", fmt.Errorf("Expression: %s", err)
+		}
+		if value == nil {
+			if !cmap.IsNullable {
+				return "", fmt.Errorf("Expression returned null for non-nullable column %s.%s.%s",
+					cmap.TableSchema, cmap.TableName, cmap.ColumnName)
+			}
+			return copyNull, nil
+		}
+		return escapeCopyText(exprString(value)), nil
+	}, nil
+}
+
+// newExpressionValue is the constructor for the Expression processor when no row is available.
+func newExpressionValue(procDef ProcessorDefinition) (ProcessorFunc, error) {
+	rowFunc, err := newExpression(procDef)
+	if err != nil {
+		return nil, err
+	}
+	return func(cmap *ColumnMapper, input string) (string, error) {
+		return rowFunc(cmap, input, nil)
+	}, nil
+}
+
+// compileExpression parses an expression.
+func compileExpression(source string) (exprNode, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, errors.New("Expression must not be empty")
+	}
+	tokens, err := lexExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	node, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, fmt.Errorf("Unexpected %q at %d", tok.text, tok.pos)
+	}
+	return node, nil
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type exprToken struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+// exprOperators are ordered so that longer operators are matched first.
+var exprOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!", "?", ":",
+	"(", ")", "[", "]", ",", "."}
+
+// lexExpression splits an expression into tokens.
+func lexExpression(source string) ([]exprToken, error) {
+	var tokens []exprToken
+
+	for i := 0; i < len(source); {
+		r, size := utf8.DecodeRuneInString(source[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r >= '0' && r <= '9':
+			start := i
+			for i < len(source) && (source[i] >= '0' && source[i] <= '9' || source[i] == '.') {
+				i++
+			}
+			value, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid number %q at %d", source[start:i], start)
+			}
+			tokens = append(tokens, exprToken{kind: tokenNumber, text: source[start:i], value: value, pos: start})
+		case r == '"' || r == '\'':
+			start := i
+			var b strings.Builder
+			closed := false
+			for i++; i < len(source); i++ {
+				c := source[i]
+				if c == byte(r) {
+					closed = true
+					i++
+					break
+				}
+				if c == '\\' && i+1 < len(source) {
+					i++
+					switch source[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(source[i])
+					}
+					continue
+				}
+				b.WriteByte(c)
+			}
+			if !closed {
+				return nil, fmt.Errorf("Unterminated string at %d", start)
+			}
+			tokens = append(tokens, exprToken{kind: tokenString, text: source[start:i], value: b.String(), pos: start})
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(source) {
+				r, size := utf8.DecodeRuneInString(source[i:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, exprToken{kind: tokenIdent, text: source[start:i], pos: start})
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, exprToken{kind: tokenOperator, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("Unexpected %q at %d", string(r), i)
+			}
+		}
+	}
+	return append(tokens, exprToken{kind: tokenEOF, text: "end of expression", pos: len(source)}), nil
+}
+
+// Parser
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is one of the given operators.
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokenOperator {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		tok := p.peek()
+		return fmt.Errorf("Expected %q but found %q at %d", op, tok.text, tok.pos)
+	}
+	return nil
+}
+
+func (p *exprParser) parseTernary() (exprNode, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept("?"); !ok {
+		return cond, nil
+	}
+	then, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	return &ternaryNode{cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+// exprPrecedence lists the binary operators from the lowest to the highest precedence.
+var exprPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) parseBinary(level int) (exprNode, error) {
+	if level == len(exprPrecedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(exprPrecedence[level]...)
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if op, ok := p.accept("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenNumber, tokenString:
+		return &literalNode{value: tok.value}, nil
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		case "input":
+			return inputNode{}, nil
+		case "row":
+			return p.parseRow()
+		}
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(tok)
+		}
+		return nil, fmt.Errorf("Unknown identifier %q at %d", tok.text, tok.pos)
+	case tokenOperator:
+		if tok.text == "(" {
+			node, err := p.parseTernary()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		}
+	}
+	return nil, fmt.Errorf("Unexpected %q at %d", tok.text, tok.pos)
+}
+
+// parseRow parses row.column_name or row["column name"].
+func (p *exprParser) parseRow() (exprNode, error) {
+	if _, ok := p.accept("."); ok {
+		tok := p.next()
+		if tok.kind != tokenIdent {
+			return nil, fmt.Errorf("Expected a column name but found %q at %d", tok.text, tok.pos)
+		}
+		return &rowNode{column: tok.text}, nil
+	}
+	if _, ok := p.accept("["); ok {
+		tok := p.next()
+		if tok.kind != tokenString {
+			return nil, fmt.Errorf("Expected a quoted column name but found %q at %d", tok.text, tok.pos)
+		}
+		return &rowNode{column: tok.value.(string)}, p.expect("]")
+	}
+	tok := p.peek()
+	return nil, fmt.Errorf("Expected row.column or row[\"column\"] at %d", tok.pos)
+}
+
+// parseCall parses the arguments of a function call and checks them against the function.
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	fn, ok := exprFunctions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("Unknown function %q at %d", name.text, name.pos)
+	}
+
+	var args []exprNode
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.parseTernary()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.accept(","); ok {
+				continue
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("Wrong number of arguments for %s at %d", name.text, name.pos)
+	}
+	call := &callNode{name: name.text, fn: fn, args: args}
+	if fn.compile != nil {
+		if err := fn.compile(call); err != nil {
+			return nil, fmt.Errorf("%s at %d: %s", name.text, name.pos, err)
+		}
+	}
+	return call, nil
+}
+
+// Nodes
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(env *exprEnv) (interface{}, error) {
+	return n.value, nil
+}
+
+type inputNode struct{}
+
+func (inputNode) eval(env *exprEnv) (interface{}, error) {
+	return env.input, nil
+}
+
+type rowNode struct {
+	column string
+}
+
+func (n *rowNode) eval(env *exprEnv) (interface{}, error) {
+	if env.row == nil {
+		return nil, fmt.Errorf("row.%s is not available", n.column)
+	}
+	value, ok := env.row[n.column]
+	if !ok {
+		return nil, fmt.Errorf("Unknown column %q", n.column)
+	}
+	if value == copyNull {
+		return nil, nil
+	}
+	return unescapeCopyText(value), nil
+}
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+func (n *unaryNode) eval(env *exprEnv) (interface{}, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !exprTruthy(value), nil
+	}
+	number, err := exprNumber(value)
+	if err != nil {
+		return nil, err
+	}
+	return -number, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(env *exprEnv) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || only evaluate the right side when needed
+	switch n.op {
+	case "&&":
+		if !exprTruthy(left) {
+			return false, nil
+		}
+		right, err := n.right.eval(env)
+		return exprTruthy(right), err
+	case "||":
+		if exprTruthy(left) {
+			return true, nil
+		}
+		right, err := n.right.eval(env)
+		return exprTruthy(right), err
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return exprEqual(left, right), nil
+	case "!=":
+		return !exprEqual(left, right), nil
+	case "<", "<=", ">", ">=":
+		cmp, err := exprCompare(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		default:
+			return cmp >= 0, nil
+		}
+	case "+":
+		_, leftIsString := left.(string)
+		_, rightIsString := right.(string)
+		if leftIsString || rightIsString {
+			return exprString(left) + exprString(right), nil
+		}
+	}
+
+	a, err := exprNumber(left)
+	if err != nil {
+		return nil, err
+	}
+	b, err := exprNumber(right)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, errors.New("Division by zero")
+		}
+		return a / b, nil
+	default:
+		if b == 0 {
+			return nil, errors.New("Division by zero")
+		}
+		return float64(int64(a) % int64(b)), nil
+	}
+}
+
+type ternaryNode struct {
+	cond, then, otherwise exprNode
+}
+
+func (n *ternaryNode) eval(env *exprEnv) (interface{}, error) {
+	cond, err := n.cond.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if exprTruthy(cond) {
+		return n.then.eval(env)
+	}
+	return n.otherwise.eval(env)
+}
+
+type callNode struct {
+	name  string
+	fn    exprFunction
+	args  []exprNode
+	regex *regexp.Regexp
+
+	// constructed when the expression is compiled, see fake
+	processor ProcessorFunc
+}
+
+func (n *callNode) eval(env *exprEnv) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return n.fn.call(n, env, args)
+}
+
+// Functions
+
+// exprFunction is a built-in function. maxArgs is -1 for any number of arguments. compile checks the call when the
+// expression is compiled, I.E. to compile regular expressions once.
+type exprFunction struct {
+	minArgs, maxArgs int
+	compile          func(call *callNode) error
+	call             func(call *callNode, env *exprEnv, args []interface{}) (interface{}, error)
+}
+
+// exprStringFunction wraps a function of a single string.
+func exprStringFunction(f func(string) interface{}) exprFunction {
+	return exprFunction{minArgs: 1, maxArgs: 1, call: func(call *callNode, env *exprEnv,
+		args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return f(exprString(args[0])), nil
+	}}
+}
+
+// literalArgument returns the string literal at index i of a call.
+func literalArgument(call *callNode, i int) (string, error) {
+	if literal, ok := call.args[i].(*literalNode); ok {
+		if s, ok := literal.value.(string); ok {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("argument %d must be a string literal", i+1)
+}
+
+// compileRegexArgument compiles the regular expression literal that is the second argument of a call.
+func compileRegexArgument(call *callNode) error {
+	pattern, err := literalArgument(call, 1)
+	if err != nil {
+		return err
+	}
+	call.regex, err = regexp.Compile(pattern)
+	return err
+}
+
+var exprFunctions map[string]exprFunction
+
+func init() {
+	exprFunctions = map[string]exprFunction{
+		"lower": exprStringFunction(func(s string) interface{} { return strings.ToLower(s) }),
+		"upper": exprStringFunction(func(s string) interface{} { return strings.ToUpper(s) }),
+		"trim":  exprStringFunction(func(s string) interface{} { return strings.TrimSpace(s) }),
+		"len":   exprStringFunction(func(s string) interface{} { return float64(utf8.RuneCountInString(s)) }),
+		"substr": {minArgs: 2, maxArgs: 3, call: func(call *callNode, env *exprEnv, args []interface{}) (interface{}, error) {
+			if args[0] == nil {
+				return nil, nil
+			}
+			runes := []rune(exprString(args[0]))
+			start, err := exprInt(args[1])
+			if err != nil {
+				return nil, err
+			}
+			length := len(runes)
+			if len(args) == 3 {
+				if length, err = exprInt(args[2]); err != nil {
+					return nil, err
+				}
+			}
+			start = clampInt(start, 0, len(runes))
+			end := clampInt(start+clampInt(length, 0, len(runes)), start, len(runes))
+			return string(runes[start:end]), nil
+		}},
+		"mask": {minArgs: 1, maxArgs: 4, call: func(call *callNode, env *exprEnv, args []interface{}) (interface{}, error) {
+			if args[0] == nil {
+				return nil, nil
+			}
+			runes := []rune(exprString(args[0]))
+			keepStart, keepEnd, char := 0, 0, "*"
+			var err error
+			if len(args) > 1 {
+				if keepStart, err = exprInt(args[1]); err != nil {
+					return nil, err
+				}
+			}
+			if len(args) > 2 {
+				if keepEnd, err = exprInt(args[2]); err != nil {
+					return nil, err
+				}
+			}
+			if len(args) > 3 {
+				char = exprString(args[3])
+			}
+			keepStart = clampInt(keepStart, 0, len(runes))
+			keepEnd = clampInt(keepEnd, 0, len(runes)-keepStart)
+			masked := strings.Repeat(char, len(runes)-keepStart-keepEnd)
+			return string(runes[:keepStart]) + masked + string(runes[len(runes)-keepEnd:]), nil
+		}},
+		"hash": {minArgs: 1, maxArgs: 2, compile: func(call *callNode) error {
+			if len(call.args) == 2 {
+				algorithm, err := literalArgument(call, 1)
+				if err != nil {
+					return err
+				}
+				if newHash(algorithm) == nil {
+					return fmt.Errorf("unknown hash %q", algorithm)
+				}
+			}
+			return nil
+		}, call: func(call *callNode, env *exprEnv, args []interface{}) (interface{}, error) {
+			if args[0] == nil {
+				return nil, nil
+			}
+			algorithm := "sha256"
+			if len(args) == 2 {
+				algorithm = exprString(args[1])
+			}
+			h := newHash(algorithm)
+			h.Write([]byte(exprString(args[0])))
+			return hex.EncodeToString(h.Sum(nil)), nil
+		}},
+		"match": {minArgs: 2, maxArgs: 2, compile: compileRegexArgument, call: func(call *callNode, env *exprEnv,
+			args []interface{}) (interface{}, error) {
+			return args[0] != nil && call.regex.MatchString(exprString(args[0])), nil
+		}},
+		"replace": {minArgs: 3, maxArgs: 3, compile: compileRegexArgument, call: func(call *callNode, env *exprEnv,
+			args []interface{}) (interface{}, error) {
+			if args[0] == nil {
+				return nil, nil
+			}
+			return call.regex.ReplaceAllString(exprString(args[0]), exprString(args[2])), nil
+		}},
+		"fake": {minArgs: 1, maxArgs: 1, compile: func(call *callNode) error {
+			name, err := literalArgument(call, 0)
+			if err != nil {
+				return err
+			}
+			info, ok := LookupProcessor("Fake" + name)
+			if !ok {
+				return fmt.Errorf("unknown faker %q", name)
+			}
+			call.processor, err = info.New(ProcessorDefinition{Name: info.Name})
+			return err
+		}, call: func(call *callNode, env *exprEnv, args []interface{}) (interface{}, error) {
+			input := copyNull
+			if env.input != nil {
+				input = escapeCopyText(exprString(env.input))
+			}
+			output, err := call.processor(env.cmap, input)
+			if err != nil {
+				return nil, err
+			}
+			return unescapeCopyText(output), nil
+		}},
+		"empty": {minArgs: 1, maxArgs: 1, call: func(call *callNode, env *exprEnv, args []interface{}) (interface{}, error) {
+			return args[0] == nil || args[0] == "", nil
+		}},
+		"coalesce": {minArgs: 1, maxArgs: -1, call: func(call *callNode, env *exprEnv,
+			args []interface{}) (interface{}, error) {
+			for _, arg := range args {
+				if arg != nil {
+					return arg, nil
+				}
+			}
+			return nil, nil
+		}},
+		"str": {minArgs: 1, maxArgs: 1, call: func(call *callNode, env *exprEnv, args []interface{}) (interface{}, error) {
+			if args[0] == nil {
+				return nil, nil
+			}
+			return exprString(args[0]), nil
+		}},
+		"num": {minArgs: 1, maxArgs: 1, call: func(call *callNode, env *exprEnv, args []interface{}) (interface{}, error) {
+			if args[0] == nil {
+				return nil, nil
+			}
+			return exprNumber(args[0])
+		}},
+	}
+}
+
+// newHash returns the hash for the algorithm name, or nil if it is not supported.
+func newHash(algorithm string) hash.Hash {
+	switch strings.ToLower(algorithm) {
+	case "sha256":
+		return sha256.New()
+	case "sha1":
+		return sha1.New()
+	case "md5":
+		return md5.New()
+	}
+	return nil
+}
+
+// Values
+
+// exprString converts a value to its text form.
+func exprString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	return fmt.Sprint(value)
+}
+
+// exprNumber converts a value to a number.
+func exprNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return number, nil
+	}
+	return 0, errors.New("null is not a number")
+}
+
+// exprInt converts a value to an integer.
+func exprInt(value interface{}) (int, error) {
+	number, err := exprNumber(value)
+	return int(number), err
+}
+
+// exprTruthy returns false for false, null, "", and 0.
+func exprTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	}
+	return true
+}
+
+// exprEqual compares two values. Numbers and numeric strings are compared as numbers.
+func exprEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if cmp, err := exprCompare(a, b); err == nil {
+		return cmp == 0
+	}
+	return exprString(a) == exprString(b)
+}
+
+// exprCompare orders two values. Values are compared as numbers if either of them is a number.
+func exprCompare(a, b interface{}) (int, error) {
+	_, aIsNumber := a.(float64)
+	_, bIsNumber := b.(float64)
+	if aIsNumber || bIsNumber {
+		x, err := exprNumber(a)
+		if err != nil {
+			return 0, err
+		}
+		y, err := exprNumber(b)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	if a == nil || b == nil {
+		return 0, errors.New("null can not be compared")
+	}
+	return strings.Compare(exprString(a), exprString(b)), nil
+}
+
+// clampInt limits value to [min, max].
+func clampInt(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
@@ -0,0 +1,153 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// evalExpression compiles and evaluates an expression for a nullable column.
+func evalExpression(t *testing.T, expression, input string, row map[string]string) (string, error) {
+	rowFunc, err := newExpression(ProcessorDefinition{Params: map[string]interface{}{"Expression": expression}})
+	require.Nil(t, err, expression)
+	return rowFunc(&ColumnMapper{IsNullable: true}, input, row)
+}
+
+func TestCompileExpression(t *testing.T) {
+	valid := []string{
+		`input`,
+		`lower(input) + "@example.com"`,
+		`row.first_name + ' ' + row["last name"]`,
+		`empty(input) ? null : hash(input, "md5")`,
+		`!(len(input) > 3 && match(input, "^[0-9]+$")) || -1 < 0`,
+		`replace(input, "[0-9]", "#")`,
+		`fake("FirstName")`,
+	}
+	for _, expression := range valid {
+		_, err := compileExpression(expression)
+		require.Nil(t, err, expression)
+	}
+
+	invalid := []string{
+		``,
+		`input +`,
+		`lower(input`,
+		`"unterminated`,
+		`unknown`,
+		`nope(input)`,
+		`upper()`,
+		`row.`,
+		`row[1]`,
+		`match(input, "[a-")`,
+		`match(input, row.pattern)`,
+		`hash(input, "crc32")`,
+		`fake("Unicorn")`,
+		`input ? "a"`,
+		`input # 1`,
+		`1 2`,
+	}
+	for _, expression := range invalid {
+		_, err := compileExpression(expression)
+		require.NotNil(t, err, expression)
+	}
+}
+
+func TestProcessorExpression(t *testing.T) {
+	row := map[string]string{"first_name": "Ada", "last name": "Lovelace", "age": "36", "middle": copyNull}
+
+	cases := []struct {
+		expression, input, output string
+	}{
+		{`lower(input) + "@example.com"`, "Ada.L", "ada.l@example.com"},
+		{`upper(row.first_name) + " " + row["last name"]`, "x", "ADA Lovelace"},
+		{`substr(input, 0, 1) + "***"`, "secret", "s***"},
+		{`substr(input, 2)`, "secret", "cret"},
+		{`substr(input, 10, 2)`, "secret", ""},
+		{`mask(input, 2, 2)`, "4111111111111111", "41************11"},
+		{`mask(input, 0, 4, "#")`, "123456", "##3456"},
+		{`hash(input)`, "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`hash(input, "md5")`, "abc", "900150983cd24fb0d6963f7d28e17f72"},
+		{`replace(input, "[0-9]", "#")`, "a1b22", "a#b##"},
+		{`match(input, "^[0-9]+$") ? "digits" : "other"`, "123", "digits"},
+		{`num(row.age) + 1`, "x", "37"},
+		{`row.age + 1`, "x", "361"},
+		{`10 / 4 * 2 - 7 % 4`, "x", "2"},
+		{`len(input) >= 3 && !empty(input)`, "héé", "true"},
+		{`coalesce(row.middle, row.first_name)`, "x", "Ada"},
+		{`row.middle == null ? "none" : row.middle`, "x", "none"},
+		{`row.age == 36`, "x", "true"},
+		{`trim(input) + '\t'`, "  a  ", "a\\t"},
+		{`input`, "tab\\there", "tab\\there"},
+	}
+	for _, c := range cases {
+		output, err := evalExpression(t, c.expression, c.input, row)
+		require.Nil(t, err, c.expression)
+		require.Equal(t, c.output, output, c.expression)
+	}
+
+	output, err := evalExpression(t, `empty(input) ? null : input`, "", row)
+	require.Nil(t, err)
+	require.Equal(t, copyNull, output)
+
+	output, err = evalExpression(t, `fake("FirstName")`, "Ada", row)
+	require.Nil(t, err)
+	require.NotEmpty(t, output)
+
+	_, err = evalExpression(t, `row.unknown`, "x", row)
+	require.NotNil(t, err)
+	_, err = evalExpression(t, `row.first_name`, "x", nil)
+	require.NotNil(t, err)
+	_, err = evalExpression(t, `1 / 0`, "x", row)
+	require.NotNil(t, err)
+	_, err = evalExpression(t, `num(input)`, "abc", row)
+	require.NotNil(t, err)
+
+	// null is an error for columns that are not nullable
+	cmap := ColumnMapper{
+		ColumnName: "code",
+		Processors: []ProcessorDefinition{{Name: "Expression", Params: map[string]interface{}{"Expression": "null"}}},
+	}
+	_, err = ProcessorExpression(&cmap, "x")
+	require.NotNil(t, err)
+
+	cmap.Processors = []ProcessorDefinition{
+		{Name: "Expression", Params: map[string]interface{}{"Expression": `upper(input)`}},
+	}
+	output, err = ProcessorExpression(&cmap, "abc")
+	require.Nil(t, err)
+	require.Equal(t, "ABC", output)
+
+	require.NotNil(t, validateProcessorDefinition(ProcessorDefinition{Name: "Expression"}))
+	require.NotNil(t, validateProcessorDefinition(ProcessorDefinition{
+		Name:   "Expression",
+		Params: map[string]interface{}{"Expression": "lower(input"},
+	}))
+}
+
+func TestExpressionRows(t *testing.T) {
+	cmaps := []*ColumnMapper{
+		nil,
+		{
+			ColumnName: "email",
+			Processors: []ProcessorDefinition{{
+				Name:   "Expression",
+				Params: map[string]interface{}{"Expression": `lower(row.first_name) + "@example.com"`},
+			}},
+		},
+		{
+			ColumnName: "first_name",
+			Processors: []ProcessorDefinition{{Name: "Expression", Params: map[string]interface{}{"Expression": `"X"`}}},
+		},
+	}
+	require.Nil(t, constructProcessors(cmaps[1].Processors))
+	require.True(t, readsRow(cmaps[1]))
+	require.False(t, readsRow(&ColumnMapper{Processors: []ProcessorDefinition{{Name: "Identity"}}}))
+
+	// the row contains the original values, even of columns that were processed before
+	chunk := Chunk{ColumnNames: []string{"id", "email", "\"first_name\""}}
+	outputs := processRowsFromChunk(cmaps, []string{"1\ta@b.c\tAda\n", "2\t\\N\tBob\n"}, chunk)
+	require.Equal(t, []string{"1\tada@example.com\tX\n", "2\t\\N\tX\n"}, outputs)
+
+	require.Equal(t, map[string]string{"id": "1", "first_name": "Ada"},
+		rowValues([]string{"id", "\"first_name\""}, []string{"1", "Ada\n"}))
+}
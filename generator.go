@@ -30,11 +30,12 @@ const (
 
 // LineState contains all the required information for parsing a line in the SQL dump file.
 type LineState struct {
-	LineNum     int64
-	IsRow       bool
-	SchemaName  string
-	TableName   string
-	ColumnNames []string
+	LineNum      int64
+	IsRow        bool
+	SchemaName   string
+	TableName    string
+	ColumnNames  []string
+	LargeObjects string
 }
 
 // Clear will clear out all known line stat for the current LineState object.
@@ -113,6 +114,14 @@ func ProcessDumpFile(config ProcessConfig) error {
 		return err2
 	}
 
+	config.resolveChaining()
+	resetErrorPolicySummary()
+	defer logErrorPolicySummary()
+
+	// Plugins are started once and stopped when processing is done
+	SetPluginWorkers(1)
+	defer ClosePlugins()
+
 	srcFile, err := os.Open(config.SourceFilename)
 	if err != nil {
 		log.Error(err)
@@ -122,7 +131,8 @@ func ProcessDumpFile(config ProcessConfig) error {
 	}
 	defer srcFile.Close()
 
-	fileReader := bufio.NewReader(srcFile)
+	// rows the map's Tables do not keep are dropped before they are processed
+	fileReader := bufio.NewReader(filterTables(config.DBMapper, srcFile))
 
 	dstFile, err := os.Create(config.DestinationFilename)
 	if err != nil {
@@ -149,6 +159,7 @@ func ProcessDumpFile(config ProcessConfig) error {
 
 	allDone := false
 	state := new(LineState)
+	state.LargeObjects = config.LargeObjects
 
 	for {
 		lineCount++
@@ -286,10 +297,16 @@ func processLine(mapper *DBMapper, state *LineState, inputLine string) (*LineSta
 	}
 
 	if state.IsRow {
+		if isLargeObjectTable(state.SchemaName, state.TableName) && state.LargeObjects != LargeObjectsKeep &&
+			state.LargeObjects != "" {
+			outputLine, err := processLargeObjectRow(state.LargeObjects, state.ColumnNames, inputLine)
+			return state, outputLine, err
+		}
 		return processRow(mapper, state, inputLine)
 	}
 
-	return state, outputLine, nil
+	outputLine, _, err := processLargeObjectWrite(state.LargeObjects, inputLine)
+	return state, outputLine, err
 }
 
 // processRow will process the line in the dump file IFF it is a SQL-line (eventual row in the database after import).
@@ -298,6 +315,9 @@ func processRow(mapper *DBMapper, state *LineState, inputLine string) (*LineStat
 	rowVals := strings.Split(inputLine, "\t")
 	outputVals := make([]string, 0, len(rowVals))
 
+	// original values of the row, only built when a processor reads other columns
+	var row map[string]string
+
 	for i, columnName := range state.ColumnNames {
 		var (
 			err        error
@@ -324,10 +344,13 @@ func processRow(mapper *DBMapper, state *LineState, inputLine string) (*LineStat
 		}
 
 		// If column value is nil or if this column is not mapped, keep the value and continue on
-		if val == "\\N" || cmap == nil {
+		if cmap == nil || (val == copyNull && !cmap.ProcessNulls) {
 			output = val
 		} else {
-			output, err = processValue(cmap, val)
+			if row == nil && readsRow(cmap) {
+				row = rowValues(state.ColumnNames, rowVals)
+			}
+			output, err = processValueInRow(cmap, val, row)
 			if err != nil {
 				log.Error(err)
 				log.Debug("i: ", i)
@@ -349,52 +372,227 @@ func processRow(mapper *DBMapper, state *LineState, inputLine string) (*LineStat
 
 // processValue will anonymize or ignore the current value for a given column in the dump file
 func processValue(cmap *ColumnMapper, input string) (string, error) {
-	var err error
+	outputs, err := processValues(cmap, []string{input})
+	if err != nil {
+		return "", err
+	}
+	return outputs[0], nil
+}
+
+// processValueInRow is processValue for a value that belongs to a row. See processValuesInRows.
+func processValueInRow(cmap *ColumnMapper, input string, row map[string]string) (string, error) {
+	outputs, err := processValuesInRows(cmap, []string{input}, []map[string]string{row})
+	if err != nil {
+		return "", err
+	}
+	return outputs[0], nil
+}
+
+// readsRow returns true if any processor of the column reads the other columns of the row.
+func readsRow(cmap *ColumnMapper) bool {
+	for _, procDef := range cmap.Processors {
+		if procDef.row != nil {
+			return true
+		}
+		if info, ok := LookupProcessor(procDef.Name); ok && info.NewRow != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// rowValues maps the column names of a row to their raw values, without the escape character that ends the last one.
+func rowValues(columnNames, rawValues []string) map[string]string {
+	row := make(map[string]string, len(columnNames))
+	for i, columnName := range columnNames {
+		if i < len(rawValues) {
+			value, _ := trimRawValue(rawValues[i])
+			row[strings.Replace(columnName, "\"", "", -1)] = value
+		}
+	}
+	return row
+}
+
+// processValues will anonymize or ignore many values of the same column. Each processor is applied to the output of
+// the previous one. Processors that support batches, such as plugins, are called once for all of the values.
+func processValues(cmap *ColumnMapper, inputs []string) ([]string, error) {
+	return processValuesInRows(cmap, inputs, nil)
+}
 
-	output := input
+// processValuesInRows is processValues for values that belong to rows. rows contains the original values of each
+// input's row by column name and is passed to processors that read other columns, such as Expression. rows may be nil.
+func processValuesInRows(cmap *ColumnMapper, inputs []string, rows []map[string]string) ([]string, error) {
+	outputs := make([]string, len(inputs))
+	copy(outputs, inputs)
+
+	// Each processor consumes the output of the previous one. Values that are done, because they matched a ShortCircuit
+	// exemption or became NULL, skip the remaining processors.
+	done := make([]bool, len(inputs))
+	stepInput := func(j int) string {
+		if cmap.legacyChaining {
+			return inputs[j]
+		}
+		return outputs[j]
+	}
+	rowAt := func(j int) map[string]string {
+		if rows == nil {
+			return nil
+		}
+		return rows[j]
+	}
+
+	// a fraction of the values is replaced with NULL instead of being processed, see NullRate
+	for j := range inputs {
+		if injectNull(cmap) {
+			outputs[j] = copyNull
+			done[j] = true
+		}
+	}
 
 	for i, procDef := range cmap.Processors {
 
-		pfunc := ProcessorCatalog[procDef.Name]
+		// Processors are constructed when the map file is loaded. Maps built in code are constructed here, and fall back
+		// to the catalog for processors that are not registered.
+		if info, ok := LookupProcessor(procDef.Name); ok && procDef.pfunc == nil {
+			var err error
+			if procDef, err = constructDefinition(&cmap.Processors[i], procDef, info.New); err != nil {
+				log.Error(err)
+				return nil, err
+			}
+		}
+		pfunc := procDef.pfunc
+		if pfunc == nil {
+			pfunc = ProcessorCatalog[procDef.Name]
+		}
 
 		if pfunc == nil {
+			err := fmt.Errorf("Unknown Processor Name: %s", procDef.Name)
 			log.Error(err)
-			log.Error("Unknown Processor Name: ", procDef.Name)
 			log.Debug("i: ", i)
 			log.Debug("procDef: ", procDef)
 			log.Debug("cmap: ", cmap)
-			log.Debug("input: ", input)
-			return "", err
-
+			return nil, err
 		}
 
-		if procDef.Exemptions != "" {
-			expression, err := regexp.Compile(procDef.Exemptions)
+		expression := procDef.exemptions
+		if expression == nil && procDef.Exemptions != "" {
+			var err error
+			expression, err = regexp.Compile(procDef.Exemptions)
 			if err != nil {
 				log.Error(err)
 				log.Error("Invalid Exemptions expression: ", procDef.Name)
 				log.Debug("i: ", i)
 				log.Debug("cmap: ", cmap)
-				log.Debug("input: ", input)
-				return "", err
+				return nil, err
 			}
+		}
 
-			if expression.MatchString(input) {
-				return input, nil
+		pending := make([]int, 0, len(inputs))
+		for j := range inputs {
+			if done[j] {
+				continue
+			}
+			if expression != nil && expression.MatchString(stepInput(j)) {
+				if cmap.legacyChaining {
+					outputs[j] = inputs[j]
+					done[j] = true
+				} else if procDef.ShortCircuit {
+					done[j] = true
+				}
+				continue
 			}
+			pending = append(pending, j)
+		}
+		if len(pending) == 0 {
+			continue
 		}
 
-		output, err = pfunc(cmap, input)
+		if procDef.batch != nil {
+			batchInputs := make([]string, len(pending))
+			for k, j := range pending {
+				batchInputs[k] = stepInput(j)
+			}
+			batchOutputs, batchErr := procDef.batch(cmap, batchInputs)
+			if batchErr == nil && len(batchOutputs) != len(batchInputs) {
+				batchErr = fmt.Errorf("Processor %s returned %d values for %d inputs", procDef.Name, len(batchOutputs),
+					len(batchInputs))
+			}
+			for k, j := range pending {
+				output := ""
+				if batchErr != nil {
+					// the whole batch failed so the error policy is applied to each of its values
+					var err error
+					if output, err = applyErrorPolicy(cmap, procDef, stepInput(j), rowAt(j), batchErr); err != nil {
+						log.Error(err)
+						log.Debug("i: ", i)
+						log.Debug("cmap: ", cmap)
+						return nil, err
+					}
+				} else {
+					output = batchOutputs[k]
+				}
+				outputs[j] = output
+				done[j] = output == copyNull && !cmap.legacyChaining
+			}
+			continue
+		}
 
+		rowFunc := procDef.row
+		for _, j := range pending {
+			var (
+				output string
+				err    error
+			)
+			if rowFunc != nil {
+				output, err = rowFunc(cmap, stepInput(j), rowAt(j))
+			} else {
+				output, err = pfunc(cmap, stepInput(j))
+			}
+			if err != nil {
+				output, err = applyErrorPolicy(cmap, procDef, stepInput(j), rowAt(j), err)
+			}
+			if err != nil {
+				log.Error(err)
+				log.Debug("i: ", i)
+				log.Debug("cmap: ", cmap)
+				log.Debug("input: ", stepInput(j))
+				return nil, err
+			}
+			outputs[j] = output
+			done[j] = output == copyNull && !cmap.legacyChaining
+		}
+	}
+
+	// outputs that do not fit the column are handled by the error policy of the last processor
+	if len(cmap.Processors) == 0 {
+		return outputs, nil
+	}
+	last := cmap.Processors[len(cmap.Processors)-1]
+	for j, output := range outputs {
+		if output == inputs[j] {
+			continue
+		}
+		err := checkOutputType(cmap, output)
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("Output of %s.%s.%s does not fit %s: %s", cmap.TableSchema, cmap.TableName, cmap.ColumnName,
+			cmap.DataType, err)
+		if output, err = applyErrorPolicy(cmap, last, inputs[j], rowAt(j), err); err == nil {
+			if err = checkOutputType(cmap, output); err != nil {
+				err = fmt.Errorf("OnError output of %s.%s.%s does not fit %s: %s", cmap.TableSchema, cmap.TableName,
+					cmap.ColumnName, cmap.DataType, err)
+			}
+		}
 		if err != nil {
 			log.Error(err)
-			log.Debug("i: ", i)
 			log.Debug("cmap: ", cmap)
-			log.Debug("input: ", input)
-			return "", err
+			log.Debug("input: ", inputs[j])
+			return nil, err
 		}
+		outputs[j] = output
 	}
-	return output, nil
+	return outputs, nil
 }
 
 // parseCopyLine will parse the /copy line in a PostgreSQL dump file
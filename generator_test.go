@@ -83,6 +83,69 @@ func TestGenerateRandomInt64(t *testing.T) {
 	require.IsType(t, test, num)
 }
 
+// expressionStep is an Expression ProcessorDefinition.
+func expressionStep(expression string) ProcessorDefinition {
+	return ProcessorDefinition{Name: "Expression", Params: map[string]interface{}{"Expression": expression}}
+}
+
+func TestProcessValueChaining(t *testing.T) {
+	exempt := expressionStep(`"x" + input`)
+	exempt.Exemptions = "^skip"
+	shortCircuit := exempt
+	shortCircuit.ShortCircuit = true
+	exemptUpper := expressionStep(`"lower"`)
+	exemptUpper.Exemptions = "^[A-Z]+$"
+
+	cases := []struct {
+		processors []ProcessorDefinition
+		legacy     bool
+		input      string
+		output     string
+	}{
+		{[]ProcessorDefinition{expressionStep(`upper(input)`), expressionStep(`input + "!"`)}, false, "abc", "ABC!"},
+		{[]ProcessorDefinition{exempt, expressionStep(`input + "!"`)}, false, "skip", "skip!"},
+		{[]ProcessorDefinition{exempt, expressionStep(`input + "!"`)}, false, "abc", "xabc!"},
+		{[]ProcessorDefinition{shortCircuit, expressionStep(`input + "!"`)}, false, "skip", "skip"},
+		{[]ProcessorDefinition{expressionStep(`upper(input)`), exemptUpper}, false, "abc", "ABC"},
+		{[]ProcessorDefinition{expressionStep(`null`), expressionStep(`"x"`)}, false, "abc", copyNull},
+		{[]ProcessorDefinition{expressionStep(`upper(input)`), expressionStep(`input + "!"`)}, true, "abc", "abc!"},
+		{[]ProcessorDefinition{expressionStep(`upper(input)`), exempt}, true, "skip", "skip"},
+	}
+	for i, c := range cases {
+		cmap := ColumnMapper{ColumnName: "name", IsNullable: true, Processors: c.processors, legacyChaining: c.legacy}
+		require.Nil(t, constructProcessors(cmap.Processors), i)
+		output, err := processValue(&cmap, c.input)
+		require.Nil(t, err, i)
+		require.Equal(t, c.output, output, i)
+	}
+
+	// the sequential and concurrent paths give the same output
+	dbMap := DBMapper{ColumnMaps: []ColumnMapper{{
+		TableSchema: "public",
+		TableName:   "people",
+		ColumnName:  "name",
+		Processors:  []ProcessorDefinition{exempt, expressionStep(`upper(input)`)},
+	}}}
+	require.Nil(t, constructProcessors(dbMap.ColumnMaps[0].Processors))
+	state := LineState{SchemaName: "public", TableName: "people", ColumnNames: []string{"id", "name"}}
+	cmaps := []*ColumnMapper{nil, &dbMap.ColumnMaps[0]}
+	for _, line := range []string{"1\tskip\n", "2\tabc\n"} {
+		_, sequential, err := processRow(&dbMap, &state, line)
+		require.Nil(t, err)
+		concurrent := processRowsFromChunk(cmaps, []string{line}, Chunk{ColumnNames: state.ColumnNames})
+		require.Equal(t, []string{sequential}, concurrent)
+	}
+	_, output, err := processRow(&dbMap, &state, "2\tabc\n")
+	require.Nil(t, err)
+	require.Equal(t, "2\tXABC\n", output)
+
+	config := ProcessConfig{DBMapper: &dbMap, LegacyChaining: true}
+	config.resolveChaining()
+	require.True(t, dbMap.ColumnMaps[0].legacyChaining)
+
+	require.NotNil(t, validateProcessorDefinition(ProcessorDefinition{Name: "Identity", ShortCircuit: true}))
+}
+
 func TestGenerateSchemaSql(t *testing.T) {
 
 	conf := GetTestDbConf(TestDb)
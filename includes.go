@@ -0,0 +1,282 @@
+package gonymizer
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Map files can be split into fragments, I.E. one per team or schema, with Includes. The fragments are merged into the
+// map that includes them: their columns, rules and tables are added to the map, in the order they are included. A
+// column, rule or table that is in more than one fragment with different settings is a conflict, as are settings like
+// Seed or Locale that are set to different values, and the map is not loaded.
+//
+// Overlays change a map for an environment, I.E. staging or demo, and are applied after the fragments are merged:
+//
+//  1. an entry of ColumnMaps replaces the processors and other settings of the column, or is added if it is new
+//  2. a rule replaces the rule with the same Name, or is tried before the rules of the map with the same Priority
+//  3. Seed and Locale replace the ones of the map when they are set, and an entry of Tables replaces the one of the
+//     map for the table, I.E. to keep fewer rows
+//  4. a Subset replaces the one of the map
+
+// mapFragment is a map file read by ResolveConfigSkeleton.
+type mapFragment struct {
+	path  string
+	dbmap *DBMapper
+}
+
+// ResolveConfigSkeleton reads a map file with the fragments it includes and applies the overlay files to it, in order.
+// The resolved map has no Includes and is not validated, see LoadConfigSkeleton.
+func ResolveConfigSkeleton(givenPathToFile string, overlays ...string) (*DBMapper, error) {
+	var fragments []mapFragment
+	if err := readFragments(givenPathToFile, nil, &fragments); err != nil {
+		return nil, err
+	}
+	dbmap, err := mergeFragments(fragments)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, overlayPath := range overlays {
+		overlay, err := ReadConfigSkeleton(overlayPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(overlay.Includes) > 0 {
+			return nil, fmt.Errorf("Overlay %s: Includes are only supported in map files", overlayPath)
+		}
+		ApplyOverlay(dbmap, overlay)
+	}
+	return dbmap, nil
+}
+
+// readFragments reads a map file and the files it includes, depth first. Paths of Includes are relative to the file
+// that includes them. A file that is included more than once is read once.
+func readFragments(path string, including []string, fragments *[]mapFragment) error {
+	path = filepath.Clean(path)
+	for i, parent := range including {
+		if parent == path {
+			return fmt.Errorf("Map file %s includes itself: %s", path,
+				strings.Join(append(including[i:], path), " -> "))
+		}
+	}
+	for _, fragment := range *fragments {
+		if fragment.path == path {
+			return nil
+		}
+	}
+
+	dbmap, err := ReadConfigSkeleton(path)
+	if err != nil {
+		return err
+	}
+	*fragments = append(*fragments, mapFragment{path: path, dbmap: dbmap})
+
+	for _, include := range dbmap.Includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		if err = readFragments(include, append(including, path), fragments); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeFragments merges the fragments into the first one and returns every conflict between them at once.
+func mergeFragments(fragments []mapFragment) (*DBMapper, error) {
+	merged := *fragments[0].dbmap
+	merged.Includes = nil
+	merged.ColumnMaps = nil
+	merged.Rules = nil
+	merged.Tables = nil
+	merged.Subset = nil
+
+	var conflicts []string
+	conflict := func(format string, args ...interface{}) {
+		conflicts = append(conflicts, fmt.Sprintf(format, args...))
+	}
+	// settings that are zero are not set. The first file that sets a setting owns it, the others can only set it to
+	// the same value. setting returns true if the value of the file is to be adopted
+	settingOwners := make(map[string]string)
+	setting := func(name string, value, fragmentValue interface{}, path string) bool {
+		owner, ok := settingOwners[name]
+		if !ok {
+			settingOwners[name] = path
+			return true
+		}
+		if !reflect.DeepEqual(value, fragmentValue) {
+			conflict("%s is %v in %s but %v in %s", name, value, owner, fragmentValue, path)
+		}
+		return false
+	}
+
+	columns := make(map[string]int)
+	owners := make(map[string]string)
+	rules := make(map[string]string)
+	tables := make(map[string]string)
+	roots := make(map[string]string)
+	for _, fragment := range fragments {
+		dbmap := fragment.dbmap
+		if dbmap.DBName != "" && setting("DBName", merged.DBName, dbmap.DBName, fragment.path) {
+			merged.DBName = dbmap.DBName
+		}
+		if dbmap.SchemaPrefix != "" && setting("SchemaPrefix", merged.SchemaPrefix, dbmap.SchemaPrefix, fragment.path) {
+			merged.SchemaPrefix = dbmap.SchemaPrefix
+		}
+		if dbmap.Seed != 0 && setting("Seed", merged.Seed, dbmap.Seed, fragment.path) {
+			merged.Seed = dbmap.Seed
+		}
+		if dbmap.Locale != "" && setting("Locale", merged.Locale, dbmap.Locale, fragment.path) {
+			merged.Locale = dbmap.Locale
+		}
+		if dbmap.LegacyChaining && setting("LegacyChaining", merged.LegacyChaining, dbmap.LegacyChaining, fragment.path) {
+			merged.LegacyChaining = dbmap.LegacyChaining
+		}
+
+		for _, col := range dbmap.ColumnMaps {
+			key := columnKey(col)
+			if j, ok := columns[key]; ok {
+				if !reflect.DeepEqual(merged.ColumnMaps[j], col) {
+					conflict("%s is in %s and %s with different settings", key, owners[key], fragment.path)
+				}
+				continue
+			}
+			columns[key] = len(merged.ColumnMaps)
+			owners[key] = fragment.path
+			merged.ColumnMaps = append(merged.ColumnMaps, col)
+		}
+
+		for _, rule := range dbmap.Rules {
+			if rule.Name != "" {
+				if owner, ok := rules[rule.Name]; ok {
+					if !reflect.DeepEqual(merged.Rules[ruleNamed(merged.Rules, rule.Name)], rule) {
+						conflict("Rule %s is in %s and %s with different settings", rule.Name, owner, fragment.path)
+					}
+					continue
+				}
+				rules[rule.Name] = fragment.path
+			}
+			merged.Rules = append(merged.Rules, rule)
+		}
+
+		for _, table := range dbmap.Tables {
+			key := table.TableSchema + "." + table.TableName
+			if owner, ok := tables[key]; ok {
+				for _, existing := range merged.Tables {
+					if existing.TableSchema+"."+existing.TableName == key && existing != table {
+						conflict("Table %s is in %s and %s with different settings", key, owner, fragment.path)
+					}
+				}
+				continue
+			}
+			tables[key] = fragment.path
+			merged.Tables = append(merged.Tables, table)
+		}
+
+		for _, root := range dbmap.Subset {
+			key := root.TableSchema + "." + root.TableName
+			if owner, ok := roots[key]; ok {
+				for _, existing := range merged.Subset {
+					if existing.TableSchema+"."+existing.TableName == key && !reflect.DeepEqual(existing, root) {
+						conflict("Subset root %s is in %s and %s with different settings", key, owner, fragment.path)
+					}
+				}
+				continue
+			}
+			roots[key] = fragment.path
+			merged.Subset = append(merged.Subset, root)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("Found %d conflicts between map files:\n%s", len(conflicts),
+			strings.Join(conflicts, "\n"))
+	}
+	return &merged, nil
+}
+
+// ruleNamed returns the index of the rule with a name, or -1 if there is none.
+func ruleNamed(rules []ColumnRule, name string) int {
+	for i, rule := range rules {
+		if rule.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ApplyOverlay changes a map with the columns, rules and settings of an overlay, I.E. to use other processors in a
+// staging environment.
+func ApplyOverlay(dbMap *DBMapper, overlay *DBMapper) {
+	if overlay.Seed != 0 {
+		dbMap.Seed = overlay.Seed
+	}
+	if overlay.Locale != "" {
+		dbMap.Locale = overlay.Locale
+	}
+	if len(overlay.Subset) > 0 {
+		dbMap.Subset = overlay.Subset
+	}
+
+	for _, table := range overlay.Tables {
+		replaced := false
+		for i, existing := range dbMap.Tables {
+			if existing.TableSchema == table.TableSchema && existing.TableName == table.TableName {
+				dbMap.Tables[i] = table
+				replaced = true
+			}
+		}
+		if !replaced {
+			dbMap.Tables = append(dbMap.Tables, table)
+		}
+	}
+
+	for _, col := range overlay.ColumnMaps {
+		existing := -1
+		for i := range dbMap.ColumnMaps {
+			if columnKey(dbMap.ColumnMaps[i]) == columnKey(col) {
+				existing = i
+				break
+			}
+		}
+		if existing < 0 {
+			dbMap.ColumnMaps = append(dbMap.ColumnMaps, col)
+			continue
+		}
+		overlayColumn(&dbMap.ColumnMaps[existing], col)
+	}
+
+	var added []ColumnRule
+	for _, rule := range overlay.Rules {
+		if i := ruleNamed(dbMap.Rules, rule.Name); rule.Name != "" && i >= 0 {
+			dbMap.Rules[i] = rule
+			continue
+		}
+		added = append(added, rule)
+	}
+	dbMap.Rules = append(added, dbMap.Rules...)
+}
+
+// overlayColumn replaces the settings of a column with the ones of an overlay. The data type and other details of the
+// column from the database are kept unless the overlay has them.
+func overlayColumn(cmap *ColumnMapper, overlay ColumnMapper) {
+	cmap.Processors = overlay.Processors
+	cmap.OnError = overlay.OnError
+	cmap.NullRate = overlay.NullRate
+	cmap.ProcessNulls = overlay.ProcessNulls
+	if overlay.Comment != "" {
+		cmap.Comment = overlay.Comment
+	}
+	if overlay.DataType != "" {
+		cmap.DataType = overlay.DataType
+	}
+	if overlay.ParentTable != "" {
+		cmap.ParentSchema = overlay.ParentSchema
+		cmap.ParentTable = overlay.ParentTable
+		cmap.ParentColumn = overlay.ParentColumn
+		cmap.ForeignKeyColumns = overlay.ForeignKeyColumns
+		cmap.ParentColumns = overlay.ParentColumns
+	}
+}
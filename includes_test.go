@@ -0,0 +1,129 @@
+package gonymizer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeMapFiles writes map files to a temporary directory and returns its path.
+func writeMapFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "gonymizer-includes")
+	require.Nil(t, err)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestResolveConfigSkeleton(t *testing.T) {
+	dir := writeMapFiles(t, map[string]string{
+		"map.yaml": `DBName: test
+Seed: 42
+Includes: [teams/billing.yaml, teams/users.json]
+ColumnMaps:
+  - {TableSchema: public, TableName: users, ColumnName: id, DataType: integer, Processors: [{Name: Identity}]}
+`,
+		"teams/billing.yaml": `Includes: [../shared.yaml]
+ColumnMaps:
+  - {TableSchema: billing, TableName: cards, ColumnName: number, DataType: text, Processors: [{Name: ScrubString}]}
+`,
+		"teams/users.json": `{"Seed": 42, "Includes": ["../shared.yaml"], "ColumnMaps": [
+	{"TableSchema": "public", "TableName": "users", "ColumnName": "email", "DataType": "text",
+		"Processors": [{"Name": "FakeEmailAddress"}]}]}`,
+		"shared.yaml": `Rules:
+  - {Name: phones, ColumnName: "*phone*", Processors: [{Name: FakePhoneNumber}]}
+ColumnMaps:
+  - {TableSchema: public, TableName: users, ColumnName: id, DataType: integer, Processors: [{Name: Identity}]}
+`,
+		"staging.yaml": `Seed: 7
+Rules:
+  - {Name: phones, ColumnName: "*phone*", Processors: [{Name: Identity}]}
+  - {Name: names, ColumnName: "*name*", Processors: [{Name: FakeFirstName}]}
+ColumnMaps:
+  - {TableSchema: public, TableName: users, ColumnName: email, Processors: [{Name: Identity}]}
+  - {TableSchema: public, TableName: users, ColumnName: city, DataType: text, Processors: [{Name: FakeCity}]}
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	dbMap, err := ResolveConfigSkeleton(filepath.Join(dir, "map.yaml"))
+	require.Nil(t, err)
+	require.Nil(t, dbMap.Includes)
+	require.Equal(t, int64(42), dbMap.Seed)
+	require.Len(t, dbMap.Rules, 1)
+	require.Equal(t, []string{"public.users.id", "billing.cards.number", "public.users.email"},
+		[]string{columnKey(dbMap.ColumnMaps[0]), columnKey(dbMap.ColumnMaps[1]), columnKey(dbMap.ColumnMaps[2])})
+	require.Nil(t, dbMap.Validate())
+
+	dbMap, err = LoadConfigSkeleton(filepath.Join(dir, "map.yaml"), filepath.Join(dir, "staging.yaml"))
+	require.Nil(t, err)
+	require.Equal(t, int64(7), dbMap.Seed)
+	require.Equal(t, []string{"names", "phones"}, []string{dbMap.Rules[0].Name, dbMap.Rules[1].Name})
+	require.Equal(t, "Identity", dbMap.Rules[1].Processors[0].Name)
+	require.Len(t, dbMap.ColumnMaps, 4)
+
+	// the overlay changes the processors, the column keeps its data type
+	email := dbMap.ColumnMapper("public", "users", "email")
+	require.Equal(t, "Identity", email.Processors[0].Name)
+	require.Equal(t, "text", email.DataType)
+	require.Equal(t, "FakeCity", dbMap.ColumnMapper("public", "users", "city").Processors[0].Name)
+}
+
+func TestResolveConfigSkeletonSettings(t *testing.T) {
+	dir := writeMapFiles(t, map[string]string{
+		"map.json":   `{"DBName": "test", "Includes": ["a.json", "b.json"]}`,
+		"a.json":     `{"Seed": 5, "Locale": "de"}`,
+		"b.json":     `{"Seed": 5}`,
+		"other.json": `{"DBName": "test", "Includes": ["a.json", "c.json"]}`,
+		"c.json":     `{"Seed": 6}`,
+	})
+	defer os.RemoveAll(dir)
+
+	// settings the root file leaves unset are taken from the first file that sets them
+	dbMap, err := ResolveConfigSkeleton(filepath.Join(dir, "map.json"))
+	require.Nil(t, err)
+	require.Equal(t, int64(5), dbMap.Seed)
+	require.Equal(t, "de", dbMap.Locale)
+
+	_, err = ResolveConfigSkeleton(filepath.Join(dir, "other.json"))
+	require.EqualError(t, err, "Found 1 conflicts between map files:\n"+
+		"Seed is 5 in "+filepath.Join(dir, "a.json")+" but 6 in "+filepath.Join(dir, "c.json"))
+}
+
+func TestResolveConfigSkeletonConflicts(t *testing.T) {
+	dir := writeMapFiles(t, map[string]string{
+		"map.json": `{"DBName": "test", "Seed": 1, "Includes": ["a.json", "b.json"]}`,
+		"a.json": `{"Seed": 2, "Rules": [{"Name": "emails", "ColumnName": "email",
+			"Processors": [{"Name": "FakeEmailAddress"}]}],
+			"ColumnMaps": [{"TableSchema": "public", "TableName": "users", "ColumnName": "ssn",
+			"Processors": [{"Name": "RandomDigits"}]}]}`,
+		"b.json": `{"Rules": [{"Name": "emails", "ColumnName": "email", "Processors": [{"Name": "Identity"}]}],
+			"ColumnMaps": [{"TableSchema": "public", "TableName": "users", "ColumnName": "ssn",
+			"Processors": [{"Name": "Identity"}]}]}`,
+		"loop.json":  `{"Includes": ["loop2.json"]}`,
+		"loop2.json": `{"Includes": ["loop.json"]}`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := ResolveConfigSkeleton(filepath.Join(dir, "map.json"))
+	require.EqualError(t, err, "Found 3 conflicts between map files:\n"+
+		"Seed is 1 in "+filepath.Join(dir, "map.json")+" but 2 in "+filepath.Join(dir, "a.json")+"\n"+
+		"public.users.ssn is in "+filepath.Join(dir, "a.json")+" and "+filepath.Join(dir, "b.json")+
+		" with different settings\n"+
+		"Rule emails is in "+filepath.Join(dir, "a.json")+" and "+filepath.Join(dir, "b.json")+
+		" with different settings")
+
+	_, err = ResolveConfigSkeleton(filepath.Join(dir, "loop.json"))
+	require.EqualError(t, err, "Map file "+filepath.Join(dir, "loop.json")+" includes itself: "+
+		filepath.Join(dir, "loop.json")+" -> "+filepath.Join(dir, "loop2.json")+" -> "+filepath.Join(dir, "loop.json"))
+
+	_, err = ResolveConfigSkeleton(filepath.Join(dir, "a.json"), filepath.Join(dir, "map.json"))
+	require.EqualError(t, err, "Overlay "+filepath.Join(dir, "map.json")+
+		": Includes are only supported in map files")
+}
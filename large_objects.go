@@ -0,0 +1,99 @@
+package gonymizer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Large objects are not stored in regular tables so they never pass through the column processors. pg_dump writes
+// their contents as a series of lowrite calls in the data section of the dump:
+//
+//   SELECT pg_catalog.lo_open('16385', 131072);
+//   SELECT pg_catalog.lowrite(0, '\x48656c6c6f');
+//   SELECT pg_catalog.lo_close(0);
+//
+// A dump that includes the system catalogs may instead contain a COPY block for pg_catalog.pg_largeobject.
+
+// LargeObjectsKeep leaves large object data untouched (default)
+// LargeObjectsDrop removes large object data from the dump. The large objects are still created but are empty
+// LargeObjectsReplace replaces large object data with random bytes of the same length
+const (
+	LargeObjectsKeep    = "keep"
+	LargeObjectsDrop    = "drop"
+	LargeObjectsReplace = "replace"
+)
+
+var loWriteRegex = regexp.MustCompile(`^(\s*SELECT pg_catalog\.lowrite\(\d+, )(E?)'([^']*)'(\);\s*)$`)
+
+// ValidateLargeObjectsPolicy returns an error if the policy is not one of the LargeObjects* constants.
+func ValidateLargeObjectsPolicy(policy string) error {
+	switch policy {
+	case "", LargeObjectsKeep, LargeObjectsDrop, LargeObjectsReplace:
+		return nil
+	}
+	return fmt.Errorf("Unknown large objects policy %q. Expected one of: %s, %s, %s", policy,
+		LargeObjectsKeep, LargeObjectsDrop, LargeObjectsReplace)
+}
+
+// isLargeObjectTable returns true if the schema and table name refer to the large object catalog table.
+func isLargeObjectTable(schemaName, tableName string) bool {
+	return schemaName == "pg_catalog" && tableName == "pg_largeobject"
+}
+
+// processLargeObjectWrite applies the large object policy to a lowrite line. The returned bool is false if the line is
+// not a lowrite call.
+func processLargeObjectWrite(policy, inputLine string) (string, bool, error) {
+	if !strings.Contains(inputLine, "pg_catalog.lowrite(") {
+		return inputLine, false, nil
+	}
+	m := loWriteRegex.FindStringSubmatch(inputLine)
+	if m == nil {
+		return inputLine, false, nil
+	}
+
+	switch policy {
+	case LargeObjectsDrop:
+		return "", true, nil
+	case LargeObjectsReplace:
+		// With standard_conforming_strings off pg_dump uses E'\\x...' so the backslash is doubled
+		literal := strings.TrimPrefix(strings.TrimPrefix(m[3], "\\"), "\\")
+		if !strings.HasPrefix(literal, "x") {
+			return "", true, fmt.Errorf("Unable to parse large object data: %s", inputLine)
+		}
+		value, err := hex.DecodeString(literal[1:])
+		if err != nil {
+			return "", true, fmt.Errorf("Unable to parse large object data: %s", err)
+		}
+		prefix := "\\x"
+		if m[2] == "E" {
+			prefix = "\\\\x"
+		}
+		return m[1] + m[2] + "'" + prefix + hex.EncodeToString(randomBytes(len(value))) + "'" + m[4], true, nil
+	}
+	return inputLine, true, nil
+}
+
+// processLargeObjectRow applies the large object policy to a row of the pg_catalog.pg_largeobject COPY block. An empty
+// string is returned if the row should be dropped.
+func processLargeObjectRow(policy string, columnNames []string, inputLine string) (string, error) {
+	switch policy {
+	case LargeObjectsDrop:
+		return "", nil
+	case LargeObjectsReplace:
+		rowVals := strings.Split(strings.TrimSuffix(inputLine, "\n"), "\t")
+		for i, columnName := range columnNames {
+			if columnName != "data" || i >= len(rowVals) || rowVals[i] == copyNull {
+				continue
+			}
+			value, err := decodeBytea(rowVals[i])
+			if err != nil {
+				return "", err
+			}
+			rowVals[i] = encodeBytea(randomBytes(len(value)))
+		}
+		return strings.Join(rowVals, "\t") + "\n", nil
+	}
+	return inputLine, nil
+}
@@ -0,0 +1,77 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLargeObjectsPolicy(t *testing.T) {
+	for _, policy := range []string{"", LargeObjectsKeep, LargeObjectsDrop, LargeObjectsReplace} {
+		require.Nil(t, ValidateLargeObjectsPolicy(policy))
+	}
+	require.NotNil(t, ValidateLargeObjectsPolicy("shred"))
+}
+
+func TestProcessLargeObjectWrite(t *testing.T) {
+	const line = "SELECT pg_catalog.lowrite(0, '\\x48656c6c6f');\n"
+
+	output, ok, err := processLargeObjectWrite(LargeObjectsKeep, line)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, line, output)
+
+	output, ok, err = processLargeObjectWrite(LargeObjectsDrop, line)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, "", output)
+
+	output, ok, err = processLargeObjectWrite(LargeObjectsReplace, line)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Regexp(t, `^SELECT pg_catalog\.lowrite\(0, '\\x[0-9a-f]{10}'\);\n$`, output)
+	require.NotEqual(t, line, output)
+
+	output, ok, err = processLargeObjectWrite(LargeObjectsReplace, "SELECT pg_catalog.lowrite(0, E'\\\\x4865');\n")
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Regexp(t, `^SELECT pg_catalog\.lowrite\(0, E'\\\\x[0-9a-f]{4}'\);\n$`, output)
+
+	output, ok, err = processLargeObjectWrite(LargeObjectsDrop, "SELECT pg_catalog.lo_close(0);\n")
+	require.Nil(t, err)
+	require.False(t, ok)
+	require.Equal(t, "SELECT pg_catalog.lo_close(0);\n", output)
+}
+
+func TestProcessLargeObjectRow(t *testing.T) {
+	columns := []string{"loid", "pageno", "data"}
+	const row = "16385\t0\t\\\\x48656c6c6f\n"
+
+	output, err := processLargeObjectRow(LargeObjectsKeep, columns, row)
+	require.Nil(t, err)
+	require.Equal(t, row, output)
+
+	output, err = processLargeObjectRow(LargeObjectsDrop, columns, row)
+	require.Nil(t, err)
+	require.Equal(t, "", output)
+
+	output, err = processLargeObjectRow(LargeObjectsReplace, columns, row)
+	require.Nil(t, err)
+	require.Regexp(t, `^16385\t0\t\\\\x[0-9a-f]{10}\n$`, output)
+}
+
+func TestProcessLineLargeObjects(t *testing.T) {
+	state := &LineState{LargeObjects: LargeObjectsDrop}
+	mapper := &DBMapper{DBName: "test"}
+
+	_, output, err := processLine(mapper, state, "SELECT pg_catalog.lowrite(0, '\\x4865');\n")
+	require.Nil(t, err)
+	require.Equal(t, "", output)
+
+	state, _, err = processLine(mapper, state, "COPY pg_catalog.pg_largeobject (loid, pageno, data) FROM stdin;\n")
+	require.Nil(t, err)
+	_, output, err = processLine(mapper, state, "16385\t0\t\\\\x4865\n")
+	require.Nil(t, err)
+	require.Equal(t, "", output)
+	require.Equal(t, LargeObjectsDrop, state.LargeObjects)
+}
@@ -0,0 +1,205 @@
+package gonymizer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Severities of a LintFinding
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// Rules checked by LintMap
+const (
+	LintRuleInvalidMap        = "invalid-map"
+	LintRulePIIIdentity       = "pii-identity"
+	LintRuleMissingParent     = "missing-parent"
+	LintRuleParentProcessors  = "parent-processors"
+	LintRuleNullNotNullable   = "null-not-nullable"
+	LintRuleInvalidExemptions = "invalid-exemptions"
+	LintRuleDuplicateColumn   = "duplicate-column"
+)
+
+// LintRules describes every rule checked by LintMap.
+var LintRules = map[string]string{
+	LintRuleInvalidMap:        "The map file does not pass validation and can not be loaded",
+	LintRulePIIIdentity:       "A column that looks like it holds personal data is not anonymized",
+	LintRuleMissingParent:     "ParentSchema, ParentTable and ParentColumn name a column that is not in the map",
+	LintRuleParentProcessors:  "A column uses other processors than its parent column, so their values will not match",
+	LintRuleNullNotNullable:   "SetNull, NullBytea, NullRate or OnError null is used on a column that is not nullable",
+	LintRuleInvalidExemptions: "The Exemptions of a processor are not a valid regular expression",
+	LintRuleDuplicateColumn:   "A column is in the map more than once",
+}
+
+// LintFinding is a problem found in a map file.
+type LintFinding struct {
+	Rule     string
+	Severity string
+	Column   string `json:",omitempty"`
+	Message  string
+}
+
+// String returns the finding as a line of text.
+func (finding LintFinding) String() string {
+	if finding.Column == "" {
+		return fmt.Sprintf("%s [%s] %s", finding.Severity, finding.Rule, finding.Message)
+	}
+	return fmt.Sprintf("%s [%s] %s: %s", finding.Severity, finding.Rule, finding.Column, finding.Message)
+}
+
+// LintMap checks a map for mistakes that would leak personal data or break relationships and returns every problem it
+// finds, sorted by column. Unlike Validate it does not stop at the first problem. Rules in disabled are not checked.
+func LintMap(dbMap *DBMapper, disabled ...string) []LintFinding {
+	skip := make(map[string]bool)
+	for _, rule := range disabled {
+		skip[rule] = true
+	}
+
+	var findings []LintFinding
+	report := func(rule, severity, column, format string, args ...interface{}) {
+		if !skip[rule] {
+			findings = append(findings, LintFinding{rule, severity, column, fmt.Sprintf(format, args...)})
+		}
+	}
+
+	if err := dbMap.Validate(); err != nil {
+		report(LintRuleInvalidMap, LintError, "", "%s", err)
+
+		// Validate stops before the rules are indexed, index them anyway if their patterns compile
+		compiled := true
+		for i := range dbMap.Rules {
+			if dbMap.Rules[i].compile() != nil {
+				compiled = false
+			}
+		}
+		if compiled {
+			dbMap.indexRules()
+		}
+	}
+
+	seen := make(map[string]int)
+	columns := make(map[string]ColumnMapper)
+	for _, col := range dbMap.ColumnMaps {
+		key := columnKey(col)
+		seen[key]++
+		if seen[key] == 2 {
+			report(LintRuleDuplicateColumn, LintError, key, "The column is in the map more than once")
+		}
+		if _, ok := columns[key]; !ok {
+			columns[key] = col
+		}
+	}
+
+	for _, col := range dbMap.ColumnMaps {
+		key := columnKey(col)
+		resolved := col
+		if cmap, _ := dbMap.resolveColumn(col.TableSchema, col.TableName, col.ColumnName); cmap != nil {
+			resolved = *cmap
+		}
+
+		if !anonymizes(resolved.Processors) {
+			if heuristic, ok := classifyName(col); ok && heuristic.confidence != ConfidenceLow {
+				severity := LintWarning
+				if heuristic.confidence == ConfidenceHigh {
+					severity = LintError
+				}
+				report(LintRulePIIIdentity, severity, key, "The column looks like %s but is not anonymized, I.E. use %s",
+					heuristic.label, heuristic.processor.Name)
+			}
+		}
+
+		if col.ParentSchema != "" || col.ParentTable != "" || col.ParentColumn != "" {
+			parentKey := fmt.Sprintf("%s.%s.%s", col.ParentSchema, col.ParentTable, col.ParentColumn)
+			parent, ok := columns[parentKey]
+			if !ok {
+				report(LintRuleMissingParent, LintError, key, "The parent column %s is not in the map", parentKey)
+			} else {
+				if cmap, _ := dbMap.resolveColumn(parent.TableSchema, parent.TableName, parent.ColumnName); cmap != nil {
+					parent = *cmap
+				}
+				if processorNames(parent.Processors) != processorNames(resolved.Processors) {
+					report(LintRuleParentProcessors, LintError, key, "The column uses [%s] but its parent %s uses [%s]",
+						processorNames(resolved.Processors), parentKey, processorNames(parent.Processors))
+				}
+			}
+		}
+
+		if !resolved.IsNullable {
+			lintNulls(resolved, func(format string, args ...interface{}) {
+				report(LintRuleNullNotNullable, LintError, key, format, args...)
+			})
+		}
+
+		exemptions := func(format string, args ...interface{}) {
+			report(LintRuleInvalidExemptions, LintError, key, format, args...)
+		}
+		lintExemptions("Processors", resolved.Processors, exemptions)
+		if resolved.OnError != nil {
+			lintExemptions("OnError.Fallback", resolved.OnError.Fallback, exemptions)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Column < findings[j].Column
+	})
+	return findings
+}
+
+// anonymizes returns true if any of the processors changes values.
+func anonymizes(processors []ProcessorDefinition) bool {
+	for _, procDef := range processors {
+		if procDef.Name != "Identity" {
+			return true
+		}
+	}
+	return false
+}
+
+// processorNames returns the names of the processors, I.E. FakeEmailAddress, Identity.
+func processorNames(processors []ProcessorDefinition) string {
+	names := make([]string, len(processors))
+	for i, procDef := range processors {
+		names[i] = procDef.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// lintNulls reports the settings of a column that is not nullable that would write NULL.
+func lintNulls(cmap ColumnMapper, report func(format string, args ...interface{})) {
+	if cmap.NullRate > 0 {
+		report("NullRate is set but the column is not nullable")
+	}
+	if cmap.OnError != nil && cmap.OnError.Action == OnErrorNull {
+		report("OnError %s is set but the column is not nullable", OnErrorNull)
+	}
+	for i, procDef := range cmap.Processors {
+		if nullProcessors[procDef.Name] {
+			report("Processors[%d] %s writes NULL but the column is not nullable", i, procDef.Name)
+		}
+		if procDef.OnError != nil && procDef.OnError.Action == OnErrorNull {
+			report("Processors[%d] OnError %s is set but the column is not nullable", i, OnErrorNull)
+		}
+	}
+}
+
+// lintExemptions reports the Exemptions of processors, sub-processors and fallbacks that do not compile.
+func lintExemptions(path string, processors []ProcessorDefinition, report func(format string, args ...interface{})) {
+	for i, procDef := range processors {
+		procPath := fmt.Sprintf("%s[%d]", path, i)
+		if procDef.Exemptions != "" {
+			if _, err := regexp.Compile(procDef.Exemptions); err != nil {
+				report("%s Exemptions %q: %s", procPath, procDef.Exemptions, err)
+			}
+		}
+		for _, key := range sortedSubProcessorKeys(procDef.SubProcessors) {
+			lintExemptions(fmt.Sprintf("%s.SubProcessors[%q]", procPath, key), procDef.SubProcessors[key], report)
+		}
+		if procDef.OnError != nil {
+			lintExemptions(procPath+".OnError.Fallback", procDef.OnError.Fallback, report)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func lintRules(findings []LintFinding) map[string]string {
+	rules := make(map[string]string)
+	for _, finding := range findings {
+		rules[finding.Column+" "+finding.Rule] = finding.Severity
+	}
+	return rules
+}
+
+func TestLintMap(t *testing.T) {
+	identity := []ProcessorDefinition{{Name: "Identity"}}
+	dbMap := DBMapper{
+		DBName: "test",
+		ColumnMaps: []ColumnMapper{
+			{TableSchema: "public", TableName: "users", ColumnName: "id", DataType: "uuid",
+				Processors: []ProcessorDefinition{{Name: "RandomUUID"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "email", DataType: "text", Processors: identity},
+			{TableSchema: "public", TableName: "users", ColumnName: "username", DataType: "text"},
+			{TableSchema: "public", TableName: "users", ColumnName: "phone", DataType: "text",
+				Processors: []ProcessorDefinition{{Name: "FakePhoneNumber", Exemptions: "(555"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "nickname", DataType: "text",
+				Processors: []ProcessorDefinition{{Name: "SetNull"}}},
+			{TableSchema: "public", TableName: "orders", ColumnName: "user_id", DataType: "uuid",
+				ParentSchema: "public", ParentTable: "users", ParentColumn: "id", Processors: identity},
+			{TableSchema: "public", TableName: "orders", ColumnName: "coupon_id", DataType: "uuid",
+				ParentSchema: "public", ParentTable: "coupons", ParentColumn: "id", Processors: identity},
+			{TableSchema: "public", TableName: "orders", ColumnName: "id", DataType: "uuid", Processors: identity},
+			{TableSchema: "public", TableName: "orders", ColumnName: "id", DataType: "uuid", Processors: identity},
+		},
+	}
+
+	findings := LintMap(&dbMap)
+	require.Equal(t, map[string]string{
+		" invalid-map":                            LintError,
+		"public.orders.coupon_id missing-parent":  LintError,
+		"public.orders.id duplicate-column":       LintError,
+		"public.orders.user_id parent-processors": LintError,
+		"public.users.email pii-identity":         LintError,
+		"public.users.username pii-identity":      LintWarning,
+		"public.users.phone invalid-exemptions":   LintError,
+		"public.users.nickname null-not-nullable": LintError,
+	}, lintRules(findings))
+	require.Equal(t, "", findings[0].Column)
+
+	findings = LintMap(&dbMap, LintRuleInvalidMap, LintRulePIIIdentity)
+	require.Len(t, findings, 5)
+	for _, finding := range findings {
+		require.NotEqual(t, LintRulePIIIdentity, finding.Rule)
+	}
+
+	// rules anonymize the columns they match
+	dbMap.Rules = []ColumnRule{{ColumnName: "email", Processors: []ProcessorDefinition{{Name: "FakeEmailAddress"}}}}
+	dbMap.ColumnMaps[1].Processors = nil
+	_, ok := lintRules(LintMap(&dbMap))["public.users.email pii-identity"]
+	require.False(t, ok)
+
+	require.Equal(t, "error [missing-parent] public.orders.coupon_id: The parent column public.coupons.id is not in the map",
+		LintFinding{LintRuleMissingParent, LintError, "public.orders.coupon_id",
+			"The parent column public.coupons.id is not in the map"}.String())
+}
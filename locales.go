@@ -0,0 +1,254 @@
+package gonymizer
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// The fake library only ships an English dataset, so the datasets for other locales are bundled here. A locale can be
+// set on a ProcessorDefinition, a table (DBMapper.Tables), or the whole DBMapper. The most specific one wins and the
+// default is English.
+
+// DefaultLocale is the locale used when none is configured. It is served by the fake library.
+const DefaultLocale = "en"
+
+// localeData is a bundled dataset used by the Fake* processors for a single locale. Formats use # for a random digit.
+type localeData struct {
+	firstNames      []string
+	lastNames       []string
+	streets         []string
+	cities          []string
+	states          []string
+	stateAbbrevs    []string
+	companySuffixes []string
+	phoneFormats    []string
+	zipFormats      []string
+
+	// addressFormat is a fmt format where %[1]s is the street and %[2]d is the house number
+	addressFormat string
+}
+
+// localeCatalog contains every supported locale. The nil DefaultLocale entry means the fake library is used.
+var localeCatalog = map[string]*localeData{
+	DefaultLocale: nil,
+	"de": {
+		firstNames: []string{"Lukas", "Leon", "Finn", "Jonas", "Paul", "Felix", "Maximilian", "Elias", "Noah", "Ben",
+			"Emma", "Mia", "Hannah", "Sophia", "Lea", "Lena", "Marie", "Anna", "Laura", "Johanna", "Katharina", "Sabine",
+			"Jürgen", "Uwe", "Stefan", "Andreas", "Ursula", "Monika", "Petra", "Günter"},
+		lastNames: []string{"Müller", "Schmidt", "Schneider", "Fischer", "Weber", "Meyer", "Wagner", "Becker", "Schulz",
+			"Hoffmann", "Schäfer", "Koch", "Bauer", "Richter", "Klein", "Wolf", "Schröder", "Neumann", "Schwarz",
+			"Zimmermann", "Braun", "Krüger", "Hofmann", "Hartmann", "Lange", "Schmitt", "Werner", "Krause", "Meier",
+			"Lehmann"},
+		streets: []string{"Hauptstraße", "Schulstraße", "Gartenstraße", "Bahnhofstraße", "Dorfstraße", "Bergstraße",
+			"Birkenweg", "Lindenstraße", "Kirchstraße", "Waldstraße", "Ringstraße", "Schillerstraße", "Goethestraße",
+			"Mühlenweg", "Am Markt", "Friedhofstraße", "Feldstraße", "Wiesenweg", "Rosenstraße", "Parkstraße"},
+		cities: []string{"Berlin", "Hamburg", "München", "Köln", "Frankfurt am Main", "Stuttgart", "Düsseldorf",
+			"Leipzig", "Dortmund", "Essen", "Bremen", "Dresden", "Hannover", "Nürnberg", "Duisburg", "Bochum",
+			"Wuppertal", "Bielefeld", "Bonn", "Münster"},
+		states: []string{"Baden-Württemberg", "Bayern", "Berlin", "Brandenburg", "Bremen", "Hamburg", "Hessen",
+			"Mecklenburg-Vorpommern", "Niedersachsen", "Nordrhein-Westfalen", "Rheinland-Pfalz", "Saarland", "Sachsen",
+			"Sachsen-Anhalt", "Schleswig-Holstein", "Thüringen"},
+		stateAbbrevs: []string{"BW", "BY", "BE", "BB", "HB", "HH", "HE", "MV", "NI", "NW", "RP", "SL", "SN", "ST", "SH",
+			"TH"},
+		companySuffixes: []string{"GmbH", "AG", "KG", "GmbH & Co. KG", "e.K."},
+		phoneFormats:    []string{"+49 30 #######", "+49 89 ########", "0### #######", "+49 151 ########", "0171 #######"},
+		zipFormats:      []string{"#####"},
+		addressFormat:   "%[1]s %[2]d",
+	},
+	"fr": {
+		firstNames: []string{"Gabriel", "Louis", "Raphaël", "Jules", "Adam", "Lucas", "Léo", "Hugo", "Arthur", "Nathan",
+			"Jade", "Louise", "Emma", "Alice", "Ambre", "Lina", "Rose", "Chloé", "Léa", "Manon", "Camille", "Inès",
+			"Nicolas", "Julien", "Sébastien", "Isabelle", "Nathalie", "Sylvie", "Philippe", "François"},
+		lastNames: []string{"Martin", "Bernard", "Thomas", "Petit", "Robert", "Richard", "Durand", "Dubois", "Moreau",
+			"Laurent", "Simon", "Michel", "Lefebvre", "Leroy", "Roux", "David", "Bertrand", "Morel", "Fournier",
+			"Girard", "Bonnet", "Dupont", "Lambert", "Fontaine", "Rousseau", "Vincent", "Muller", "Lefèvre", "Faure",
+			"André"},
+		streets: []string{"rue de la Paix", "rue Victor Hugo", "avenue de la République", "boulevard Voltaire",
+			"rue du Moulin", "place de l'Église", "rue Pasteur", "rue de la Gare", "avenue Jean Jaurès", "rue des Écoles",
+			"chemin des Vignes", "rue Jules Ferry", "allée des Tilleuls", "rue du Château", "impasse des Lilas",
+			"rue Nationale", "quai de la Loire", "rue Gambetta", "avenue Foch", "rue de Verdun"},
+		cities: []string{"Paris", "Marseille", "Lyon", "Toulouse", "Nice", "Nantes", "Montpellier", "Strasbourg",
+			"Bordeaux", "Lille", "Rennes", "Reims", "Toulon", "Saint-Étienne", "Le Havre", "Grenoble", "Dijon", "Angers",
+			"Nîmes", "Villeurbanne"},
+		states: []string{"Auvergne-Rhône-Alpes", "Bourgogne-Franche-Comté", "Bretagne", "Centre-Val de Loire", "Corse",
+			"Grand Est", "Hauts-de-France", "Île-de-France", "Normandie", "Nouvelle-Aquitaine", "Occitanie",
+			"Pays de la Loire", "Provence-Alpes-Côte d'Azur"},
+		stateAbbrevs:    []string{"ARA", "BFC", "BRE", "CVL", "COR", "GES", "HDF", "IDF", "NOR", "NAQ", "OCC", "PDL", "PAC"},
+		companySuffixes: []string{"SA", "SARL", "SAS", "EURL", "et Fils"},
+		phoneFormats:    []string{"+33 1 ## ## ## ##", "01 ## ## ## ##", "04 ## ## ## ##", "06 ## ## ## ##", "+33 7 ## ## ## ##"},
+		zipFormats:      []string{"75###", "69###", "13###", "#####"},
+		addressFormat:   "%[2]d %[1]s",
+	},
+	"pt_BR": {
+		firstNames: []string{"Miguel", "Arthur", "Gael", "Heitor", "Theo", "Davi", "Gabriel", "Bernardo", "Samuel",
+			"João", "Helena", "Alice", "Laura", "Maria", "Valentina", "Heloísa", "Manuela", "Júlia", "Sophia", "Isabella",
+			"Ana", "Beatriz", "Luiz", "Carlos", "Paulo", "Francisca", "Antônia", "Adriana", "José", "Marcos"},
+		lastNames: []string{"Silva", "Santos", "Oliveira", "Souza", "Rodrigues", "Ferreira", "Alves", "Pereira", "Lima",
+			"Gomes", "Costa", "Ribeiro", "Martins", "Carvalho", "Almeida", "Lopes", "Soares", "Fernandes", "Vieira",
+			"Barbosa", "Rocha", "Dias", "Nascimento", "Andrade", "Moreira", "Nunes", "Marques", "Machado", "Mendes",
+			"Freitas"},
+		streets: []string{"Rua das Flores", "Avenida Brasil", "Rua São João", "Rua Sete de Setembro", "Avenida Paulista",
+			"Rua XV de Novembro", "Rua Tiradentes", "Rua Santos Dumont", "Avenida Getúlio Vargas", "Rua Dom Pedro II",
+			"Rua da Paz", "Travessa Boa Vista", "Rua Primavera", "Avenida Atlântica", "Rua Bahia", "Rua Amazonas",
+			"Rua Goiás", "Alameda Santos", "Rua Marechal Deodoro", "Rua Rio Branco"},
+		cities: []string{"São Paulo", "Rio de Janeiro", "Brasília", "Salvador", "Fortaleza", "Belo Horizonte", "Manaus",
+			"Curitiba", "Recife", "Goiânia", "Belém", "Porto Alegre", "Guarulhos", "Campinas", "São Luís", "Maceió",
+			"Natal", "Teresina", "Campo Grande", "João Pessoa"},
+		states: []string{"Acre", "Alagoas", "Amapá", "Amazonas", "Bahia", "Ceará", "Distrito Federal", "Espírito Santo",
+			"Goiás", "Maranhão", "Mato Grosso", "Mato Grosso do Sul", "Minas Gerais", "Pará", "Paraíba", "Paraná",
+			"Pernambuco", "Piauí", "Rio de Janeiro", "Rio Grande do Norte", "Rio Grande do Sul", "Rondônia", "Roraima",
+			"Santa Catarina", "São Paulo", "Sergipe", "Tocantins"},
+		stateAbbrevs: []string{"AC", "AL", "AP", "AM", "BA", "CE", "DF", "ES", "GO", "MA", "MT", "MS", "MG", "PA", "PB",
+			"PR", "PE", "PI", "RJ", "RN", "RS", "RO", "RR", "SC", "SP", "SE", "TO"},
+		companySuffixes: []string{"Ltda.", "S.A.", "EIRELI", "ME", "e Filhos"},
+		phoneFormats:    []string{"(11) 9####-####", "(21) 9####-####", "+55 31 9####-####", "(41) ####-####"},
+		zipFormats:      []string{"#####-###"},
+		addressFormat:   "%[1]s, %[2]d",
+	},
+}
+
+// normalizeLocale returns the bundled locale for the given locale name, accepting either an exact match, I.E. pt_BR,
+// or a language with any region, I.E. de_AT or fr-CA. An empty locale is the DefaultLocale.
+func normalizeLocale(locale string) (string, error) {
+	if locale == "" {
+		return DefaultLocale, nil
+	}
+
+	parts := strings.SplitN(strings.Replace(locale, "-", "_", -1), "_", 2)
+	name := strings.ToLower(parts[0])
+	if len(parts) == 2 {
+		name += "_" + strings.ToUpper(parts[1])
+	}
+	if _, ok := localeCatalog[name]; ok {
+		return name, nil
+	}
+	if _, ok := localeCatalog[strings.ToLower(parts[0])]; ok {
+		return strings.ToLower(parts[0]), nil
+	}
+	return "", fmt.Errorf("Unknown locale %q", locale)
+}
+
+// localeFor returns the dataset for the locale of a processor definition, or else the locale of the column. nil is
+// returned for the default locale in which case the fake library should be used.
+func localeFor(cmap *ColumnMapper, locale string) (*localeData, error) {
+	if locale == "" {
+		locale = cmap.locale
+	}
+	name, err := normalizeLocale(locale)
+	if err != nil {
+		return nil, err
+	}
+	return localeCatalog[name], nil
+}
+
+// localeFaker is the constructor of a Fake processor that generates values from the dataset of the definition's
+// locale, or from the fake library for the default locale.
+func localeFaker(generate func(l *localeData) string, fallback func() string) ProcessorConstructor {
+	return func(procDef ProcessorDefinition) (ProcessorFunc, error) {
+		if _, err := normalizeLocale(procDef.Locale); err != nil {
+			return nil, err
+		}
+		return func(cmap *ColumnMapper, input string) (string, error) {
+			data, err := localeFor(cmap, procDef.Locale)
+			if err != nil {
+				return "", err
+			}
+			if data != nil {
+				return generate(data), nil
+			}
+			return fallback(), nil
+		}, nil
+	}
+}
+
+// resolveLocales stores the table or DBMapper locale on each ColumnMapper so processors can find it.
+func (dbMap *DBMapper) resolveLocales() {
+	for i := range dbMap.ColumnMaps {
+		cmap := &dbMap.ColumnMaps[i]
+		cmap.locale = dbMap.tableLocale(cmap.TableSchema, cmap.TableName)
+	}
+}
+
+// tableLocale returns the locale of a table, which is its own or else the DBMapper's.
+func (dbMap DBMapper) tableLocale(schemaName, tableName string) string {
+	locale := dbMap.Locale
+	for _, table := range dbMap.Tables {
+		if table.Locale != "" && table.TableSchema == schemaName && table.TableName == tableName {
+			locale = table.Locale
+		}
+	}
+	return locale
+}
+
+// validateLocales checks that every locale set on the DBMapper and its tables is bundled.
+func (dbMap *DBMapper) validateLocales() error {
+	if _, err := normalizeLocale(dbMap.Locale); err != nil {
+		return err
+	}
+	for _, table := range dbMap.Tables {
+		if _, err := normalizeLocale(table.Locale); err != nil {
+			return fmt.Errorf("%s.%s: %s", table.TableSchema, table.TableName, err)
+		}
+	}
+	return nil
+}
+
+// randomElement returns a random element of a bundled list.
+func randomElement(list []string) string {
+	return list[rand.Intn(len(list))]
+}
+
+// randomFormat replaces each # in a random format with a random digit.
+func randomFormat(formats []string) string {
+	format := randomElement(formats)
+	var b strings.Builder
+	for _, r := range format {
+		if r == '#' {
+			b.WriteString(randomNumeric())
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (l *localeData) firstName() string {
+	return randomElement(l.firstNames)
+}
+
+func (l *localeData) lastName() string {
+	return randomElement(l.lastNames)
+}
+
+func (l *localeData) fullName() string {
+	return l.firstName() + " " + l.lastName()
+}
+
+func (l *localeData) streetAddress() string {
+	return fmt.Sprintf(l.addressFormat, randomElement(l.streets), rand.Intn(199)+1)
+}
+
+func (l *localeData) city() string {
+	return randomElement(l.cities)
+}
+
+func (l *localeData) state() string {
+	return randomElement(l.states)
+}
+
+func (l *localeData) stateAbbrev() string {
+	return randomElement(l.stateAbbrevs)
+}
+
+func (l *localeData) company() string {
+	return l.lastName() + " " + randomElement(l.companySuffixes)
+}
+
+func (l *localeData) phone() string {
+	return randomFormat(l.phoneFormats)
+}
+
+func (l *localeData) zip() string {
+	return randomFormat(l.zipFormats)
+}
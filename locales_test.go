@@ -0,0 +1,122 @@
+package gonymizer
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	for locale, expected := range map[string]string{
+		"":      DefaultLocale,
+		"en_US": "en",
+		"de":    "de",
+		"de-AT": "de",
+		"FR_fr": "fr",
+		"pt_BR": "pt_BR",
+		"pt-br": "pt_BR",
+	} {
+		name, err := normalizeLocale(locale)
+		require.Nil(t, err, locale)
+		require.Equal(t, expected, name, locale)
+	}
+
+	for _, locale := range []string{"pt", "pt_PT", "xx", "klingon"} {
+		_, err := normalizeLocale(locale)
+		require.NotNil(t, err, locale)
+	}
+}
+
+func TestLocaleFakers(t *testing.T) {
+	cmap := ColumnMapper{
+		Processors: []ProcessorDefinition{{Name: "FakeFirstName", Locale: "de"}},
+	}
+	output, err := ProcessorFirstName(&cmap, "Rick")
+	require.Nil(t, err)
+	require.Contains(t, localeCatalog["de"].firstNames, output)
+
+	// The processor locale wins over the inherited one
+	cmap.locale = "fr"
+	output, err = ProcessorFirstName(&cmap, "Rick")
+	require.Nil(t, err)
+	require.Contains(t, localeCatalog["de"].firstNames, output)
+
+	cmap.Processors = []ProcessorDefinition{{Name: "FakeCity"}}
+	output, err = ProcessorCity(&cmap, "Seattle")
+	require.Nil(t, err)
+	require.Contains(t, localeCatalog["fr"].cities, output)
+
+	cmap.locale = "pt_BR"
+	cmap.Processors = []ProcessorDefinition{{Name: "FakeZip"}}
+	output, err = ProcessorZip(&cmap, "98101")
+	require.Nil(t, err)
+	require.Regexp(t, regexp.MustCompile(`^\d{5}-\d{3}$`), output)
+
+	cmap.Processors = []ProcessorDefinition{{Name: "FakeStreetAddress"}}
+	output, err = ProcessorAddress(&cmap, "1 Main St")
+	require.Nil(t, err)
+	require.Regexp(t, regexp.MustCompile(`^\D+, \d+$`), output)
+
+	cmap.Processors = []ProcessorDefinition{{Name: "FakePhoneNumber"}}
+	output, err = ProcessorPhoneNumber(&cmap, "555-555-5555")
+	require.Nil(t, err)
+	require.NotContains(t, output, "#")
+
+	// an unknown locale is an error instead of the default locale
+	cmap.Processors = []ProcessorDefinition{{Name: "FakeCity", Locale: "xx_XX"}}
+	_, err = ProcessorCity(&cmap, "Seattle")
+	require.NotNil(t, err)
+	cmap.locale = "xx_XX"
+	cmap.Processors = []ProcessorDefinition{{Name: "FakeCity"}}
+	_, err = ProcessorCity(&cmap, "Seattle")
+	require.NotNil(t, err)
+
+	// every definition has its own locale
+	cmap.locale = ""
+	cmap.Processors = []ProcessorDefinition{{Name: "FakeFirstName", Locale: "de"}, {Name: "FakeFirstName", Locale: "xx"}}
+	require.NotNil(t, constructProcessors(cmap.Processors))
+	cmap.Processors[1].Locale = "fr"
+	require.Nil(t, constructProcessors(cmap.Processors))
+	output, err = cmap.Processors[1].pfunc(&cmap, "Rick")
+	require.Nil(t, err)
+	require.Contains(t, localeCatalog["fr"].firstNames, output)
+}
+
+func TestResolveLocales(t *testing.T) {
+	dbMap := DBMapper{
+		DBName: "test",
+		Locale: "fr",
+		Tables: []TableMapper{{TableSchema: "public", TableName: "customers", Locale: "pt_BR"}},
+		ColumnMaps: []ColumnMapper{
+			{TableSchema: "public", TableName: "customers", ColumnName: "first_name"},
+			{TableSchema: "public", TableName: "employees", ColumnName: "first_name"},
+		},
+	}
+	require.Nil(t, dbMap.Validate())
+
+	dbMap.resolveLocales()
+	require.Equal(t, "pt_BR", dbMap.ColumnMapper("public", "customers", "first_name").locale)
+	require.Equal(t, "fr", dbMap.ColumnMapper("public", "employees", "first_name").locale)
+}
+
+func TestValidateLocales(t *testing.T) {
+	dbMap := DBMapper{
+		DBName: "test",
+		ColumnMaps: []ColumnMapper{
+			{Processors: []ProcessorDefinition{{Name: "FakeFirstName", Locale: "de_DE"}}},
+		},
+	}
+	require.Nil(t, dbMap.Validate())
+
+	dbMap.Locale = "xx"
+	require.NotNil(t, dbMap.Validate())
+
+	dbMap.Locale = ""
+	dbMap.Tables = []TableMapper{{TableSchema: "public", TableName: "customers", Locale: "xx"}}
+	require.NotNil(t, dbMap.Validate())
+
+	dbMap.Tables = nil
+	dbMap.ColumnMaps[0].Processors[0].Locale = "xx"
+	require.NotNil(t, dbMap.Validate())
+}
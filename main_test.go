@@ -157,6 +157,134 @@ func seqUnitTests(t *testing.T) {
 	t.Run("ProcessorScrubString", TestProcessorScrubString)
 	t.Run("randomizeUUID", TestRandomizeUUID)
 
+	// processors_temporal.go
+	t.Run("PgTemporalRoundTrip", TestPgTemporalRoundTrip)
+	t.Run("ProcessorRandomTimestamp", TestProcessorRandomTimestamp)
+	t.Run("ProcessorJitterTimestamp", TestProcessorJitterTimestamp)
+	t.Run("ProcessorTruncateTimestamp", TestProcessorTruncateTimestamp)
+
+	// processors_bytea.go
+	t.Run("DecodeBytea", TestDecodeBytea)
+	t.Run("ProcessorRandomBytea", TestProcessorRandomBytea)
+	t.Run("ProcessorPlaceholderBytea", TestProcessorPlaceholderBytea)
+	t.Run("ProcessorNullBytea", TestProcessorNullBytea)
+
+	// processors_geometry.go
+	t.Run("DecodeWKB", TestDecodeWKB)
+	t.Run("ParseWKT", TestParseWKT)
+	t.Run("ProcessorJitterGeometry", TestProcessorJitterGeometry)
+	t.Run("IsGeographic", TestIsGeographic)
+	t.Run("NormalizeDegrees", TestNormalizeDegrees)
+	t.Run("ProcessorSnapGeometry", TestProcessorSnapGeometry)
+
+	// processors_hstore.go
+	t.Run("ParseHstore", TestParseHstore)
+	t.Run("ProcessorHstoreKeys", TestProcessorHstoreKeys)
+
+	// processors_xml.go
+	t.Run("CompileXPath", TestCompileXPath)
+	t.Run("ProcessorXmlPaths", TestProcessorXmlPaths)
+	t.Run("ValidateXmlPaths", TestValidateXmlPaths)
+
+	// registry.go
+	t.Run("RegisterProcessor", TestRegisterProcessor)
+	t.Run("RegisteredProcessors", TestRegisteredProcessors)
+	t.Run("ValidateProcessorDefinition", TestValidateProcessorDefinition)
+	t.Run("CheckParameter", TestCheckParameter)
+	t.Run("DecodeParams", TestDecodeParams)
+	t.Run("ConstructProcessors", TestConstructProcessors)
+	t.Run("ConstructDefinition", TestConstructDefinition)
+	t.Run("ValidateProcessorsPath", TestValidateProcessorsPath)
+
+	// plugins.go
+	t.Run("ProcessorPlugin", TestProcessorPlugin)
+	t.Run("ProcessorPluginErrors", TestProcessorPluginErrors)
+	t.Run("PluginPool", TestPluginPool)
+
+	// expression.go
+	t.Run("CompileExpression", TestCompileExpression)
+	t.Run("ProcessorExpression", TestProcessorExpression)
+	t.Run("ExpressionRows", TestExpressionRows)
+
+	// drift.go
+	t.Run("FindSchemaDrift", TestFindSchemaDrift)
+	t.Run("CheckSchemaDriftPolicy", TestCheckSchemaDriftPolicy)
+
+	// error_policy.go
+	t.Run("ValidateErrorPolicy", TestValidateErrorPolicy)
+	t.Run("ApplyErrorPolicy", TestApplyErrorPolicy)
+
+	// output_types.go
+	t.Run("CheckOutputType", TestCheckOutputType)
+	t.Run("ValidateOutputTypes", TestValidateOutputTypes)
+	t.Run("ProcessValueOutputTypes", TestProcessValueOutputTypes)
+
+	// processors_null.go
+	t.Run("ProcessorSetNull", TestProcessorSetNull)
+	t.Run("ProcessorConstant", TestProcessorConstant)
+	t.Run("ValidateNulls", TestValidateNulls)
+	t.Run("NullRate", TestNullRate)
+	t.Run("ProcessNulls", TestProcessNulls)
+
+	// processors_enum.go
+	t.Run("ParseInListCheck", TestParseInListCheck)
+	t.Run("ProcessorEnumRandom", TestProcessorEnumRandom)
+	t.Run("ValidateEnums", TestValidateEnums)
+
+	// processors_ordered.go
+	t.Run("ProcessorOrderPreservingTokenInteger", TestProcessorOrderPreservingTokenInteger)
+	t.Run("ProcessorOrderPreservingTokenString", TestProcessorOrderPreservingTokenString)
+	t.Run("ProcessorOrderPreservingTokenParent", TestProcessorOrderPreservingTokenParent)
+	t.Run("NewOrderPreservingToken", TestNewOrderPreservingToken)
+
+	// rules.go
+	t.Run("ColumnRules", TestColumnRules)
+	t.Run("ValidateColumnRules", TestValidateColumnRules)
+
+	// classify.go
+	t.Run("ClassifyName", TestClassifyName)
+	t.Run("ClassifySamples", TestClassifySamples)
+	t.Run("ClassifyColumn", TestClassifyColumn)
+	t.Run("ClassifyColumns", TestClassifyColumns)
+
+	// merge.go
+	t.Run("MergeConfigSkeleton", TestMergeConfigSkeleton)
+	t.Run("MergeConfigSkeletonSchemas", TestMergeConfigSkeletonSchemas)
+	t.Run("MergeConfigSkeletonRules", TestMergeConfigSkeletonRules)
+
+	// includes.go
+	t.Run("ResolveConfigSkeleton", TestResolveConfigSkeleton)
+	t.Run("ResolveConfigSkeletonSettings", TestResolveConfigSkeletonSettings)
+	t.Run("ResolveConfigSkeletonConflicts", TestResolveConfigSkeletonConflicts)
+
+	// lint.go
+	t.Run("LintMap", TestLintMap)
+
+	// tables.go
+	t.Run("FilterTables", TestFilterTables)
+	t.Run("ValidateTables", TestValidateTables)
+
+	// subset.go
+	t.Run("SubsetPlan", TestSubsetPlan)
+	t.Run("SubsetScript", TestSubsetScript)
+	t.Run("ValidateSubset", TestValidateSubset)
+	t.Run("DumpIdentifier", TestDumpIdentifier)
+
+	// locales.go
+	t.Run("NormalizeLocale", TestNormalizeLocale)
+	t.Run("LocaleFakers", TestLocaleFakers)
+	t.Run("ResolveLocales", TestResolveLocales)
+	t.Run("ValidateLocales", TestValidateLocales)
+
+	// large_objects.go
+	t.Run("ValidateLargeObjectsPolicy", TestValidateLargeObjectsPolicy)
+	t.Run("ProcessLargeObjectWrite", TestProcessLargeObjectWrite)
+	t.Run("ProcessLargeObjectRow", TestProcessLargeObjectRow)
+	t.Run("ProcessLineLargeObjects", TestProcessLineLargeObjects)
+
+	// copy_text.go
+	t.Run("CopyTextRoundTrip", TestCopyTextRoundTrip)
+
 	// Below are tests that require the test database to be loaded into Postgres for testing functionality. This requires
 	// one to update the map file as well as create fake data in the testing/test_db.sql file when  updating users
 	t.Run("CreateDatabase", TestCreateDatabase)
@@ -176,13 +304,22 @@ func seqUnitTests(t *testing.T) {
 	t.Run("GetSchemasInDatabase", TestGetSchemasInDatabase)
 	t.Run("GetSchemaColumnEquals", TestGetSchemaColumnEquals)
 	t.Run("RenameDatabase", TestRenameDatabase)
+	t.Run("ForeignKeysFromRows", TestForeignKeysFromRows)
+
+	// map_format.go
+	t.Run("MapFormat", TestMapFormat)
+	t.Run("MapFormatRoundTrip", TestMapFormatRoundTrip)
+	t.Run("MapFormatYAMLComments", TestMapFormatYAMLComments)
 
 	// mapper.go
 	t.Run("LoadConfigSkeleton", TestLoadConfigSkeleton)
 	t.Run("GenerateConfigSkeleton", TestGenerateConfigSkeleton)
+	t.Run("CheckSchemaDrift", TestCheckSchemaDrift)
+	t.Run("AddColumn", TestAddColumn)
 
 	// Generate.go
 	t.Run("GenerateRandomInt64", TestGenerateRandomInt64)
+	t.Run("ProcessValueChaining", TestProcessValueChaining)
 	t.Run("GenerateSchemaSql", TestGenerateSchemaSql)
 	t.Run("PreProcess", TestPreProcess)
 	t.Run("ProcessDumpFile", TestProcessDumpFile)
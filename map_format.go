@@ -0,0 +1,285 @@
+package gonymizer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of map files, picked by the extension of their path
+const (
+	MapFormatJSON = "json"
+	MapFormatYAML = "yaml"
+	MapFormatTOML = "toml"
+)
+
+// MapFormat returns the format of a map file from the extension of its path. Files without a .yaml, .yml or .toml
+// extension are JSON.
+func MapFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return MapFormatYAML
+	case ".toml":
+		return MapFormatTOML
+	}
+	return MapFormatJSON
+}
+
+// decodeMap decodes a map file. YAML and TOML are converted to JSON first, so every format has the same field names
+// and defaults. The YAML document is kept with the map so its comments can be written back by encodeMap.
+func decodeMap(data []byte, format string) (*DBMapper, error) {
+	dbmap := new(DBMapper)
+	switch format {
+	case MapFormatYAML:
+		var (
+			doc   yaml.Node
+			value interface{}
+		)
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if doc.Kind == 0 {
+			return dbmap, nil
+		}
+		if err := doc.Decode(&value); err != nil {
+			return nil, err
+		}
+		converted, err := json.Marshal(jsonValue(value))
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+		dbmap.source = &doc
+	case MapFormatTOML:
+		var value map[string]interface{}
+		if err := toml.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		converted, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+	}
+
+	if err := json.Unmarshal(data, dbmap); err != nil {
+		return nil, err
+	}
+	return dbmap, nil
+}
+
+// encodeMap encodes a map in a format. The JSON encoding is converted to YAML and TOML, so fields that are left out
+// of JSON files are left out of them as well. YAML keeps the order of the fields and the comments of the file the map
+// was read from.
+func encodeMap(dbmap *DBMapper, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	jsonEncoder := json.NewEncoder(&buf)
+	jsonEncoder.SetIndent("", "    ")
+	if err := jsonEncoder.Encode(dbmap); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case MapFormatYAML:
+		// JSON is YAML, so the encoding is read into a document in the order of the fields
+		var doc yaml.Node
+		if err := yaml.Unmarshal(buf.Bytes(), &doc); err != nil {
+			return nil, err
+		}
+		blockStyle(&doc)
+		if dbmap.source != nil {
+			copyComments(&doc, dbmap.source)
+		}
+
+		var out bytes.Buffer
+		yamlEncoder := yaml.NewEncoder(&out)
+		yamlEncoder.SetIndent(2)
+		if err := yamlEncoder.Encode(&doc); err != nil {
+			return nil, err
+		}
+		if err := yamlEncoder.Close(); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	case MapFormatTOML:
+		var value map[string]interface{}
+		jsonDecoder := json.NewDecoder(&buf)
+		jsonDecoder.UseNumber()
+		if err := jsonDecoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		return toml.Marshal(tomlValue(value))
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeConfigSkeleton returns a map in a format, one of MapFormatJSON, MapFormatYAML or MapFormatTOML.
+func EncodeConfigSkeleton(dbmap *DBMapper, format string) ([]byte, error) {
+	switch format {
+	case MapFormatJSON, MapFormatYAML, MapFormatTOML:
+		return encodeMap(dbmap, format)
+	}
+	return nil, fmt.Errorf("Unknown map format %q, expected one of: %s, %s, %s", format, MapFormatJSON,
+		MapFormatYAML, MapFormatTOML)
+}
+
+// jsonValue converts the maps decoded from YAML, which may have keys that are not strings, to maps JSON can encode.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return converted
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = jsonValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+	}
+	return value
+}
+
+// tomlValue converts a decoded JSON value to one TOML can encode. TOML has no null, so null fields are left out, and
+// numbers are integers unless they have a fraction or exponent.
+func tomlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if item == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = tomlValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = tomlValue(item)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
+
+// blockStyle changes the flow style of a document read from JSON to the block style of YAML files. Quotes are left to
+// the encoder, which keeps them on strings that would otherwise be read as another type.
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle
+	if node.Kind == yaml.ScalarNode {
+		node.Style &^= yaml.DoubleQuotedStyle
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// copyComments copies the comments of a YAML document to the same fields of another one. Items of lists are matched by
+// the column or name they describe, so comments follow columns that moved.
+func copyComments(dst, src *yaml.Node) {
+	if dst.HeadComment == "" {
+		dst.HeadComment = src.HeadComment
+	}
+	if dst.LineComment == "" {
+		dst.LineComment = src.LineComment
+	}
+	if dst.FootComment == "" {
+		dst.FootComment = src.FootComment
+	}
+	if dst.Kind != src.Kind {
+		return
+	}
+
+	switch dst.Kind {
+	case yaml.DocumentNode:
+		if len(dst.Content) > 0 && len(src.Content) > 0 {
+			copyComments(dst.Content[0], src.Content[0])
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			for j := 0; j+1 < len(src.Content); j += 2 {
+				if dst.Content[i].Value == src.Content[j].Value {
+					copyComments(dst.Content[i], src.Content[j])
+					copyComments(dst.Content[i+1], src.Content[j+1])
+					break
+				}
+			}
+		}
+	case yaml.SequenceNode:
+		index := identityIndex(src)
+		for i, item := range dst.Content {
+			if match := matchingItem(src, index, item, i); match != nil {
+				copyComments(item, match)
+			}
+		}
+	}
+}
+
+// identityIndex returns the items of a YAML list by what they describe, see itemIdentity. The first of several items
+// that describe the same thing is used.
+func identityIndex(list *yaml.Node) map[string]*yaml.Node {
+	index := make(map[string]*yaml.Node, len(list.Content))
+	for _, item := range list.Content {
+		if id := itemIdentity(item); id != "" {
+			if _, ok := index[id]; !ok {
+				index[id] = item
+			}
+		}
+	}
+	return index
+}
+
+// matchingItem returns the item of a YAML list that describes the same column, processor or value as item, or the item
+// at the same position if item has nothing to identify it by. index is the identityIndex of the list.
+func matchingItem(list *yaml.Node, index map[string]*yaml.Node, item *yaml.Node, i int) *yaml.Node {
+	id := itemIdentity(item)
+	if id == "" {
+		if i < len(list.Content) {
+			return list.Content[i]
+		}
+		return nil
+	}
+	return index[id]
+}
+
+// itemIdentity returns what an item of a YAML list describes: the value of a scalar, or the column and name of a
+// mapping.
+func itemIdentity(node *yaml.Node) string {
+	if node.Kind == yaml.ScalarNode {
+		return node.Value
+	}
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+	var fields [4]string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		switch node.Content[i].Value {
+		case "TableSchema":
+			fields[0] = node.Content[i+1].Value
+		case "TableName":
+			fields[1] = node.Content[i+1].Value
+		case "ColumnName":
+			fields[2] = node.Content[i+1].Value
+		case "Name":
+			fields[3] = node.Content[i+1].Value
+		}
+	}
+	id := strings.Join(fields[:], ".")
+	if id == "..." {
+		return ""
+	}
+	return id
+}
@@ -0,0 +1,100 @@
+package gonymizer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapFormat(t *testing.T) {
+	require.Equal(t, MapFormatJSON, MapFormat("map.json"))
+	require.Equal(t, MapFormatJSON, MapFormat("map"))
+	require.Equal(t, MapFormatYAML, MapFormat("map.yaml"))
+	require.Equal(t, MapFormatYAML, MapFormat("map.YML"))
+	require.Equal(t, MapFormatTOML, MapFormat("map.toml"))
+}
+
+func formatTestMap() *DBMapper {
+	return &DBMapper{
+		DBName: "test",
+		Seed:   9007199254740993,
+		Locale: "de_DE",
+		Rules: []ColumnRule{{Name: "emails", ColumnName: "*email*",
+			Processors: []ProcessorDefinition{{Name: "FakeEmailAddress"}}}},
+		ColumnMaps: []ColumnMapper{
+			{TableSchema: "public", TableName: "users", ColumnName: "id", DataType: "integer", OrdinalPosition: 1,
+				Processors: []ProcessorDefinition{{Name: "Identity"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "status", DataType: "text", OrdinalPosition: 2,
+				IsNullable: true, NullRate: 0.25, AllowedValues: []string{"1", "true", "null", ""},
+				ValueCounts: map[string]int64{"1": 3, "true": 4},
+				Processors: []ProcessorDefinition{{Name: "EnumRandom", Min: 1.5, Exemptions: "^(a|b)$",
+					Params: map[string]interface{}{"Distribution": "observed"}}},
+				OnError: &ErrorPolicy{Action: OnErrorNull}},
+		},
+	}
+}
+
+func TestMapFormatRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gonymizer-map")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"map.json", "map.yaml", "map.toml"} {
+		path := filepath.Join(dir, name)
+		require.Nil(t, WriteConfigSkeleton(formatTestMap(), path))
+
+		dbMap, err := ReadConfigSkeleton(path)
+		require.Nil(t, err, name)
+		dbMap.source = nil
+		require.Equal(t, formatTestMap(), dbMap, name)
+	}
+}
+
+func TestMapFormatYAMLComments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gonymizer-map")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "map.yaml")
+	require.Nil(t, ioutil.WriteFile(path, []byte(`# map of the test database
+DBName: test
+Seed: 42
+ColumnMaps:
+  - TableSchema: public
+    TableName: users
+    ColumnName: nickname
+    DataType: text
+    Processors:
+      - Name: FakeFirstName
+  # kept as it is, ids are not personal data
+  - TableSchema: public
+    TableName: users
+    ColumnName: id
+    DataType: integer
+    Processors:
+      - Name: Identity # reviewed
+`), 0644))
+
+	existing, err := ReadConfigSkeleton(path)
+	require.Nil(t, err)
+	require.Equal(t, "Identity", existing.ColumnMaps[1].Processors[0].Name)
+
+	generated := &DBMapper{DBName: "test", ColumnMaps: []ColumnMapper{
+		{TableSchema: "public", TableName: "users", ColumnName: "id", DataType: "bigint"},
+		{TableSchema: "public", TableName: "users", ColumnName: "email", DataType: "text"},
+	}}
+	merged, _ := MergeConfigSkeleton(existing, generated)
+
+	skeleton := filepath.Join(dir, "map.skeleton.yaml")
+	require.Nil(t, WriteConfigSkeleton(merged, skeleton))
+	data, err := ioutil.ReadFile(skeleton)
+	require.Nil(t, err)
+	require.Contains(t, string(data), "# map of the test database\nDBName: test\n")
+	require.Contains(t, string(data), "  # kept as it is, ids are not personal data\n  - Comment: \"\"\n")
+	require.Contains(t, string(data), "      - Name: Identity # reviewed\n")
+	require.Contains(t, string(data), "    DataType: bigint\n")
+	require.NotContains(t, string(data), "nickname")
+}
@@ -2,14 +2,16 @@ package gonymizer
 
 import (
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 )
 
 // ProcessorDefinition is the processor data structure used to map database columns to their specified column processor.
@@ -21,10 +23,31 @@ type ProcessorDefinition struct {
 	Min      float64
 	Variance float64
 
-	// values that match this regex will not be anonymized
+	// values that match this regex are not changed by this processor and are passed on to the next one
 	Exemptions string
 
+	// values that match Exemptions also skip the remaining processors of the column
+	ShortCircuit bool `json:",omitempty"`
+
+	// what to do with a value this processor fails on, overrides the column's OnError
+	OnError *ErrorPolicy `json:",omitempty"`
+
+	// processors applied to parts of structured values, keyed by hstore key (HstoreKeys) or XPath (XmlPaths)
+	SubProcessors map[string][]ProcessorDefinition `json:",omitempty"`
+
+	// locale used by the Fake* processors, overrides the table and DBMapper locale
+	Locale string `json:",omitempty"`
+
+	// processor specific parameters, decoded into the processor's config when the map file is loaded
+	Params map[string]interface{} `json:",omitempty"`
+
 	Comment string
+
+	// constructed when the map file is loaded, see constructProcessors
+	pfunc      ProcessorFunc
+	batch      BatchProcessorFunc
+	row        RowProcessorFunc
+	exemptions *regexp.Regexp
 }
 
 // ColumnMapper is the data structure that contains all gonymizer required information for the specified column.
@@ -39,9 +62,61 @@ type ColumnMapper struct {
 	ParentColumn    string
 	OrdinalPosition int
 
+	// columns of a foreign key with more than one, and the columns of the parent table they reference in the same
+	// order, so the column can be kept consistent with its parent on the whole key
+	ForeignKeyColumns []string `json:",omitempty"`
+	ParentColumns     []string `json:",omitempty"`
+
 	IsNullable bool
 
+	// fraction of values, between 0 and 1, that are replaced with NULL. Values that are NULL stay NULL
+	NullRate float64 `json:",omitempty"`
+
+	// NULL values are given to the processors instead of being kept, I.E. to fake values where there were none
+	ProcessNulls bool `json:",omitempty"`
+
+	// name of the type of USER-DEFINED columns, I.E. geography or an enum, since the DataType does not tell them apart
+	UdtName string `json:",omitempty"`
+
+	// limits of character and numeric data types, used to check that processor outputs fit the column
+	CharacterMaximumLength int `json:",omitempty"`
+	NumericPrecision       int `json:",omitempty"`
+	NumericScale           int `json:",omitempty"`
+
+	// values allowed by the column's enum type or IN-list CHECK constraint, and optionally how often each one is used
+	AllowedValues []string         `json:",omitempty"`
+	ValueCounts   map[string]int64 `json:",omitempty"`
+
 	Processors []ProcessorDefinition
+
+	// what to do with a value a processor fails on, the run stops if it is not set
+	OnError *ErrorPolicy `json:",omitempty"`
+
+	// locale inherited from the table or DBMapper, see resolveLocales
+	locale string
+
+	// copied from the DBMapper, see resolveChaining
+	legacyChaining bool
+}
+
+// TableMapper contains the settings that apply to every column of a table, and which of its rows are kept.
+type TableMapper struct {
+	TableSchema string
+	TableName   string
+	Locale      string `json:",omitempty"`
+
+	// which rows are kept, see TableRowsAll, TableRowsNone and TableRowsSchema
+	Rows string `json:",omitempty"`
+
+	// rows are only kept if this expression is true for them, I.E. row.country == "US"
+	Where string `json:",omitempty"`
+
+	// number of rows kept, the first ones unless Sample is random
+	Limit  int64  `json:",omitempty"`
+	Sample string `json:",omitempty"`
+
+	// compiled Where, see validateTables
+	where exprNode
 }
 
 // DBMapper is the main structure for the map file JSON object and is used to map all database columns that will be
@@ -50,11 +125,35 @@ type DBMapper struct {
 	DBName       string
 	SchemaPrefix string
 	Seed         int64
-	ColumnMaps   []ColumnMapper
+	Locale       string        `json:",omitempty"`
+	Tables       []TableMapper `json:",omitempty"`
+
+	// LegacyChaining restores the processor chaining of older releases for maps that depend on it: every processor
+	// receives the original value, so only the last one has an effect, and a value that matches any Exemptions is not
+	// anonymized at all.
+	LegacyChaining bool `json:",omitempty"`
+
+	// map files whose columns, rules and tables are merged into this one, see ResolveConfigSkeleton
+	Includes []string `json:",omitempty"`
+
+	// Rules apply settings to every column that matches their patterns, see ColumnRule
+	Rules []ColumnRule `json:",omitempty"`
+
+	// root tables of a subset of the database that dump copies instead of all of it, see SubsetRoot
+	Subset []SubsetRoot `json:",omitempty"`
+
+	ColumnMaps []ColumnMapper
+
+	// rules in order of precedence and the columns resolved through them, see validateRules
+	rules *ruleIndex
+
+	// the YAML document the map was read from, whose comments are written back by WriteConfigSkeleton
+	source *yaml.Node
 }
 
 // ColumnMapper returns the address of the ColumnMapper object if it matches the given parameters otherwise it returns
-// nil. Special cases exist for sharded schemas using the schema-prefix. See documentation for details.
+// nil. Special cases exist for sharded schemas using the schema-prefix. See documentation for details. Columns are
+// resolved through the Rules of the map, see ColumnRule.
 func (dbMap DBMapper) ColumnMapper(schemaName, tableName, columnName string) *ColumnMapper {
 
 	// Some names may contain quotes if the name is a reserved word. For example tableName public.order would be a
@@ -64,6 +163,20 @@ func (dbMap DBMapper) ColumnMapper(schemaName, tableName, columnName string) *Co
 	tableName = strings.Replace(tableName, "\"", "", -1)
 	columnName = strings.Replace(columnName, "\"", "", -1)
 
+	if dbMap.rules == nil {
+		return dbMap.exactColumnMapper(schemaName, tableName, columnName)
+	}
+	key := schemaName + "." + tableName + "." + columnName
+	if cmap, ok := dbMap.rules.resolved.Load(key); ok {
+		return cmap.(*ColumnMapper)
+	}
+	cmap, _ := dbMap.resolveColumn(schemaName, tableName, columnName)
+	dbMap.rules.resolved.Store(key, cmap)
+	return cmap
+}
+
+// exactColumnMapper returns the entry of ColumnMaps for a column, or nil if it has none.
+func (dbMap DBMapper) exactColumnMapper(schemaName, tableName, columnName string) *ColumnMapper {
 	for _, cmap := range dbMap.ColumnMaps {
 		//log.Infoln("dbMap.SchemaPrefix-> ", dbMap.SchemaPrefix)
 		//log.Infoln("schemaName-> ", schemaName)
@@ -78,20 +191,145 @@ func (dbMap DBMapper) ColumnMapper(schemaName, tableName, columnName string) *Co
 	return nil
 }
 
+// resolveChaining copies LegacyChaining to every ColumnMapper so it is available while processing values.
+func (dbMap *DBMapper) resolveChaining() {
+	for i := range dbMap.ColumnMaps {
+		dbMap.ColumnMaps[i].legacyChaining = dbMap.LegacyChaining
+	}
+}
+
 // Validate is used to verify that a database map is complete and correct.
 func (dbMap *DBMapper) Validate() error {
 	if len(dbMap.DBName) == 0 {
 		return errors.New("Expected non-empty DBName")
 	}
+	if err := dbMap.validateLocales(); err != nil {
+		return err
+	}
 	// Ensure that each processor is defined
 	for _, columnMap := range dbMap.ColumnMaps {
-		for _, processor := range columnMap.Processors {
-			if _, ok := ProcessorCatalog[processor.Name]; !ok {
-				return fmt.Errorf("Unrecognized Processor %s", processor.Name)
+		path := fmt.Sprintf("%s.%s.%s Processors", columnMap.TableSchema, columnMap.TableName, columnMap.ColumnName)
+		if err := validateProcessors(path, columnMap.Processors); err != nil {
+			return err
+		}
+		if err := validateOutputTypes(path, columnMap); err != nil {
+			return err
+		}
+		if err := validateOrderedRanges(path, columnMap); err != nil {
+			return err
+		}
+		columnPath := fmt.Sprintf("%s.%s.%s", columnMap.TableSchema, columnMap.TableName, columnMap.ColumnName)
+		if err := validateNulls(columnPath, columnMap); err != nil {
+			return err
+		}
+		if err := validateEnums(columnPath, columnMap); err != nil {
+			return err
+		}
+		if err := validateForeignKeyColumns(columnPath, columnMap); err != nil {
+			return err
+		}
+		if columnMap.OnError != nil {
+			onErrorPath := fmt.Sprintf("%s.%s.%s OnError", columnMap.TableSchema, columnMap.TableName, columnMap.ColumnName)
+			if err := validateErrorPolicy(onErrorPath, columnMap.OnError, columnMap.IsNullable); err != nil {
+				return err
+			}
+		}
+		for i, processor := range columnMap.Processors {
+			if processor.OnError != nil {
+				onErrorPath := fmt.Sprintf("%s[%d].OnError", path, i)
+				if err := validateErrorPolicy(onErrorPath, processor.OnError, columnMap.IsNullable); err != nil {
+					return err
+				}
 			}
 		}
 	}
 
+	if err := dbMap.validateTables(); err != nil {
+		return err
+	}
+	if err := dbMap.validateSubset(); err != nil {
+		return err
+	}
+	return dbMap.validateRules()
+}
+
+// validateForeignKeyColumns checks that the columns of a foreign key with more than one pair up with the ones of its
+// parent, with the column and its ParentColumn at the same position.
+func validateForeignKeyColumns(path string, columnMap ColumnMapper) error {
+	if len(columnMap.ForeignKeyColumns) == 0 && len(columnMap.ParentColumns) == 0 {
+		return nil
+	}
+	if len(columnMap.ForeignKeyColumns) != len(columnMap.ParentColumns) {
+		return fmt.Errorf("%s: ForeignKeyColumns and ParentColumns must have the same length", path)
+	}
+	for i, column := range columnMap.ForeignKeyColumns {
+		if column == columnMap.ColumnName && columnMap.ParentColumns[i] == columnMap.ParentColumn {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: ForeignKeyColumns must pair the column with its ParentColumn %s", path,
+		columnMap.ParentColumn)
+}
+
+// validateProcessors checks that each processor, and any of its sub-processors, is registered and that its parameters
+// match the processor's schema. Errors are prefixed with the path and index of the processor.
+func validateProcessors(path string, processors []ProcessorDefinition) error {
+	for i, processor := range processors {
+		procPath := fmt.Sprintf("%s[%d]", path, i)
+		if err := validateProcessorDefinition(processor); err != nil {
+			return fmt.Errorf("%s: %s", procPath, err)
+		}
+		for _, key := range sortedSubProcessorKeys(processor.SubProcessors) {
+			subPath := fmt.Sprintf("%s.SubProcessors[%q]", procPath, key)
+			if err := validateProcessors(subPath, processor.SubProcessors[key]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// constructProcessors creates the processor instance of every ProcessorDefinition, including sub-processors, so
+// parameters are parsed once when the map file is loaded instead of on every value.
+func constructProcessors(processors []ProcessorDefinition) error {
+	for i := range processors {
+		procDef := &processors[i]
+		info, ok := LookupProcessor(procDef.Name)
+		if !ok {
+			return fmt.Errorf("Unrecognized Processor %s", procDef.Name)
+		}
+		pfunc, err := info.New(*procDef)
+		if err != nil {
+			return fmt.Errorf("Processor %s: %s", procDef.Name, err)
+		}
+		procDef.pfunc = pfunc
+		if info.NewBatch != nil {
+			if procDef.batch, err = info.NewBatch(*procDef); err != nil {
+				return fmt.Errorf("Processor %s: %s", procDef.Name, err)
+			}
+		}
+		if info.NewRow != nil {
+			if procDef.row, err = info.NewRow(*procDef); err != nil {
+				return fmt.Errorf("Processor %s: %s", procDef.Name, err)
+			}
+		}
+
+		if procDef.Exemptions != "" {
+			if procDef.exemptions, err = regexp.Compile(procDef.Exemptions); err != nil {
+				return err
+			}
+		}
+		for _, subProcessors := range procDef.SubProcessors {
+			if err := constructProcessors(subProcessors); err != nil {
+				return err
+			}
+		}
+		if procDef.OnError != nil {
+			if err := constructProcessors(procDef.OnError.Fallback); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -126,12 +364,24 @@ func GenerateConfigSkeleton(conf PGConfig, schemaPrefix string, schemas, exclude
 		}
 	}
 	dbmap.ColumnMaps = columnMap
+
+	if err = captureAllowedValues(db, dbmap.ColumnMaps); err != nil {
+		return nil, err
+	}
 	return dbmap, nil
 }
 
-// WriteConfigSkeleton will save the supplied DBMap to filepath.
+// WriteConfigSkeleton will save the supplied DBMap to filepath. The format of the file, JSON, YAML or TOML, is picked
+// by its extension, see MapFormat. Maps read from a YAML file keep its comments.
 func WriteConfigSkeleton(dbmap *DBMapper, filepath string) error {
 
+	data, err := encodeMap(dbmap, MapFormat(filepath))
+	if err != nil {
+		log.Error(err)
+		log.Error("filepath", filepath)
+		return err
+	}
+
 	f, err := os.Create(filepath)
 	if err != nil {
 		log.Error("Failure to open file: ", err)
@@ -140,11 +390,7 @@ func WriteConfigSkeleton(dbmap *DBMapper, filepath string) error {
 	}
 	defer f.Close()
 
-	jsonEncoder := json.NewEncoder(f)
-	jsonEncoder.SetIndent("", "    ")
-
-	err = jsonEncoder.Encode(dbmap)
-	if err != nil {
+	if _, err = f.Write(data); err != nil {
 		log.Error(err)
 		log.Error("filepath", filepath)
 		return err
@@ -154,7 +400,53 @@ func WriteConfigSkeleton(dbmap *DBMapper, filepath string) error {
 }
 
 // LoadConfigSkeleton will load the column-map into memory for use in dumping, processing, and loading of SQL files.
-func LoadConfigSkeleton(givenPathToFile string) (*DBMapper, error) {
+// The fragments the map includes are merged into it and the overlays are applied, see ResolveConfigSkeleton.
+func LoadConfigSkeleton(givenPathToFile string, overlays ...string) (*DBMapper, error) {
+	dbmap, err := ResolveConfigSkeleton(givenPathToFile, overlays...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = dbmap.Validate()
+	if err != nil {
+		log.Error(err)
+		log.Error("dbmap: ", dbmap)
+		return nil, err
+	}
+	dbmap.resolveLocales()
+	dbmap.resolveChaining()
+
+	for i := range dbmap.Rules {
+		if err = constructProcessors(dbmap.Rules[i].Processors); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		if onError := dbmap.Rules[i].OnError; onError != nil {
+			if err = constructProcessors(onError.Fallback); err != nil {
+				log.Error(err)
+				return nil, err
+			}
+		}
+	}
+	for i := range dbmap.ColumnMaps {
+		if err = constructProcessors(dbmap.ColumnMaps[i].Processors); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		if onError := dbmap.ColumnMaps[i].OnError; onError != nil {
+			if err = constructProcessors(onError.Fallback); err != nil {
+				log.Error(err)
+				return nil, err
+			}
+		}
+	}
+
+	return dbmap, nil
+}
+
+// ReadConfigSkeleton reads a map file without validating it or constructing its processors, I.E. to update it. The
+// format of the file, JSON, YAML or TOML, is picked by its extension, see MapFormat.
+func ReadConfigSkeleton(givenPathToFile string) (*DBMapper, error) {
 	pathToFile := givenPathToFile
 
 	f, err := os.Open(pathToFile)
@@ -166,22 +458,18 @@ func LoadConfigSkeleton(givenPathToFile string) (*DBMapper, error) {
 	}
 	defer f.Close()
 
-	jsonDecoder := json.NewDecoder(f)
-
-	dbmap := new(DBMapper)
-	err = jsonDecoder.Decode(dbmap)
+	data, err := ioutil.ReadAll(f)
 	if err != nil {
 		log.Error(err)
 		log.Error("givenPathToFile: ", givenPathToFile)
-		log.Error("pathToFile: ", pathToFile)
-		log.Error("f: ", f)
 		return nil, err
 	}
 
-	err = dbmap.Validate()
+	dbmap, err := decodeMap(data, MapFormat(pathToFile))
 	if err != nil {
 		log.Error(err)
-		log.Error("dbmap: ", dbmap)
+		log.Error("givenPathToFile: ", givenPathToFile)
+		log.Error("pathToFile: ", pathToFile)
 		return nil, err
 	}
 
@@ -208,16 +496,31 @@ func findColumn(columns []ColumnMapper, columnName, tableName, schemaPrefix, sch
 	return ColumnMapper{}
 }
 
-// addColumn creates a ColumnMapper structure based on the input parameters.
+// addColumn creates a ColumnMapper structure based on the input parameters. foreignKeys are the foreign keys of the
+// table: a column that is in more than one references the parent of the first one with a single column, or else of the
+// first one.
 func addColumn(columnName, tableName, schema, dataType string, ordinalPosition int,
-	isNullable bool, relationRows []map[string]interface{}) ColumnMapper {
+	isNullable bool, foreignKeys []ForeignKey) ColumnMapper {
 	col := ColumnMapper{}
 
-	for _, value := range relationRows {
-		if value["table_name"] == tableName && value["column_name"] == columnName && value["table_schema"] == schema {
-			col.ParentTable = value["foreign_table_name"].(string)
-			col.ParentColumn = value["foreign_column_name"].(string)
-			col.ParentSchema = value["table_schema"].(string)
+	var parent *ForeignKey
+	parentColumn := ""
+	for i, fk := range foreignKeys {
+		for j, column := range fk.Columns {
+			if column != columnName || (parent != nil && (len(parent.Columns) == 1 || len(fk.Columns) > 1)) {
+				continue
+			}
+			parent = &foreignKeys[i]
+			parentColumn = fk.ParentColumns[j]
+		}
+	}
+	if parent != nil {
+		col.ParentSchema = parent.ParentSchema
+		col.ParentTable = parent.ParentTable
+		col.ParentColumn = parentColumn
+		if len(parent.Columns) > 1 {
+			col.ForeignKeyColumns = parent.Columns
+			col.ParentColumns = parent.ParentColumns
 		}
 	}
 
@@ -236,6 +539,29 @@ func addColumn(columnName, tableName, schema, dataType string, ordinalPosition i
 	return col
 }
 
+// tableForeignKeys returns the foreign keys of a table.
+func tableForeignKeys(foreignKeys []ForeignKey, schemaName, tableName string) []ForeignKey {
+	var keys []ForeignKey
+	for _, fk := range foreignKeys {
+		if fk.TableSchema == schemaName && fk.TableName == tableName {
+			keys = append(keys, fk)
+		}
+	}
+	return keys
+}
+
+// setTypeLimits stores the length limit of character columns and the precision and scale of numeric columns. The
+// precision of integer and floating point columns is in bits and is not stored.
+func (col *ColumnMapper) setTypeLimits(maxLength, precision, scale sql.NullInt64) {
+	if maxLength.Valid {
+		col.CharacterMaximumLength = int(maxLength.Int64)
+	}
+	if col.DataType == "numeric" && precision.Valid {
+		col.NumericPrecision = int(precision.Int64)
+		col.NumericScale = int(scale.Int64)
+	}
+}
+
 func ProcessRowToMap(rows *sql.Rows) []map[string]interface{} {
 	returnedColumns, err := rows.Columns()
 
@@ -340,29 +666,16 @@ func mapColumns(db *sql.DB, columns []ColumnMapper, schemaPrefix, schema string,
 		rows, err = GetSchemaColumnEquals(db, schema)
 
 	}
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	tablesNameRow, err := GetTablesName(db)
-
-	var tableName string
-	tableCollectionString := ""
-
-	for tablesNameRow.Next() {
-		err = tablesNameRow.Scan(
-			&tableName,
-		)
-
-		tableCollectionString = tableCollectionString + "'" + tableName + "',"
+	foreignKeys, err := GetForeignKeys(db)
+	if err != nil {
+		return nil, err
 	}
 
-	tableCollectionString = "(" + tableCollectionString[:len(tableCollectionString)-1] + ")"
-	defer tablesNameRow.Close()
-
-	relationRows, err := GetRelationalColumns(db, tableCollectionString)
-
-	defer relationRows.Close()
-
-	processedRowToMap := ProcessRowToMap(relationRows)
 	log.Debug("Iterating through rows and creating skeleton map")
 	for {
 		var (
@@ -373,6 +686,10 @@ func mapColumns(db *sql.DB, columns []ColumnMapper, schemaPrefix, schema string,
 			dataType        string
 			ordinalPosition int
 			isNullable      bool
+			maxLength       sql.NullInt64
+			precision       sql.NullInt64
+			scale           sql.NullInt64
+			udtName         string
 			exclude         bool
 			col             ColumnMapper
 		)
@@ -387,20 +704,26 @@ func mapColumns(db *sql.DB, columns []ColumnMapper, schemaPrefix, schema string,
 				&dataType,
 				&ordinalPosition,
 				&isNullable,
+				&maxLength,
+				&precision,
+				&scale,
+				&udtName,
 			)
 
 			// If we are working on a schema prefix, make sure to use the schema prefix + * as a name, otherwise empty
+			liveSchema := tableSchema
 			if prefixPresent {
 				tableSchema = schemaPrefix + "*"
 			} else {
 				schemaPrefix = ""
 			}
 
-			// check to see if table is in the list of skipped tables or data for the table (leave them out of map)
+			// check to see if table is in the list of skipped tables or data for the table (leave them out of map). Like
+			// pg_dump, a table name without a schema excludes the table in every schema
 			exclude = false
 			for _, item := range excludeTables {
-				schemaTableName := fmt.Sprintf("%s.%s", tableSchema, tableName)
-				if schemaTableName == item {
+				if item == tableName || item == fmt.Sprintf("%s.%s", tableSchema, tableName) ||
+					item == fmt.Sprintf("%s.%s", liveSchema, tableName) {
 					exclude = true
 					break
 				}
@@ -409,11 +732,26 @@ func mapColumns(db *sql.DB, columns []ColumnMapper, schemaPrefix, schema string,
 				continue
 			}
 
+			// when all schemas are mapped the columns are in the schema of their table
+			columnSchema := schema
+			if columnSchema == "" {
+				columnSchema = tableSchema
+			}
+
 			// Search for columnName in columns, if the column exists in the dbmap leave as-is otherwise create a new one and
 			// add to the column map
-			col = findColumn(columns, columnName, tableName, schemaPrefix, schema, dataType)
+			col = findColumn(columns, columnName, tableName, schemaPrefix, columnSchema, dataType)
 			if col.TableSchema == "" && col.ColumnName == "" {
-				col = addColumn(columnName, tableName, schema, dataType, ordinalPosition, isNullable, processedRowToMap)
+				col = addColumn(columnName, tableName, columnSchema, dataType, ordinalPosition, isNullable,
+					tableForeignKeys(foreignKeys, liveSchema, tableName))
+				// parents in the same group of schemas are in all of them, like the column
+				if prefixPresent && strings.HasPrefix(col.ParentSchema, schemaPrefix) {
+					col.ParentSchema = schemaPrefix + "*"
+				}
+				col.setTypeLimits(maxLength, precision, scale)
+				if dataType == "USER-DEFINED" {
+					col.UdtName = udtName
+				}
 				// Continuously append into the column map (old and new together)
 				columns = append(columns, col)
 			}
@@ -37,3 +37,40 @@ func TestLoadConfigSkeleton(t *testing.T) {
 	_, err = LoadConfigSkeleton("/dev/null")
 	require.NotNil(t, err)
 }
+
+func TestAddColumn(t *testing.T) {
+	foreignKeys := []ForeignKey{
+		{Name: "items_product_fkey", TableSchema: "public", TableName: "items",
+			Columns: []string{"product_id", "product_version"}, ParentSchema: "catalog", ParentTable: "products",
+			ParentColumns: []string{"id", "version"}},
+		{Name: "items_product_id_fkey", TableSchema: "public", TableName: "items", Columns: []string{"product_id"},
+			ParentSchema: "catalog", ParentTable: "current_products", ParentColumns: []string{"id"}},
+	}
+
+	// the parent of a foreign key with a single column is preferred
+	col := addColumn("product_id", "items", "public", "integer", 2, false, foreignKeys)
+	require.Equal(t, "catalog", col.ParentSchema)
+	require.Equal(t, "current_products", col.ParentTable)
+	require.Equal(t, "id", col.ParentColumn)
+	require.Nil(t, col.ForeignKeyColumns)
+
+	// the column is paired with the parent column at its position of the foreign key
+	col = addColumn("product_version", "items", "public", "integer", 3, false, foreignKeys)
+	require.Equal(t, "catalog", col.ParentSchema)
+	require.Equal(t, "products", col.ParentTable)
+	require.Equal(t, "version", col.ParentColumn)
+	require.Equal(t, []string{"product_id", "product_version"}, col.ForeignKeyColumns)
+	require.Equal(t, []string{"id", "version"}, col.ParentColumns)
+	require.Nil(t, validateForeignKeyColumns("public.items.product_version", col))
+
+	col = addColumn("quantity", "items", "public", "integer", 4, false, foreignKeys)
+	require.Equal(t, "", col.ParentTable)
+
+	col.ColumnName = "product_version"
+	col.ForeignKeyColumns = []string{"product_id", "product_version"}
+	col.ParentColumns = []string{"id"}
+	require.NotNil(t, validateForeignKeyColumns("public.items.product_version", col))
+	col.ParentColumns = []string{"id", "version"}
+	col.ParentColumn = "id"
+	require.NotNil(t, validateForeignKeyColumns("public.items.product_version", col))
+}
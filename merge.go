@@ -0,0 +1,198 @@
+package gonymizer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of MapChange
+const (
+	MapColumnAdded       = "added"
+	MapColumnRemoved     = "removed"
+	MapColumnRenamed     = "renamed"
+	MapColumnTypeChanged = "type changed"
+)
+
+// MapChange is a difference between a map file and the database it maps, found by MergeConfigSkeleton.
+type MapChange struct {
+	Kind   string
+	Column string
+
+	// the column's name in the map for renamed columns, and its data type in the map for changed types
+	Previous string
+	Current  string
+}
+
+// String returns a line of the diff for the change.
+func (change MapChange) String() string {
+	switch change.Kind {
+	case MapColumnAdded:
+		return fmt.Sprintf("+ %s (%s)", change.Column, change.Current)
+	case MapColumnRemoved:
+		return fmt.Sprintf("- %s (%s)", change.Column, change.Previous)
+	case MapColumnRenamed:
+		return fmt.Sprintf("> %s renamed from %s", change.Column, change.Previous)
+	default:
+		return fmt.Sprintf("~ %s %s -> %s", change.Column, change.Previous, change.Current)
+	}
+}
+
+// columnKey identifies a column of a map.
+func columnKey(cmap ColumnMapper) string {
+	return fmt.Sprintf("%s.%s.%s", cmap.TableSchema, cmap.TableName, cmap.ColumnName)
+}
+
+// columnType returns the data type of a column with its length, precision and scale, I.E. character varying(50).
+func columnType(cmap ColumnMapper) string {
+	switch {
+	case cmap.CharacterMaximumLength > 0:
+		return fmt.Sprintf("%s(%d)", cmap.DataType, cmap.CharacterMaximumLength)
+	case cmap.NumericPrecision > 0:
+		return fmt.Sprintf("%s(%d,%d)", cmap.DataType, cmap.NumericPrecision, cmap.NumericScale)
+	}
+	return cmap.DataType
+}
+
+// sameColumnType returns true if a column of the map has the data type of the column in the database. Maps written
+// before the limits of the data types were captured only have the DataType, which is all that is compared then.
+func sameColumnType(mapped, live ColumnMapper) bool {
+	if mapped.CharacterMaximumLength == 0 && mapped.NumericPrecision == 0 && mapped.NumericScale == 0 {
+		return mapped.DataType == live.DataType
+	}
+	return columnType(mapped) == columnType(live)
+}
+
+// MergeConfigSkeleton updates an existing map with the columns of a map generated from the database. The settings of
+// the existing map and the processors, comments and other settings of its columns are kept, while the data types,
+// positions, nullability and relationships of the columns come from the database. Columns that are new are added at the
+// end of the map and columns that are no longer in the database are left out. Columns of schemas that are not in the
+// generated map, I.E. because only some of the schemas were mapped, are kept as they are. New columns that a rule of
+// the map applies to are added without processors, since the processors of an entry take precedence over the rules.
+// A new column in the same table and position, and of the same type, as a column that is gone is taken to be the
+// column renamed and keeps its settings. The returned changes are in the order of the merged map, followed by the
+// removed columns.
+func MergeConfigSkeleton(existing, generated *DBMapper) (*DBMapper, []MapChange) {
+	merged := *existing
+	merged.ColumnMaps = make([]ColumnMapper, 0, len(generated.ColumnMaps))
+
+	current := make(map[string]ColumnMapper, len(generated.ColumnMaps))
+	mapped := make(map[string]bool)
+	for _, col := range generated.ColumnMaps {
+		current[columnKey(col)] = col
+		mapped[col.TableSchema] = true
+	}
+	previous := make(map[string]bool, len(existing.ColumnMaps))
+	for _, col := range existing.ColumnMaps {
+		previous[columnKey(col)] = true
+	}
+
+	// columns that are gone may have been renamed to one of the new columns
+	renamedTo := make(map[string]ColumnMapper)
+	claimed := make(map[string]bool)
+	for _, col := range existing.ColumnMaps {
+		if _, ok := current[columnKey(col)]; ok {
+			continue
+		}
+		for _, candidate := range generated.ColumnMaps {
+			key := columnKey(candidate)
+			if previous[key] || claimed[key] {
+				continue
+			}
+			if candidate.TableSchema == col.TableSchema && candidate.TableName == col.TableName &&
+				candidate.OrdinalPosition == col.OrdinalPosition && candidate.DataType == col.DataType {
+				renamedTo[columnKey(col)] = candidate
+				claimed[key] = true
+				break
+			}
+		}
+	}
+
+	var changes, removed []MapChange
+	for _, col := range existing.ColumnMaps {
+		key := columnKey(col)
+		if !mapped[col.TableSchema] {
+			merged.ColumnMaps = append(merged.ColumnMaps, col)
+			continue
+		}
+		live, ok := current[key]
+		if !ok {
+			if live, ok = renamedTo[key]; !ok {
+				removed = append(removed, MapChange{Kind: MapColumnRemoved, Column: key, Previous: columnType(col)})
+				continue
+			}
+			changes = append(changes, MapChange{Kind: MapColumnRenamed, Column: columnKey(live), Previous: key})
+		}
+
+		if !sameColumnType(col, live) {
+			changes = append(changes, MapChange{
+				Kind:     MapColumnTypeChanged,
+				Column:   columnKey(live),
+				Previous: columnType(col),
+				Current:  columnType(live),
+			})
+		}
+		merged.ColumnMaps = append(merged.ColumnMaps, mergeColumn(col, live))
+	}
+
+	// the rules of the map are compiled on a copy, rules that do not compile are reported when the map is validated
+	ruled := DBMapper{Rules: make([]ColumnRule, 0, len(existing.Rules))}
+	for _, rule := range existing.Rules {
+		if rule.compile() == nil {
+			ruled.Rules = append(ruled.Rules, rule)
+		}
+	}
+	ruled.indexRules()
+
+	for _, col := range generated.ColumnMaps {
+		key := columnKey(col)
+		if previous[key] || claimed[key] {
+			continue
+		}
+		if ruled.matchRule(col.TableSchema, col.TableName, col.ColumnName, col.DataType) >= 0 {
+			col.Processors = nil
+		}
+		changes = append(changes, MapChange{Kind: MapColumnAdded, Column: key, Current: columnType(col)})
+		merged.ColumnMaps = append(merged.ColumnMaps, col)
+	}
+
+	return &merged, append(changes, removed...)
+}
+
+// mergeColumn returns the column of the database with the settings of the column of the map.
+func mergeColumn(configured, live ColumnMapper) ColumnMapper {
+	merged := configured
+	merged.TableSchema = live.TableSchema
+	merged.TableName = live.TableName
+	merged.ColumnName = live.ColumnName
+	merged.DataType = live.DataType
+	merged.UdtName = live.UdtName
+	merged.OrdinalPosition = live.OrdinalPosition
+	merged.IsNullable = live.IsNullable
+	merged.CharacterMaximumLength = live.CharacterMaximumLength
+	merged.NumericPrecision = live.NumericPrecision
+	merged.NumericScale = live.NumericScale
+	merged.AllowedValues = live.AllowedValues
+
+	// counts are only captured on request, keep the ones of the map otherwise
+	if live.ValueCounts != nil {
+		merged.ValueCounts = live.ValueCounts
+	}
+	if live.ParentTable != "" {
+		merged.ParentSchema = live.ParentSchema
+		merged.ParentTable = live.ParentTable
+		merged.ParentColumn = live.ParentColumn
+		merged.ForeignKeyColumns = live.ForeignKeyColumns
+		merged.ParentColumns = live.ParentColumns
+	}
+	return merged
+}
+
+// FormatMapChanges returns a human-readable diff of the changes, one line per change.
+func FormatMapChanges(changes []MapChange) string {
+	var b strings.Builder
+	for _, change := range changes {
+		b.WriteString(change.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
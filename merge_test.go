@@ -0,0 +1,160 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeConfigSkeleton(t *testing.T) {
+	existing := &DBMapper{
+		DBName: "test",
+		Seed:   42,
+		ColumnMaps: []ColumnMapper{
+			{TableSchema: "public", TableName: "users", ColumnName: "id", DataType: "integer", OrdinalPosition: 1,
+				Processors: []ProcessorDefinition{{Name: "Identity"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "mail", DataType: "text", OrdinalPosition: 2,
+				Comment: "hand written", Processors: []ProcessorDefinition{{Name: "FakeEmailAddress"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "zip", DataType: "character varying",
+				CharacterMaximumLength: 5, OrdinalPosition: 3, Processors: []ProcessorDefinition{{Name: "FakeZip"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "fax", DataType: "text", OrdinalPosition: 4,
+				Processors: []ProcessorDefinition{{Name: "FakePhoneNumber"}}},
+		},
+	}
+	generated := &DBMapper{
+		DBName: "test",
+		ColumnMaps: []ColumnMapper{
+			{TableSchema: "public", TableName: "users", ColumnName: "id", DataType: "bigint", OrdinalPosition: 1,
+				Processors: []ProcessorDefinition{{Name: "Identity"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "email", DataType: "text", OrdinalPosition: 2,
+				IsNullable: true, Processors: []ProcessorDefinition{{Name: "Identity"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "zip", DataType: "character varying",
+				CharacterMaximumLength: 10, OrdinalPosition: 3, Processors: []ProcessorDefinition{{Name: "Identity"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "phone", DataType: "text", OrdinalPosition: 5,
+				Processors: []ProcessorDefinition{{Name: "FakePhoneNumber"}}},
+		},
+	}
+
+	merged, changes := MergeConfigSkeleton(existing, generated)
+	require.Equal(t, int64(42), merged.Seed)
+	require.Len(t, merged.ColumnMaps, 4)
+
+	// the type comes from the database, the processors from the map
+	require.Equal(t, "bigint", merged.ColumnMaps[0].DataType)
+
+	// renamed columns keep their settings
+	require.Equal(t, "email", merged.ColumnMaps[1].ColumnName)
+	require.Equal(t, "hand written", merged.ColumnMaps[1].Comment)
+	require.Equal(t, "FakeEmailAddress", merged.ColumnMaps[1].Processors[0].Name)
+	require.True(t, merged.ColumnMaps[1].IsNullable)
+
+	require.Equal(t, 10, merged.ColumnMaps[2].CharacterMaximumLength)
+	require.Equal(t, "FakeZip", merged.ColumnMaps[2].Processors[0].Name)
+
+	// new columns are added at the end
+	require.Equal(t, "phone", merged.ColumnMaps[3].ColumnName)
+
+	// the existing map is not changed
+	require.Equal(t, "mail", existing.ColumnMaps[1].ColumnName)
+
+	require.Equal(t, []MapChange{
+		{Kind: MapColumnTypeChanged, Column: "public.users.id", Previous: "integer", Current: "bigint"},
+		{Kind: MapColumnRenamed, Column: "public.users.email", Previous: "public.users.mail"},
+		{Kind: MapColumnTypeChanged, Column: "public.users.zip", Previous: "character varying(5)",
+			Current: "character varying(10)"},
+		{Kind: MapColumnAdded, Column: "public.users.phone", Current: "text"},
+		{Kind: MapColumnRemoved, Column: "public.users.fax", Previous: "text"},
+	}, changes)
+
+	require.Equal(t, "~ public.users.id integer -> bigint\n"+
+		"> public.users.email renamed from public.users.mail\n"+
+		"~ public.users.zip character varying(5) -> character varying(10)\n"+
+		"+ public.users.phone (text)\n"+
+		"- public.users.fax (text)\n", FormatMapChanges(changes))
+
+	_, changes = MergeConfigSkeleton(merged, generated)
+	require.Empty(t, changes)
+
+	// columns of maps without the limits of the data types only change type when their DataType does
+	existing.ColumnMaps[2].CharacterMaximumLength = 0
+	_, changes = MergeConfigSkeleton(existing, generated)
+	require.Len(t, changes, 4)
+	require.Equal(t, MapColumnTypeChanged, changes[0].Kind)
+	require.Equal(t, MapColumnRenamed, changes[1].Kind)
+}
+
+func TestMergeConfigSkeletonSchemas(t *testing.T) {
+	existing := &DBMapper{
+		DBName: "test",
+		ColumnMaps: []ColumnMapper{
+			{TableSchema: "public", TableName: "users", ColumnName: "id", DataType: "integer", OrdinalPosition: 1,
+				Processors: []ProcessorDefinition{{Name: "Identity"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "fax", DataType: "text", OrdinalPosition: 2,
+				Processors: []ProcessorDefinition{{Name: "FakePhoneNumber"}}},
+			{TableSchema: "billing", TableName: "cards", ColumnName: "number", DataType: "text", OrdinalPosition: 1,
+				Processors: []ProcessorDefinition{{Name: "ScrubString"}}},
+		},
+	}
+	generated := &DBMapper{
+		DBName: "test",
+		ColumnMaps: []ColumnMapper{
+			{TableSchema: "public", TableName: "users", ColumnName: "id", DataType: "integer", OrdinalPosition: 1,
+				Processors: []ProcessorDefinition{{Name: "Identity"}}},
+		},
+	}
+
+	// only public was mapped, so the columns of billing are kept with their processors
+	merged, changes := MergeConfigSkeleton(existing, generated)
+	require.Len(t, merged.ColumnMaps, 2)
+	require.Equal(t, "id", merged.ColumnMaps[0].ColumnName)
+	require.Equal(t, "billing", merged.ColumnMaps[1].TableSchema)
+	require.Equal(t, "ScrubString", merged.ColumnMaps[1].Processors[0].Name)
+	require.Equal(t, []MapChange{{Kind: MapColumnRemoved, Column: "public.users.fax", Previous: "text"}}, changes)
+}
+
+func TestMergeConfigSkeletonRules(t *testing.T) {
+	existing := &DBMapper{
+		DBName: "test",
+		Rules: []ColumnRule{
+			{Name: "emails", ColumnName: "*email*", Processors: []ProcessorDefinition{{Name: "FakeEmailAddress"}}},
+			{Name: "notes", ColumnName: "note?", DataType: "text", Processors: []ProcessorDefinition{{Name: "FakeParagraph"}}},
+			{Name: "broken", ColumnName: "[phone", Processors: []ProcessorDefinition{{Name: "FakePhoneNumber"}}},
+		},
+		ColumnMaps: []ColumnMapper{
+			{TableSchema: "public", TableName: "users", ColumnName: "id", DataType: "integer", OrdinalPosition: 1,
+				Processors: []ProcessorDefinition{{Name: "Identity"}}},
+		},
+	}
+	generated := &DBMapper{
+		DBName: "test",
+		ColumnMaps: []ColumnMapper{
+			{TableSchema: "public", TableName: "users", ColumnName: "id", DataType: "integer", OrdinalPosition: 1,
+				Processors: []ProcessorDefinition{{Name: "Identity"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "work_email", DataType: "text", OrdinalPosition: 2,
+				Processors: []ProcessorDefinition{{Name: "FakeEmailAddress"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "notes", DataType: "text", OrdinalPosition: 3,
+				Processors: []ProcessorDefinition{{Name: "Identity"}}},
+			{TableSchema: "public", TableName: "users", ColumnName: "notes", DataType: "jsonb", OrdinalPosition: 4,
+				Processors: []ProcessorDefinition{{Name: "Identity"}}},
+		},
+	}
+	generated.ColumnMaps[3].TableName = "events"
+
+	merged, changes := MergeConfigSkeleton(existing, generated)
+	require.Len(t, changes, 3)
+	require.Len(t, merged.ColumnMaps, 4)
+
+	// new columns that a rule applies to are added without processors so the rule is used
+	require.Nil(t, merged.ColumnMaps[1].Processors)
+	require.Nil(t, merged.ColumnMaps[2].Processors)
+	require.Equal(t, "Identity", merged.ColumnMaps[3].Processors[0].Name)
+	require.Len(t, merged.Rules, 3)
+
+	merged.Rules = merged.Rules[:2]
+	require.Nil(t, merged.Validate())
+	resolved, match := merged.resolveColumn("public", "users", "work_email")
+	require.Equal(t, "FakeEmailAddress", resolved.Processors[0].Name)
+	require.Equal(t, 0, match.RuleIndex)
+	resolved, _ = merged.resolveColumn("public", "users", "notes")
+	require.Equal(t, "FakeParagraph", resolved.Processors[0].Name)
+}
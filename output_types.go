@@ -0,0 +1,139 @@
+package gonymizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Processor outputs are checked against the column's DataType before they are written, so values that PostgreSQL would
+// reject when the processed dump is loaded are found while processing instead. Only data types with a simple text form
+// are checked, other data types are written as they are.
+
+var uuidRegex = regexp.MustCompile(
+	`^\{?[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}\}?$`)
+
+// booleanValues are the text values PostgreSQL accepts for a boolean.
+var booleanValues = map[string]bool{
+	"t": true, "true": true, "y": true, "yes": true, "on": true, "1": true,
+	"f": true, "false": true, "n": true, "no": true, "off": true, "0": true,
+}
+
+// outputCategories are the data types whose values can not be any text. Processors that declare which data types they
+// support can never write valid values for these types unless the type is one of them. See validateOutputTypes.
+var outputCategories = map[string]bool{
+	"smallint": true, "integer": true, "bigint": true, "numeric": true, "real": true, "double precision": true,
+	"boolean": true, "uuid": true, "json": true, "jsonb": true, "bytea": true, "inet": true, "xml": true,
+	"date": true, "timestamp without time zone": true, "timestamp with time zone": true,
+	"time without time zone": true, "time with time zone": true, "interval": true,
+}
+
+// checkOutputType returns an error if a COPY escaped output can not be stored in the column.
+func checkOutputType(cmap *ColumnMapper, output string) error {
+	if output == copyNull {
+		return nil
+	}
+	value := unescapeCopyText(output)
+
+	switch cmap.DataType {
+	case "character varying", "character":
+		if cmap.CharacterMaximumLength > 0 {
+			// trailing spaces are silently cut to the length of the column
+			length := utf8.RuneCountInString(strings.TrimRight(value, " "))
+			if length > cmap.CharacterMaximumLength {
+				return fmt.Errorf("%d characters is longer than the column's limit of %d", length,
+					cmap.CharacterMaximumLength)
+			}
+		}
+	case "smallint":
+		return checkInteger(value, 16)
+	case "integer":
+		return checkInteger(value, 32)
+	case "bigint":
+		return checkInteger(value, 64)
+	case "numeric":
+		return checkNumeric(value, cmap.NumericPrecision, cmap.NumericScale)
+	case "real", "double precision":
+		if _, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil && !isSpecialFloat(value) {
+			return fmt.Errorf("%q is not a floating point number", value)
+		}
+	case "boolean":
+		if !booleanValues[strings.ToLower(strings.TrimSpace(value))] {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+	case "uuid":
+		if !uuidRegex.MatchString(strings.TrimSpace(value)) {
+			return fmt.Errorf("%q is not a UUID", value)
+		}
+	case "json", "jsonb":
+		if !json.Valid([]byte(value)) {
+			return fmt.Errorf("%q is not valid JSON", value)
+		}
+	}
+	return nil
+}
+
+// checkInteger checks that a value is an integer of the given size in bits.
+func checkInteger(value string, bitSize int) error {
+	if _, err := strconv.ParseInt(strings.TrimSpace(value), 10, bitSize); err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return fmt.Errorf("%q is out of range for a %d bit integer", value, bitSize)
+		}
+		return fmt.Errorf("%q is not an integer", value)
+	}
+	return nil
+}
+
+// checkNumeric checks that a value is a number that, once rounded to scale digits after the decimal point, has at most
+// precision digits. A precision of 0 means the column has no limit.
+func checkNumeric(value string, precision, scale int) error {
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		if isSpecialFloat(value) {
+			return nil
+		}
+		return fmt.Errorf("%q is not a number", value)
+	}
+	if precision <= 0 {
+		return nil
+	}
+	rounded := math.Round(math.Abs(number) * math.Pow(10, float64(scale)))
+	if rounded >= math.Pow(10, float64(precision)) {
+		return fmt.Errorf("%q does not fit numeric(%d, %d)", value, precision, scale)
+	}
+	return nil
+}
+
+// isSpecialFloat returns true for the special values of floating point and numeric columns.
+func isSpecialFloat(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "nan", "infinity", "+infinity", "-infinity", "inf", "+inf", "-inf":
+		return true
+	}
+	return false
+}
+
+// validateOutputTypes checks that the last processor of a column, which writes its values, supports the column's data
+// type. It only fails for data types that can not store any text, since text columns can hold the output of any
+// processor.
+func validateOutputTypes(path string, cmap ColumnMapper) error {
+	if len(cmap.Processors) == 0 || !outputCategories[cmap.DataType] {
+		return nil
+	}
+	last := len(cmap.Processors) - 1
+	info, ok := LookupProcessor(cmap.Processors[last].Name)
+	if !ok || len(info.DataTypes) == 0 {
+		return nil
+	}
+	for _, dataType := range info.DataTypes {
+		if dataType == cmap.DataType {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s[%d]: Processor %s can not write %s values (supports: %s)", path, last, info.Name,
+		cmap.DataType, strings.Join(info.DataTypes, ", "))
+}
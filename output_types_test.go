@@ -0,0 +1,132 @@
+package gonymizer
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckOutputType(t *testing.T) {
+	cases := []struct {
+		cmap   ColumnMapper
+		output string
+		valid  bool
+	}{
+		{ColumnMapper{DataType: "text"}, "anything at all", true},
+		{ColumnMapper{DataType: "character varying", CharacterMaximumLength: 5}, "héllo", true},
+		{ColumnMapper{DataType: "character varying", CharacterMaximumLength: 5}, "hello!", false},
+		{ColumnMapper{DataType: "character", CharacterMaximumLength: 2}, "ab   ", true},
+		{ColumnMapper{DataType: "character varying"}, "no limit", true},
+		{ColumnMapper{DataType: "smallint"}, "32767", true},
+		{ColumnMapper{DataType: "smallint"}, "32768", false},
+		{ColumnMapper{DataType: "integer"}, "-12", true},
+		{ColumnMapper{DataType: "integer"}, "t", false},
+		{ColumnMapper{DataType: "bigint"}, "12345-6789", false},
+		{ColumnMapper{DataType: "numeric"}, "123456789.123", true},
+		{ColumnMapper{DataType: "numeric", NumericPrecision: 5, NumericScale: 2}, "999.99", true},
+		{ColumnMapper{DataType: "numeric", NumericPrecision: 5, NumericScale: 2}, "999.999", false},
+		{ColumnMapper{DataType: "numeric", NumericPrecision: 5, NumericScale: 2}, "1000", false},
+		{ColumnMapper{DataType: "numeric", NumericPrecision: 5, NumericScale: 2}, "NaN", true},
+		{ColumnMapper{DataType: "numeric"}, "ten", false},
+		{ColumnMapper{DataType: "double precision"}, "-Infinity", true},
+		{ColumnMapper{DataType: "real"}, "1.5e10", true},
+		{ColumnMapper{DataType: "real"}, "1,5", false},
+		{ColumnMapper{DataType: "boolean"}, "t", true},
+		{ColumnMapper{DataType: "boolean"}, "maybe", false},
+		{ColumnMapper{DataType: "uuid"}, "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", true},
+		{ColumnMapper{DataType: "uuid"}, "a0eebc99", false},
+		{ColumnMapper{DataType: "jsonb"}, `{"a":\t1}`, true},
+		{ColumnMapper{DataType: "json"}, `{"a":`, false},
+		{ColumnMapper{DataType: "integer"}, copyNull, true},
+	}
+	for _, c := range cases {
+		err := checkOutputType(&c.cmap, c.output)
+		require.Equal(t, c.valid, err == nil, "%s %q", c.cmap.DataType, c.output)
+	}
+}
+
+func TestValidateOutputTypes(t *testing.T) {
+	valid := []ColumnMapper{
+		{DataType: "boolean", Processors: []ProcessorDefinition{{Name: "RandomBoolean"}}},
+		{DataType: "integer", Processors: []ProcessorDefinition{{Name: "RandomDigits"}}},
+		{DataType: "integer", Processors: []ProcessorDefinition{{Name: "Identity"}}},
+		{DataType: "text", Processors: []ProcessorDefinition{{Name: "RandomBoolean"}}},
+		{DataType: "USER-DEFINED", Processors: []ProcessorDefinition{{Name: "FakeZip"}}},
+		{DataType: "integer", Processors: []ProcessorDefinition{{Name: "FakeZip"}, expressionStep(`len(input)`)}},
+	}
+	for _, cmap := range valid {
+		require.Nil(t, validateOutputTypes("Processors", cmap), cmap.DataType)
+	}
+
+	err := validateOutputTypes("Processors", ColumnMapper{
+		DataType:   "smallint",
+		Processors: []ProcessorDefinition{{Name: "Identity"}, {Name: "RandomBoolean"}},
+	})
+	require.NotNil(t, err)
+	require.Equal(t, "Processors[1]: Processor RandomBoolean can not write smallint values (supports: boolean)",
+		err.Error())
+	require.NotNil(t, validateOutputTypes("Processors", ColumnMapper{
+		DataType:   "integer",
+		Processors: []ProcessorDefinition{{Name: "FakeZip"}},
+	}))
+
+	dbMap := DBMapper{
+		DBName: "test",
+		ColumnMaps: []ColumnMapper{{
+			TableSchema: "public",
+			TableName:   "people",
+			ColumnName:  "zip",
+			DataType:    "integer",
+			Processors:  []ProcessorDefinition{{Name: "FakeZip"}},
+		}},
+	}
+	require.NotNil(t, dbMap.Validate())
+}
+
+func TestProcessValueOutputTypes(t *testing.T) {
+	cmap := ColumnMapper{
+		TableSchema:            "public",
+		TableName:              "people",
+		ColumnName:             "bio",
+		DataType:               "character varying",
+		CharacterMaximumLength: 5,
+		Processors:             []ProcessorDefinition{expressionStep(`input + "!"`)},
+	}
+	outputs, err := processValues(&cmap, []string{"ab", "abcdefg"})
+	require.NotNil(t, err)
+	require.Nil(t, outputs)
+
+	// values that are not changed are not checked
+	cmap.Processors = []ProcessorDefinition{{Name: "Identity"}}
+	outputs, err = processValues(&cmap, []string{"abcdefg"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"abcdefg"}, outputs)
+
+	cmap.Processors = []ProcessorDefinition{expressionStep(`input + "!"`)}
+	cmap.OnError = &ErrorPolicy{
+		Action:   OnErrorFallback,
+		Fallback: []ProcessorDefinition{expressionStep(`substr(input, 0, 5)`)},
+	}
+	outputs, err = processValues(&cmap, []string{"ab", "abcdefg"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"ab!", "abcde"}, outputs)
+
+	// the output of the error policy must fit too
+	cmap.OnError = &ErrorPolicy{Action: OnErrorConstant, Value: "too long"}
+	_, err = processValues(&cmap, []string{"abcdefg"})
+	require.NotNil(t, err)
+
+	col := ColumnMapper{DataType: "numeric"}
+	col.setTypeLimits(sql.NullInt64{}, sql.NullInt64{Int64: 10, Valid: true}, sql.NullInt64{Int64: 2, Valid: true})
+	require.Equal(t, 10, col.NumericPrecision)
+	require.Equal(t, 2, col.NumericScale)
+
+	col = ColumnMapper{DataType: "integer"}
+	col.setTypeLimits(sql.NullInt64{}, sql.NullInt64{Int64: 32, Valid: true}, sql.NullInt64{Int64: 0, Valid: true})
+	require.Equal(t, 0, col.NumericPrecision)
+
+	col = ColumnMapper{DataType: "character varying"}
+	col.setTypeLimits(sql.NullInt64{Int64: 50, Valid: true}, sql.NullInt64{}, sql.NullInt64{})
+	require.Equal(t, 50, col.CharacterMaximumLength)
+}
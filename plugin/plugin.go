@@ -0,0 +1,114 @@
+// Package plugin is a small SDK for writing Gonymizer processor plugins. A plugin is an executable that is named in a
+// map file by the Plugin processor. Gonymizer starts it once per worker and streams batches of values to it.
+//
+// The protocol is line-delimited JSON. Gonymizer writes one Request per line to the plugin's stdin and the plugin must
+// answer each one, in order, with a single Response line on stdout with the same ID. Values are the decoded column text
+// (not COPY escaped). NULL values are never sent and stay NULL, also for columns with ProcessNulls. A Response must
+// contain exactly one value for each value in the Request, or an Error which stops the run. Anything written to stderr
+// is passed through to Gonymizer's stderr.
+//
+// A plugin that upper-cases every value:
+//
+//	func main() {
+//		err := plugin.Serve(func(column plugin.Column, value string) (string, error) {
+//			return strings.ToUpper(value), nil
+//		})
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// MaxLineSize is the longest request or response line, in bytes, that is accepted.
+const MaxLineSize = 64 * 1024 * 1024
+
+// Column describes the column the values of a Request belong to.
+type Column struct {
+	Schema   string `json:"schema"`
+	Table    string `json:"table"`
+	Column   string `json:"column"`
+	DataType string `json:"data_type"`
+}
+
+// Request is a batch of values sent to a plugin.
+type Request struct {
+	ID     int64    `json:"id"`
+	Column Column   `json:"column"`
+	Values []string `json:"values"`
+}
+
+// Response is the answer to a Request.
+type Response struct {
+	ID     int64    `json:"id"`
+	Values []string `json:"values,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// HandlerFunc anonymizes a single value.
+type HandlerFunc func(column Column, value string) (string, error)
+
+// BatchHandlerFunc anonymizes every value of a batch and must return one value per input value.
+type BatchHandlerFunc func(column Column, values []string) ([]string, error)
+
+// Serve answers requests from stdin on stdout, calling handler for each value, until stdin is closed.
+func Serve(handler HandlerFunc) error {
+	return ServeBatch(func(column Column, values []string) ([]string, error) {
+		outputs := make([]string, len(values))
+		for i, value := range values {
+			output, err := handler(column, value)
+			if err != nil {
+				return nil, err
+			}
+			outputs[i] = output
+		}
+		return outputs, nil
+	})
+}
+
+// ServeBatch answers requests from stdin on stdout, calling handler once per batch, until stdin is closed.
+func ServeBatch(handler BatchHandlerFunc) error {
+	return ServeIO(os.Stdin, os.Stdout, handler)
+}
+
+// ServeIO answers requests read from r on w until r is exhausted. A handler error is sent back to Gonymizer in the
+// Response and does not stop the plugin.
+func ServeIO(r io.Reader, w io.Writer, handler BatchHandlerFunc) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MaxLineSize)
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return fmt.Errorf("Invalid request: %s", err)
+		}
+
+		resp := Response{ID: req.ID}
+		values, err := handler(req.Column, req.Values)
+		if err == nil && len(values) != len(req.Values) {
+			err = fmt.Errorf("handler returned %d values for %d inputs", len(values), len(req.Values))
+		}
+		if err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Values = values
+		}
+
+		if err := encoder.Encode(resp); err != nil {
+			return err
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
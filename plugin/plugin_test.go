@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeIO(t *testing.T) {
+	input := `{"id":1,"column":{"schema":"public","table":"users","column":"name","data_type":"text"},"values":["rick","morty"]}
+{"id":2,"column":{"schema":"public","table":"users","column":"ssn","data_type":"text"},"values":["fail"]}
+{"id":3,"column":{"schema":"public","table":"users","column":"name","data_type":"text"},"values":[]}
+`
+	var output bytes.Buffer
+	err := ServeIO(strings.NewReader(input), &output, func(column Column, values []string) ([]string, error) {
+		if column.Column == "ssn" {
+			return nil, errors.New("boom")
+		}
+		outputs := make([]string, len(values))
+		for i, value := range values {
+			outputs[i] = strings.ToUpper(value)
+		}
+		return outputs, nil
+	})
+	require.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 3)
+
+	var resp Response
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &resp))
+	require.Equal(t, Response{ID: 1, Values: []string{"RICK", "MORTY"}}, resp)
+
+	resp = Response{}
+	require.Nil(t, json.Unmarshal([]byte(lines[1]), &resp))
+	require.Equal(t, Response{ID: 2, Error: "boom"}, resp)
+
+	resp = Response{}
+	require.Nil(t, json.Unmarshal([]byte(lines[2]), &resp))
+	require.Equal(t, int64(3), resp.ID)
+	require.Empty(t, resp.Values)
+}
+
+func TestServeIOValueCount(t *testing.T) {
+	var output bytes.Buffer
+	err := ServeIO(strings.NewReader(`{"id":1,"values":["a","b"]}`+"\n"), &output,
+		func(column Column, values []string) ([]string, error) {
+			return []string{"a"}, nil
+		})
+	require.Nil(t, err)
+	require.Contains(t, output.String(), "handler returned 1 values for 2 inputs")
+
+	err = ServeIO(strings.NewReader("not json\n"), &output, nil)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,377 @@
+package gonymizer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/smithoss/gonymizer/plugin"
+)
+
+// The Plugin processor runs an external executable that anonymizes values. The executable is started once per worker
+// the first time it is needed and is sent batches of values over the line-delimited JSON protocol described in the
+// plugin package.
+
+const (
+	// defaultPluginTimeout is the number of seconds a plugin has to answer a request.
+	defaultPluginTimeout = 30
+	// defaultPluginBatchSize is the maximum number of values sent in a single request.
+	defaultPluginBatchSize = 500
+)
+
+// pluginConfig is the Params of the Plugin processor.
+type pluginConfig struct {
+	Command   string
+	Args      []string
+	Timeout   float64
+	BatchSize int
+}
+
+// key identifies the plugin processes that can be shared between columns.
+func (config pluginConfig) key() string {
+	return strings.Join(append([]string{config.Command}, config.Args...), "\x00")
+}
+
+// pluginPool contains the running processes of a plugin. At most one process per worker is started: a caller takes a
+// slot before it uses a process and gives it back when it is done, so a slot freed by a broken process wakes a waiting
+// caller that starts a new one.
+type pluginPool struct {
+	config pluginConfig
+	slots  chan struct{}
+	mux    sync.Mutex
+	idle   []*pluginProcess
+}
+
+// pluginProcess is a single running plugin.
+type pluginProcess struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	encoder   *json.Encoder
+	responses chan pluginResponse
+	done      chan struct{}
+	nextID    int64
+	broken    bool
+}
+
+// pluginResponse is a decoded response line or the error that stopped the plugin's stdout.
+type pluginResponse struct {
+	response plugin.Response
+	err      error
+}
+
+// plugins contains a pool for every plugin command that has been used.
+var plugins = struct {
+	mux     sync.Mutex
+	pools   map[string]*pluginPool
+	workers int
+}{
+	pools:   make(map[string]*pluginPool),
+	workers: 1,
+}
+
+// SetPluginWorkers sets the number of processes started for each plugin. It should match the number of workers that
+// process the dump file.
+func SetPluginWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	plugins.mux.Lock()
+	defer plugins.mux.Unlock()
+	plugins.workers = workers
+}
+
+// ClosePlugins stops every running plugin process. Plugins are started again if they are used afterwards.
+func ClosePlugins() {
+	plugins.mux.Lock()
+	pools := plugins.pools
+	plugins.pools = make(map[string]*pluginPool)
+	plugins.mux.Unlock()
+
+	for _, pool := range pools {
+		pool.close()
+	}
+}
+
+// newPluginBatch is the batch constructor for the Plugin processor.
+func newPluginBatch(procDef ProcessorDefinition) (BatchProcessorFunc, error) {
+	config := pluginConfig{Timeout: defaultPluginTimeout, BatchSize: defaultPluginBatchSize}
+	if err := procDef.DecodeParams(&config); err != nil {
+		return nil, err
+	}
+	if config.Command == "" {
+		return nil, errors.New("Plugin requires a Command")
+	}
+	if config.Timeout <= 0 || config.BatchSize <= 0 {
+		return nil, errors.New("Plugin Timeout and BatchSize must be greater than zero")
+	}
+
+	return func(cmap *ColumnMapper, inputs []string) ([]string, error) {
+		pool := getPluginPool(config)
+		outputs := make([]string, 0, len(inputs))
+		for start := 0; start < len(inputs); start += config.BatchSize {
+			end := start + config.BatchSize
+			if end > len(inputs) {
+				end = len(inputs)
+			}
+			batch, err := pool.process(cmap, inputs[start:end])
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, batch...)
+		}
+		return outputs, nil
+	}, nil
+}
+
+// newPlugin is the constructor for the Plugin processor when it is called one value at a time.
+func newPlugin(procDef ProcessorDefinition) (ProcessorFunc, error) {
+	batch, err := newPluginBatch(procDef)
+	if err != nil {
+		return nil, err
+	}
+	return func(cmap *ColumnMapper, input string) (string, error) {
+		outputs, err := batch(cmap, []string{input})
+		if err != nil {
+			return "", err
+		}
+		return outputs[0], nil
+	}, nil
+}
+
+// getPluginPool returns the pool for the plugin, creating it if needed.
+func getPluginPool(config pluginConfig) *pluginPool {
+	plugins.mux.Lock()
+	defer plugins.mux.Unlock()
+
+	pool, ok := plugins.pools[config.key()]
+	if !ok {
+		pool = &pluginPool{config: config, slots: make(chan struct{}, plugins.workers)}
+		plugins.pools[config.key()] = pool
+	}
+	return pool
+}
+
+// process sends the COPY escaped inputs to a plugin process and returns its COPY escaped outputs. NULL values are not
+// sent and stay NULL, also for columns that process NULLs.
+func (pool *pluginPool) process(cmap *ColumnMapper, inputs []string) ([]string, error) {
+	outputs := make([]string, len(inputs))
+	values := make([]string, 0, len(inputs))
+	for i, input := range inputs {
+		if input == copyNull {
+			outputs[i] = copyNull
+			continue
+		}
+		values = append(values, unescapeCopyText(input))
+	}
+	if len(values) == 0 {
+		return outputs, nil
+	}
+
+	proc, err := pool.acquire()
+	if err != nil {
+		return nil, err
+	}
+	column := plugin.Column{
+		Schema:   cmap.TableSchema,
+		Table:    cmap.TableName,
+		Column:   cmap.ColumnName,
+		DataType: cmap.DataType,
+	}
+	timeout := time.Duration(pool.config.Timeout * float64(time.Second))
+
+	values, err = proc.call(column, values, timeout)
+	pool.release(proc)
+	if err != nil {
+		return nil, fmt.Errorf("Plugin %s: %s", pool.config.Command, err)
+	}
+
+	for i, input := range inputs {
+		if input != copyNull {
+			outputs[i] = escapeCopyText(values[0])
+			values = values[1:]
+		}
+	}
+	return outputs, nil
+}
+
+// acquire waits for a free slot and returns an idle process, starting a new one if none is idle.
+func (pool *pluginPool) acquire() (*pluginProcess, error) {
+	pool.slots <- struct{}{}
+
+	pool.mux.Lock()
+	if n := len(pool.idle); n > 0 {
+		proc := pool.idle[n-1]
+		pool.idle = pool.idle[:n-1]
+		pool.mux.Unlock()
+		return proc, nil
+	}
+	pool.mux.Unlock()
+
+	proc, err := startPlugin(pool.config)
+	if err != nil {
+		<-pool.slots
+		return nil, fmt.Errorf("Plugin %s: %s", pool.config.Command, err)
+	}
+	return proc, nil
+}
+
+// release returns a process to the pool and frees its slot. Broken processes are stopped so a new one is started when
+// needed.
+func (pool *pluginPool) release(proc *pluginProcess) {
+	if proc.broken {
+		_ = proc.cmd.Process.Kill()
+		proc.stop()
+	} else {
+		pool.mux.Lock()
+		pool.idle = append(pool.idle, proc)
+		pool.mux.Unlock()
+	}
+	<-pool.slots
+}
+
+// close stops every idle process of the pool.
+func (pool *pluginPool) close() {
+	pool.mux.Lock()
+	idle := pool.idle
+	pool.idle = nil
+	pool.mux.Unlock()
+
+	for _, proc := range idle {
+		proc.stop()
+	}
+}
+
+// startPlugin starts a plugin process and a goroutine that reads its responses.
+func startPlugin(config pluginConfig) (*pluginProcess, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	log.Debug("Started plugin: ", config.Command)
+
+	proc := &pluginProcess{
+		cmd:       cmd,
+		stdin:     stdin,
+		encoder:   json.NewEncoder(stdin),
+		responses: make(chan pluginResponse, 1),
+		done:      make(chan struct{}),
+	}
+	send := func(resp pluginResponse) bool {
+		select {
+		case proc.responses <- resp:
+			return true
+		case <-proc.done:
+			return false
+		}
+	}
+
+	go func() {
+		defer close(proc.responses)
+
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), plugin.MaxLineSize)
+		for scanner.Scan() {
+			var resp plugin.Response
+			if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+				send(pluginResponse{err: fmt.Errorf("Invalid response: %s", err)})
+				return
+			}
+			if !send(pluginResponse{response: resp}) {
+				return
+			}
+		}
+		err := scanner.Err()
+		if err == nil {
+			err = errors.New("Plugin exited")
+		}
+		send(pluginResponse{err: err})
+	}()
+
+	return proc, nil
+}
+
+// call sends a request and waits for its response. Writing the request and reading the response must both finish
+// within the timeout. Any failure marks the process as broken since the request and response lines can no longer be
+// matched up.
+func (proc *pluginProcess) call(column plugin.Column, values []string, timeout time.Duration) ([]string, error) {
+	proc.nextID++
+	req := plugin.Request{ID: proc.nextID, Column: column, Values: values}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// a plugin that does not read its stdin blocks the write once the pipe is full, killing it in release ends the write
+	written := make(chan error, 1)
+	go func() { written <- proc.encoder.Encode(req) }()
+	select {
+	case err := <-written:
+		if err != nil {
+			proc.broken = true
+			return nil, err
+		}
+	case <-timer.C:
+		proc.broken = true
+		return nil, fmt.Errorf("Timed out after %s", timeout)
+	}
+
+	select {
+	case result, ok := <-proc.responses:
+		if !ok {
+			proc.broken = true
+			return nil, errors.New("Plugin exited")
+		}
+		if result.err != nil {
+			proc.broken = true
+			return nil, result.err
+		}
+		resp := result.response
+		if resp.ID != req.ID {
+			proc.broken = true
+			return nil, fmt.Errorf("Expected response %d, got %d", req.ID, resp.ID)
+		}
+		if resp.Error != "" {
+			return nil, errors.New(resp.Error)
+		}
+		if len(resp.Values) != len(values) {
+			return nil, fmt.Errorf("Expected %d values, got %d", len(values), len(resp.Values))
+		}
+		return resp.Values, nil
+	case <-timer.C:
+		proc.broken = true
+		return nil, fmt.Errorf("Timed out after %s", timeout)
+	}
+}
+
+// stop closes the plugin's stdin and waits for it to exit, killing it if it does not exit in time.
+func (proc *pluginProcess) stop() {
+	close(proc.done)
+	_ = proc.stdin.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- proc.cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		_ = proc.cmd.Process.Kill()
+		<-done
+	}
+}
@@ -0,0 +1,136 @@
+package gonymizer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// echoPlugin answers each request with the values it was sent since a request line is also a valid response line.
+var echoPlugin = map[string]interface{}{"Command": "cat"}
+
+func TestProcessorPlugin(t *testing.T) {
+	defer ClosePlugins()
+
+	params := map[string]interface{}{"Command": "cat", "BatchSize": 2.0}
+	require.Nil(t, validateProcessorDefinition(ProcessorDefinition{Name: "Plugin", Params: params}))
+
+	cmap := ColumnMapper{
+		TableSchema: "public",
+		TableName:   "members",
+		ColumnName:  "member_id",
+		Processors:  []ProcessorDefinition{{Name: "Plugin", Params: params}},
+	}
+	require.Nil(t, constructProcessors(cmap.Processors))
+
+	inputs := []string{"M-1", "M-2", "tab\\there", "M-4", "M-5"}
+	outputs, err := processValues(&cmap, inputs)
+	require.Nil(t, err)
+	require.Equal(t, inputs, outputs)
+
+	// The catalog entry sends one value at a time
+	output, err := ProcessorCatalog["Plugin"](&cmap, "M-6")
+	require.Nil(t, err)
+	require.Equal(t, "M-6", output)
+
+	// NULL values are not sent, also when the column processes them
+	cmap.ProcessNulls = true
+	outputs, err = processValues(&cmap, []string{"M-7", copyNull, "M-8"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"M-7", copyNull, "M-8"}, outputs)
+}
+
+func TestProcessorPluginErrors(t *testing.T) {
+	defer ClosePlugins()
+
+	invalid := []map[string]interface{}{
+		{},
+		{"Command": ""},
+		{"Command": "cat", "Timeout": -1.0},
+		{"Command": "cat", "Args": "-u"},
+		{"Command": "cat", "Color": "red"},
+	}
+	for _, params := range invalid {
+		require.NotNil(t, validateProcessorDefinition(ProcessorDefinition{Name: "Plugin", Params: params}), params)
+	}
+
+	run := func(params map[string]interface{}) error {
+		cmap := ColumnMapper{Processors: []ProcessorDefinition{{Name: "Plugin", Params: params}}}
+		require.Nil(t, constructProcessors(cmap.Processors))
+		_, err := processValues(&cmap, []string{"value"})
+		return err
+	}
+
+	// error responses are propagated
+	err := run(map[string]interface{}{
+		"Command": "sh",
+		"Args":    []interface{}{"-c", `while read line; do echo '{"id":1,"error":"unknown member format"}'; done`},
+	})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "unknown member format")
+
+	// a plugin that exits
+	require.NotNil(t, run(map[string]interface{}{"Command": "true"}))
+
+	// a plugin that does not answer in time
+	err = run(map[string]interface{}{"Command": "sleep", "Args": []interface{}{"5"}, "Timeout": 0.1})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "Timed out")
+
+	// a plugin that does not read its requests
+	cmap := ColumnMapper{Processors: []ProcessorDefinition{{Name: "Plugin", Params: map[string]interface{}{
+		"Command": "sleep", "Args": []interface{}{"5"}, "Timeout": 0.1}}}}
+	require.Nil(t, constructProcessors(cmap.Processors))
+	_, err = processValues(&cmap, []string{strings.Repeat("x", 1024*1024)})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "Timed out")
+
+	// a plugin that does not exist
+	require.NotNil(t, run(map[string]interface{}{"Command": "/nonexistent/gonymizer-plugin"}))
+}
+
+func TestPluginPool(t *testing.T) {
+	defer ClosePlugins()
+	SetPluginWorkers(2)
+	defer SetPluginWorkers(1)
+
+	batch, err := newPluginBatch(ProcessorDefinition{Name: "Plugin", Params: echoPlugin})
+	require.Nil(t, err)
+
+	cmap := ColumnMapper{}
+	done := make(chan error, 6)
+	for i := 0; i < 4; i++ {
+		go func() {
+			_, err := batch(&cmap, []string{"a", "b"})
+			done <- err
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		require.Nil(t, <-done)
+	}
+
+	pool := getPluginPool(pluginConfig{Command: "cat"})
+	pool.mux.Lock()
+	require.True(t, len(pool.idle) <= 2)
+	pool.mux.Unlock()
+
+	// callers waiting for a slot are woken when a broken process is stopped
+	batch, err = newPluginBatch(ProcessorDefinition{Name: "Plugin", Params: map[string]interface{}{"Command": "true"}})
+	require.Nil(t, err)
+	for i := 0; i < 6; i++ {
+		go func() {
+			_, err := batch(&cmap, []string{"a"})
+			done <- err
+		}()
+	}
+	for i := 0; i < 6; i++ {
+		select {
+		case err := <-done:
+			require.NotNil(t, err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("Plugin callers were not woken")
+		}
+	}
+}
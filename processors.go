@@ -164,8 +164,8 @@ func (c *safeUUIDMap) Get(key uuid.UUID) (uuid.UUID, error) {
 }
 
 // ProcessorCatalog is the function map that points to each Processor to it's entry function. All Processors are listed
-// in this map.
-var ProcessorCatalog map[string]ProcessorFunc
+// in this map. It is filled by RegisterProcessor and should not be modified directly.
+var ProcessorCatalog = make(map[string]ProcessorFunc)
 
 // AlphaNumericMap is used to keep consistency with scrambled alpha numeric strings.
 // For example, if we need to scramble things such as Social Security Numbers, but it is nice to keep track of these
@@ -181,46 +181,384 @@ var UUIDMap = safeUUIDMap{
 	v: make(map[uuid.UUID]uuid.UUID),
 }
 
-// init initializes the ProcessorCatalog map for all processors. A processor must be listed here to be accessible.
+// init registers the built-in processors. A processor must be registered to be accessible.
 func init() {
-	ProcessorCatalog = map[string]ProcessorFunc{
-		"AlphaNumericScrambler":       ProcessorAlphaNumericScrambler,
-		"EmptyJson":                   ProcessorEmptyJson,
-		"FakeStreetAddress":           ProcessorAddress,
-		"FakeCity":                    ProcessorCity,
-		"FakeLatitude":                ProcessorLatitude,
-		"FakeLongitude":               ProcessorLongitude,
-		"FakeCompanyName":             ProcessorCompanyName,
-		"FakeParagraph":               ProcessParagraph,
-		"FakeUserAgent":               ProcessUserAgent,
-		"FakeEmailAddress":            ProcessorEmailAddress,
-		"FakeFirstName":               ProcessorFirstName,
-		"FakeFullName":                ProcessorFullName,
-		"FakeIPv4":                    ProcessorIPv4,
-		"FakeIPv6":                    ProcessIPv6,
-		"FakeGender":                  ProcessGender,
-		"FakeCurrency":                ProcessCurrency,
-		"FakeLastName":                ProcessorLastName,
-		"FakePhoneNumber":             ProcessorPhoneNumber,
-		"FakeState":                   ProcessorState,
-		"FakeStateAbbrev":             ProcessorStateAbbrev,
-		"FakeLanguage":                ProcessorLanguage,
-		"FakeUsername":                ProcessorUserName,
-		"FakeZip":                     ProcessorZip,
-		"Identity":                    ProcessorIdentity, // Default: Does not modify field
-		"RandomBoolean":               ProcessorRandomBoolean,
-		"RandomDate":                  ProcessorRandomDate,
-		"RandomDigits":                ProcessorRandomDigits,
-		"RandomUUID":                  ProcessorRandomUUID,
-		"ScrubString":                 ProcessorScrubString,
-		"UniqueAlphaNumericScrambler": ProcessorUniqueAlphaNumericScrambler,
+	for _, info := range []ProcessorInfo{
+		{
+			Name:        "AlphaNumericScrambler",
+			Description: "Scrambles letters and digits, keeping a consistent mapping per column or parent column",
+			DataTypes:   append(numericDataTypes, textDataTypes...),
+			New:         staticProcessor(ProcessorAlphaNumericScrambler),
+		},
+		{
+			Name:        "Constant",
+			Description: "Replaces a value with a fixed value",
+			Parameters: []ParameterSchema{
+				{Name: "Value", Type: ParameterString, Description: "Text written instead of the value", Required: true},
+			},
+			New: newConstant,
+		},
+		{
+			Name:        "EmptyJson",
+			Description: "Replaces a JSON value with an empty object ({})",
+			DataTypes:   []string{"json", "jsonb"},
+			New:         staticProcessor(ProcessorEmptyJson),
+		},
+		{
+			Name:        "EnumRandom",
+			Description: "Replaces a value with one of the column's AllowedValues",
+			DataTypes:   append([]string{"USER-DEFINED"}, textDataTypes...),
+			Parameters: []ParameterSchema{
+				{Name: "Values", Type: ParameterStringList,
+					Description: "Values to pick from instead of the column's AllowedValues"},
+				{Name: "Distribution", Type: ParameterString,
+					Description: "uniform (default) or observed, which follows the column's ValueCounts"},
+			},
+			New: newEnumRandom,
+		},
+		{
+			Name:        "Expression",
+			Description: "Evaluates an expression that can read the value, the other columns of the row and helper functions",
+			Parameters: []ParameterSchema{
+				{Name: "Expression", Type: ParameterString, Required: true,
+					Description: "Expression to evaluate, I.E. lower(row.first_name) + \"@example.com\""},
+			},
+			New:    newExpressionValue,
+			NewRow: newExpression,
+		},
+		{
+			Name:        "FakeCity",
+			Description: "Replaces a city with a fake one",
+			DataTypes:   textDataTypes,
+			Parameters:  []ParameterSchema{localeParameter},
+			New:         newCity,
+		},
+		{
+			Name:        "FakeCompanyName",
+			Description: "Replaces a company name with a fake one",
+			DataTypes:   textDataTypes,
+			Parameters:  []ParameterSchema{localeParameter},
+			New:         newCompanyName,
+		},
+		{
+			Name:        "FakeCurrency",
+			Description: "Replaces a currency with a fake one",
+			DataTypes:   textDataTypes,
+			New:         staticProcessor(ProcessCurrency),
+		},
+		{
+			Name:        "FakeEmailAddress",
+			Description: "Replaces an e-mail address with a fake one",
+			DataTypes:   textDataTypes,
+			New:         staticProcessor(ProcessorEmailAddress),
+		},
+		{
+			Name:        "FakeFirstName",
+			Description: "Replaces a person's first name with a fake first name (non-gender specific)",
+			DataTypes:   textDataTypes,
+			Parameters:  []ParameterSchema{localeParameter},
+			New:         newFirstName,
+		},
+		{
+			Name:        "FakeFullName",
+			Description: "Replaces a person's full name with a fake one",
+			DataTypes:   textDataTypes,
+			Parameters:  []ParameterSchema{localeParameter},
+			New:         newFullName,
+		},
+		{
+			Name:        "FakeGender",
+			Description: "Replaces a gender with a fake one",
+			DataTypes:   textDataTypes,
+			New:         staticProcessor(ProcessGender),
+		},
+		{
+			Name:        "FakeIPv4",
+			Description: "Replaces an IPv4 address with a fake one",
+			DataTypes:   append([]string{"inet"}, textDataTypes...),
+			New:         staticProcessor(ProcessorIPv4),
+		},
+		{
+			Name:        "FakeIPv6",
+			Description: "Replaces an IPv6 address with a fake one",
+			DataTypes:   append([]string{"inet"}, textDataTypes...),
+			New:         staticProcessor(ProcessIPv6),
+		},
+		{
+			Name:        "FakeLanguage",
+			Description: "Replaces a language with a fake one",
+			DataTypes:   textDataTypes,
+			New:         staticProcessor(ProcessorLanguage),
+		},
+		{
+			Name:        "FakeLastName",
+			Description: "Replaces a person's last name with a fake last name",
+			DataTypes:   textDataTypes,
+			Parameters:  []ParameterSchema{localeParameter},
+			New:         newLastName,
+		},
+		{
+			Name:        "FakeLatitude",
+			Description: "Replaces a latitude with a fake one",
+			DataTypes:   append(numericDataTypes, textDataTypes...),
+			New:         staticProcessor(ProcessorLatitude),
+		},
+		{
+			Name:        "FakeLongitude",
+			Description: "Replaces a longitude with a fake one",
+			DataTypes:   append(numericDataTypes, textDataTypes...),
+			New:         staticProcessor(ProcessorLongitude),
+		},
+		{
+			Name:        "FakeParagraph",
+			Description: "Replaces text with a random paragraph",
+			DataTypes:   textDataTypes,
+			New:         staticProcessor(ProcessParagraph),
+		},
+		{
+			Name:        "FakePhoneNumber",
+			Description: "Replaces a phone number with a fake one",
+			DataTypes:   textDataTypes,
+			Parameters:  []ParameterSchema{localeParameter},
+			New:         newPhoneNumber,
+		},
+		{
+			Name:        "FakeState",
+			Description: "Replaces a state (full name) with a fake one",
+			DataTypes:   textDataTypes,
+			Parameters:  []ParameterSchema{localeParameter},
+			New:         newState,
+		},
+		{
+			Name:        "FakeStateAbbrev",
+			Description: "Replaces a state abbreviation with a fake one",
+			DataTypes:   textDataTypes,
+			Parameters:  []ParameterSchema{localeParameter},
+			New:         newStateAbbrev,
+		},
+		{
+			Name:        "FakeStreetAddress",
+			Description: "Replaces a street address with a fake one",
+			DataTypes:   textDataTypes,
+			Parameters:  []ParameterSchema{localeParameter},
+			New:         newAddress,
+		},
+		{
+			Name:        "FakeUserAgent",
+			Description: "Replaces a user agent with a fake one",
+			DataTypes:   textDataTypes,
+			New:         staticProcessor(ProcessUserAgent),
+		},
+		{
+			Name:        "FakeUsername",
+			Description: "Replaces a username with a fake one",
+			DataTypes:   textDataTypes,
+			New:         staticProcessor(ProcessorUserName),
+		},
+		{
+			Name:        "FakeZip",
+			Description: "Replaces a zip code with a fake one",
+			DataTypes:   textDataTypes,
+			Parameters:  []ParameterSchema{localeParameter},
+			New:         newZip,
+		},
+		{
+			Name:        "HstoreKeys",
+			Description: "Applies SubProcessors to the values of an hstore by key",
+			DataTypes:   []string{"USER-DEFINED"},
+			Parameters: []ParameterSchema{
+				{Name: "SubProcessors", Type: ParameterSubProcessors, Description: "Processors by hstore key", Required: true},
+			},
+			New: newHstoreKeys,
+		},
+		{
+			Name:        "Identity",
+			Description: "Does not modify the column (same as leaving the column out of the map file)",
+			New:         staticProcessor(ProcessorIdentity),
+		},
+		{
+			Name:        "JitterGeometry",
+			Description: "Moves a PostGIS geometry/geography by a random distance, keeping its SRID",
+			DataTypes:   spatialDataTypes,
+			Parameters: []ParameterSchema{
+				{Name: "Variance", Type: ParameterNumber, Description: "Maximum distance in meters"},
+			},
+			New: newJitterGeometry,
+		},
+		{
+			Name:        "JitterTimestamp",
+			Description: "Shifts a date, timestamp, time, or interval by a random amount",
+			DataTypes:   temporalDataTypes,
+			Parameters: []ParameterSchema{
+				{Name: "Variance", Type: ParameterNumber, Description: "Maximum shift in seconds"},
+			},
+			New: newJitterTimestamp,
+		},
+		{
+			Name:        "NullBytea",
+			Description: "Replaces a bytea value with NULL, the column must be nullable",
+			DataTypes:   []string{"bytea"},
+			New:         staticProcessor(ProcessorNullBytea),
+		},
+		{
+			Name:        "OrderPreservingToken",
+			Description: "Replaces an integer or fixed-width identifier with a keyed token that sorts in the same order",
+			DataTypes:   append([]string{"smallint", "integer", "bigint"}, textDataTypes...),
+			Parameters: []ParameterSchema{
+				{Name: "Min", Type: ParameterNumber, Description: "Smallest value of an integer column"},
+				{Name: "Max", Type: ParameterNumber, Description: "Largest value of an integer column"},
+				{Name: "Key", Type: ParameterString, Description: "Secret the tokens are derived from"},
+				{Name: "KeyEnv", Type: ParameterString, Description: "Environment variable holding the Key"},
+				{Name: "Expansion", Type: ParameterNumber,
+					Description: "Integer tokens are spread over Expansion times the Min to Max range (default 16)"},
+				{Name: "Charset", Type: ParameterString,
+					Description: "Characters that are tokenized: alphanumeric (default), uppercase or digits"},
+				{Name: "ExtraWidth", Type: ParameterNumber,
+					Description: "Characters a text token has in addition to the identifier's (default 2)"},
+			},
+			New: newOrderPreservingToken,
+		},
+		{
+			Name:        "PlaceholderBytea",
+			Description: "Replaces a bytea value with a fixed placeholder blob",
+			DataTypes:   []string{"bytea"},
+			Parameters: []ParameterSchema{
+				{Name: "Placeholder", Type: ParameterString, Description: "Text stored as the placeholder (default REDACTED)"},
+			},
+			New: newPlaceholderBytea,
+		},
+		{
+			Name:        "Plugin",
+			Description: "Sends values in batches to an external executable, see the plugin package",
+			Parameters: []ParameterSchema{
+				{Name: "Command", Type: ParameterString, Description: "Path of the plugin executable", Required: true},
+				{Name: "Args", Type: ParameterStringList, Description: "Arguments passed to the plugin"},
+				{Name: "Timeout", Type: ParameterNumber, Description: "Seconds the plugin has to answer a batch (default 30)"},
+				{Name: "BatchSize", Type: ParameterNumber, Description: "Maximum number of values per batch (default 500)"},
+			},
+			New:      newPlugin,
+			NewBatch: newPluginBatch,
+		},
+		{
+			Name:        "RandomBoolean",
+			Description: "Randomizes a boolean",
+			DataTypes:   []string{"boolean"},
+			New:         staticProcessor(ProcessorRandomBoolean),
+		},
+		{
+			Name:        "RandomBytea",
+			Description: "Replaces a bytea value with random bytes of the same length",
+			DataTypes:   []string{"bytea"},
+			New:         staticProcessor(ProcessorRandomBytea),
+		},
+		{
+			Name:        "RandomDate",
+			Description: "Randomizes the day and month of an ISO-8601 date but keeps the year",
+			DataTypes:   append([]string{"date"}, textDataTypes...),
+			New:         staticProcessor(ProcessorRandomDate),
+		},
+		{
+			Name:        "RandomDigits",
+			Description: "Replaces a string of digits with random digits of the same length",
+			DataTypes:   append(append(integerDataTypes, "numeric"), textDataTypes...),
+			New:         staticProcessor(ProcessorRandomDigits),
+		},
+		{
+			Name:        "RandomTimestamp",
+			Description: "Randomizes a date, timestamp, time, or interval",
+			DataTypes:   temporalDataTypes,
+			Parameters: []ParameterSchema{
+				{Name: "Min", Type: ParameterNumber, Description: "Lower bound in seconds (epoch or since midnight)"},
+				{Name: "Max", Type: ParameterNumber, Description: "Upper bound in seconds (epoch or since midnight)"},
+			},
+			New: newRandomTimestamp,
+		},
+		{
+			Name:        "RandomUUID",
+			Description: "Replaces a UUID with a random one, keeping a global mapping so relationships stay intact",
+			DataTypes:   append([]string{"uuid"}, textDataTypes...),
+			New:         staticProcessor(ProcessorRandomUUID),
+		},
+		{
+			Name:        "ScrubString",
+			Description: "Replaces every character of a string with *",
+			DataTypes:   textDataTypes,
+			New:         staticProcessor(ProcessorScrubString),
+		},
+		{
+			Name:        "SetNull",
+			Description: "Replaces a value with NULL, the column must be nullable",
+			New:         staticProcessor(ProcessorSetNull),
+		},
+		{
+			Name:        "SnapGeometry",
+			Description: "Snaps the coordinates of a PostGIS geometry/geography to a grid, keeping its SRID",
+			DataTypes:   spatialDataTypes,
+			Parameters: []ParameterSchema{
+				{Name: "Variance", Type: ParameterNumber, Description: "Grid cell size in meters", Required: true},
+			},
+			New: newSnapGeometry,
+		},
+		{
+			Name:        "TruncateToDay",
+			Description: "Truncates a timestamp or time to midnight and drops the time of an interval",
+			DataTypes:   timestampDataTypes,
+			New:         staticProcessor(ProcessorTruncateToDay),
+		},
+		{
+			Name:        "TruncateToHour",
+			Description: "Truncates a timestamp, time, or interval to the start of the hour",
+			DataTypes:   timestampDataTypes,
+			New:         staticProcessor(ProcessorTruncateToHour),
+		},
+		{
+			Name:        "UniqueAlphaNumericScrambler",
+			Description: "Same as AlphaNumericScrambler but every scrambled value in the column is unique",
+			DataTypes:   append(numericDataTypes, textDataTypes...),
+			New:         staticProcessor(ProcessorUniqueAlphaNumericScrambler),
+		},
+		{
+			Name:        "XmlPaths",
+			Description: "Applies SubProcessors to the text and attributes of an xml document selected by XPath",
+			DataTypes:   []string{"xml"},
+			Parameters: []ParameterSchema{
+				{Name: "SubProcessors", Type: ParameterSubProcessors, Description: "Processors by XPath", Required: true},
+			},
+			New: newXmlPaths,
+		},
+	} {
+		MustRegisterProcessor(info)
 	}
-
 }
 
+// Constructors of the Fake processors whose values depend on their locale
+var (
+	newAddress     = localeFaker((*localeData).streetAddress, fake.StreetAddress)
+	newCity        = localeFaker((*localeData).city, fake.City)
+	newFirstName   = localeFaker((*localeData).firstName, fake.FirstName)
+	newFullName    = localeFaker((*localeData).fullName, fake.FullName)
+	newLastName    = localeFaker((*localeData).lastName, fake.LastName)
+	newPhoneNumber = localeFaker((*localeData).phone, fake.Phone)
+	newState       = localeFaker((*localeData).state, fake.State)
+	newStateAbbrev = localeFaker((*localeData).stateAbbrev, fake.StateAbbrev)
+	newZip         = localeFaker((*localeData).zip, fake.Zip)
+	newCompanyName = localeFaker((*localeData).company, fake.Company)
+)
+
 // ProcessorFunc is a simple function prototype for the ProcessorMap function pointers.
 type ProcessorFunc func(*ColumnMapper, string) (string, error)
 
+// processorDefinition returns the first ProcessorDefinition in the column's processor list with the given name. Processors
+// use this to read their optional helpers (Max, Min, Variance). An empty definition is returned if none is found.
+func processorDefinition(cmap *ColumnMapper, name string) ProcessorDefinition {
+	for _, procDef := range cmap.Processors {
+		if procDef.Name == name {
+			return procDef
+		}
+	}
+	return ProcessorDefinition{}
+}
+
 // fakeFuncPtr is a simple function prototype for function pointers to the Fake package's fake functions.
 //type fakeFuncPtr func() string
 
@@ -258,12 +596,12 @@ func ProcessorUniqueAlphaNumericScrambler(cmap *ColumnMapper, input string) (str
 
 // ProcessorAddress will return a fake address string that is compiled from the fake library
 func ProcessorAddress(cmap *ColumnMapper, input string) (string, error) {
-	return fake.StreetAddress(), nil
+	return runConstructed(cmap, input, "FakeStreetAddress", newAddress)
 }
 
 // ProcessorCity will return a real city name that is >= 0.4 Jaro-Winkler similar than the input.
 func ProcessorCity(cmap *ColumnMapper, input string) (string, error) {
-	return fake.City(), nil
+	return runConstructed(cmap, input, "FakeCity", newCity)
 }
 
 // ProcessorLatitude will return a fake latitude string that is compiled from the fake library
@@ -308,12 +646,12 @@ func ProcessCurrency(cmap *ColumnMapper, input string) (string, error) {
 
 // ProcessorFirstName will return a first name that is >= 0.4 Jaro-Winkler similar than the input.
 func ProcessorFirstName(cmap *ColumnMapper, input string) (string, error) {
-	return fake.FirstName(), nil
+	return runConstructed(cmap, input, "FakeFirstName", newFirstName)
 }
 
 // ProcessorFullName will return a full name that is >= 0.4 Jaro-Winkler similar than the input.
 func ProcessorFullName(cmap *ColumnMapper, input string) (string, error) {
-	return fake.FullName(), nil
+	return runConstructed(cmap, input, "FakeFullName", newFullName)
 }
 
 // ProcessorIdentity will skip anonymization and leave output === input.
@@ -327,7 +665,7 @@ func ProcessorIPv4(cmap *ColumnMapper, input string) (string, error) {
 
 // ProcessorLastName will return a last name that is >= 0.4 Jaro-Winkler similar than the input.
 func ProcessorLastName(cmap *ColumnMapper, input string) (string, error) {
-	return fake.LastName(), nil
+	return runConstructed(cmap, input, "FakeLastName", newLastName)
 }
 
 // ProcessorEmptyJson will return an empty JSON no matter what is the input.
@@ -337,7 +675,7 @@ func ProcessorEmptyJson(cmap *ColumnMapper, input string) (string, error) {
 
 // ProcessorPhoneNumber will return a phone number that is >= 0.4 Jaro-Winkler similar than the input.
 func ProcessorPhoneNumber(cmap *ColumnMapper, input string) (string, error) {
-	return fake.Phone(), nil
+	return runConstructed(cmap, input, "FakePhoneNumber", newPhoneNumber)
 }
 
 // ProcessorLanguage will return a random human language.
@@ -347,12 +685,12 @@ func ProcessorLanguage(cmap *ColumnMapper, input string) (string, error) {
 
 // ProcessorState will return a state that is >= 0.4 Jaro-Winkler similar than the input.
 func ProcessorState(cmap *ColumnMapper, input string) (string, error) {
-	return fake.State(), nil
+	return runConstructed(cmap, input, "FakeState", newState)
 }
 
 // ProcessorStateAbbrev will return a state abbreviation.
 func ProcessorStateAbbrev(cmap *ColumnMapper, input string) (string, error) {
-	return fake.StateAbbrev(), nil
+	return runConstructed(cmap, input, "FakeStateAbbrev", newStateAbbrev)
 }
 
 // ProcessorUserName will return a username that is >= 0.4 Jaro-Winkler similar than the input.
@@ -362,12 +700,12 @@ func ProcessorUserName(cmap *ColumnMapper, input string) (string, error) {
 
 // ProcessorZip will return a zip code that is >= 0.4 Jaro-Winkler similar than the input.
 func ProcessorZip(cmap *ColumnMapper, input string) (string, error) {
-	return fake.Zip(), nil
+	return runConstructed(cmap, input, "FakeZip", newZip)
 }
 
 // ProcessorCompanyName will return a company name that is >= 0.4 Jaro-Winkler similar than the input.
 func ProcessorCompanyName(cmap *ColumnMapper, input string) (string, error) {
-	return fake.Company(), nil
+	return runConstructed(cmap, input, "FakeCompanyName", newCompanyName)
 }
 
 // ProcessorRandomBoolean will return a random boolean value.
@@ -0,0 +1,112 @@
+package gonymizer
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// bytea values are written by pg_dump in the hex output format, I.E. \x48656c6c6f, and the backslash is escaped again
+// inside of a COPY block so the dump file contains \\x48656c6c6f. Servers using bytea_output=escape write the older
+// escape format instead, which is also accepted here. The processors in this file always write the hex format.
+
+// byteaPlaceholder is the default value written by the PlaceholderBytea processor.
+const byteaPlaceholder = "REDACTED"
+
+// ProcessorRandomBytea will replace a bytea value with random bytes of the same length.
+func ProcessorRandomBytea(cmap *ColumnMapper, input string) (string, error) {
+	value, err := decodeBytea(input)
+	if err != nil {
+		return "", err
+	}
+	return encodeBytea(randomBytes(len(value))), nil
+}
+
+// placeholderByteaConfig is the Params of PlaceholderBytea.
+type placeholderByteaConfig struct {
+	Placeholder string
+}
+
+// ProcessorPlaceholderBytea will replace a bytea value with a fixed placeholder blob. The placeholder can be set with
+// the Placeholder parameter.
+func ProcessorPlaceholderBytea(cmap *ColumnMapper, input string) (string, error) {
+	return runConstructed(cmap, input, "PlaceholderBytea", newPlaceholderBytea)
+}
+
+// newPlaceholderBytea is the constructor for PlaceholderBytea.
+func newPlaceholderBytea(procDef ProcessorDefinition) (ProcessorFunc, error) {
+	config := placeholderByteaConfig{Placeholder: byteaPlaceholder}
+	if err := procDef.DecodeParams(&config); err != nil {
+		return nil, err
+	}
+	placeholder := encodeBytea([]byte(config.Placeholder))
+
+	return func(cmap *ColumnMapper, input string) (string, error) {
+		if _, err := decodeBytea(input); err != nil {
+			return "", err
+		}
+		return placeholder, nil
+	}, nil
+}
+
+// ProcessorNullBytea will replace a bytea value with NULL. The column must be nullable.
+func ProcessorNullBytea(cmap *ColumnMapper, input string) (string, error) {
+	if !cmap.IsNullable {
+		return "", fmt.Errorf("Column %s.%s.%s is not nullable", cmap.TableSchema, cmap.TableName, cmap.ColumnName)
+	}
+	return copyNull, nil
+}
+
+// decodeBytea decodes a bytea value from a COPY block into its raw bytes.
+func decodeBytea(input string) ([]byte, error) {
+	text := unescapeCopyText(input)
+
+	if strings.HasPrefix(text, "\\x") {
+		value, err := hex.DecodeString(text[2:])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid bytea hex value: %s", err)
+		}
+		return value, nil
+	}
+
+	// Escape format: \\ is a backslash, \ooo is an octal byte, and everything else is literal
+	value := make([]byte, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' {
+			value = append(value, text[i])
+			continue
+		}
+		if i+1 < len(text) && text[i+1] == '\\' {
+			value = append(value, '\\')
+			i++
+			continue
+		}
+		if i+4 > len(text) {
+			return nil, errors.New("Invalid bytea escape sequence")
+		}
+		octal, err := strconv.ParseUint(text[i+1:i+4], 8, 8)
+		if err != nil {
+			return nil, errors.New("Invalid bytea escape sequence")
+		}
+		value = append(value, byte(octal))
+		i += 3
+	}
+	return value, nil
+}
+
+// encodeBytea encodes raw bytes in the bytea hex format, escaped for a COPY block.
+func encodeBytea(value []byte) string {
+	return "\\\\x" + hex.EncodeToString(value)
+}
+
+// randomBytes returns n bytes from the seeded random number generator.
+func randomBytes(n int) []byte {
+	value := make([]byte, n)
+	for i := range value {
+		value[i] = byte(rand.Intn(256))
+	}
+	return value
+}
@@ -0,0 +1,55 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeBytea(t *testing.T) {
+	value, err := decodeBytea("\\\\x48656c6c6f")
+	require.Nil(t, err)
+	require.Equal(t, []byte("Hello"), value)
+
+	// Escape format: abc\000\\ inside of a COPY block
+	value, err = decodeBytea("abc\\\\000\\\\\\\\")
+	require.Nil(t, err)
+	require.Equal(t, []byte("abc\x00\\"), value)
+
+	_, err = decodeBytea("\\\\xZZ")
+	require.NotNil(t, err)
+	_, err = decodeBytea("abc\\\\0")
+	require.NotNil(t, err)
+
+	require.Equal(t, "\\\\x48656c6c6f", encodeBytea([]byte("Hello")))
+}
+
+func TestProcessorRandomBytea(t *testing.T) {
+	output, err := ProcessorRandomBytea(&cMap, "\\\\x48656c6c6f")
+	require.Nil(t, err)
+	require.Regexp(t, `^\\\\x[0-9a-f]{10}$`, output)
+	require.NotEqual(t, "\\\\x48656c6c6f", output)
+
+	output, err = ProcessorRandomBytea(&cMap, "\\\\x")
+	require.Nil(t, err)
+	require.Equal(t, "\\\\x", output)
+
+	_, err = ProcessorRandomBytea(&cMap, "\\\\x123")
+	require.NotNil(t, err)
+}
+
+func TestProcessorPlaceholderBytea(t *testing.T) {
+	output, err := ProcessorPlaceholderBytea(&cMap, "\\\\x48656c6c6f")
+	require.Nil(t, err)
+	require.Equal(t, encodeBytea([]byte(byteaPlaceholder)), output)
+}
+
+func TestProcessorNullBytea(t *testing.T) {
+	nullable := ColumnMapper{IsNullable: true}
+	output, err := ProcessorNullBytea(&nullable, "\\\\x48656c6c6f")
+	require.Nil(t, err)
+	require.Equal(t, "\\N", output)
+
+	_, err = ProcessorNullBytea(&cMap, "\\\\x48656c6c6f")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,323 @@
+package gonymizer
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+// The EnumRandom processor replaces a value with one of the values the column allows. The allowed values are the labels
+// of the column's enum type or the list of a CHECK (column IN (...)) constraint and are captured by the map command.
+
+// Distributions of the EnumRandom processor
+const (
+	enumUniform  = "uniform"
+	enumObserved = "observed"
+)
+
+// enumRandomConfig is the Params of the EnumRandom processor.
+type enumRandomConfig struct {
+	Values       []string
+	Distribution string
+}
+
+// inListCheckRegex matches the definition PostgreSQL gives a CHECK (column IN (...)) constraint, I.E.
+// CHECK (((status)::text = ANY ((ARRAY['a'::character varying, 'b'::character varying])::text[])))
+var inListCheckRegex = regexp.MustCompile(`^CHECK \((.+?) = ANY \(+ARRAY\[(.*)\](?:\)::[\w .\[\]"]+)?\)+$`)
+
+// ProcessorEnumRandom will replace a value with one of the column's AllowedValues.
+func ProcessorEnumRandom(cmap *ColumnMapper, input string) (string, error) {
+	return runConstructed(cmap, input, "EnumRandom", newEnumRandom)
+}
+
+// newEnumRandom is the constructor for the EnumRandom processor.
+func newEnumRandom(procDef ProcessorDefinition) (ProcessorFunc, error) {
+	config, err := decodeEnumRandom(procDef)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(cmap *ColumnMapper, input string) (string, error) {
+		values := config.Values
+		if len(values) == 0 {
+			values = cmap.AllowedValues
+		}
+		if len(values) == 0 {
+			return "", fmt.Errorf("Column %s.%s.%s has no AllowedValues", cmap.TableSchema, cmap.TableName,
+				cmap.ColumnName)
+		}
+		if config.Distribution != enumObserved {
+			return escapeCopyText(values[rand.Intn(len(values))]), nil
+		}
+
+		weights, total := enumWeights(values, cmap.ValueCounts)
+		if total == 0 {
+			return "", fmt.Errorf("Column %s.%s.%s has no ValueCounts", cmap.TableSchema, cmap.TableName,
+				cmap.ColumnName)
+		}
+		pick := rand.Int63n(total)
+		for i, weight := range weights {
+			if pick < weight {
+				return escapeCopyText(values[i]), nil
+			}
+			pick -= weight
+		}
+		return escapeCopyText(values[len(values)-1]), nil
+	}, nil
+}
+
+// decodeEnumRandom decodes and checks the Params of an EnumRandom processor.
+func decodeEnumRandom(procDef ProcessorDefinition) (enumRandomConfig, error) {
+	config := enumRandomConfig{Distribution: enumUniform}
+	if err := procDef.DecodeParams(&config); err != nil {
+		return config, err
+	}
+	if config.Distribution != enumUniform && config.Distribution != enumObserved {
+		return config, fmt.Errorf("Unknown Distribution %q. Expected one of: %s, %s", config.Distribution,
+			enumUniform, enumObserved)
+	}
+	return config, nil
+}
+
+// enumWeights returns the observed count of each value and their total.
+func enumWeights(values []string, counts map[string]int64) ([]int64, int64) {
+	weights := make([]int64, len(values))
+	var total int64
+	for i, value := range values {
+		if counts[value] > 0 {
+			weights[i] = counts[value]
+			total += weights[i]
+		}
+	}
+	return weights, total
+}
+
+// validateEnums checks that every EnumRandom processor of a column has values to pick from.
+func validateEnums(path string, cmap ColumnMapper) error {
+	for i, procDef := range cmap.Processors {
+		if procDef.Name != "EnumRandom" {
+			continue
+		}
+		config, err := decodeEnumRandom(procDef)
+		if err != nil {
+			return fmt.Errorf("%s Processors[%d]: Processor EnumRandom: %s", path, i, err)
+		}
+		values := config.Values
+		if len(values) == 0 {
+			values = cmap.AllowedValues
+		}
+		if len(values) == 0 {
+			return fmt.Errorf("%s Processors[%d]: Processor EnumRandom requires AllowedValues or Params Values", path, i)
+		}
+		if _, total := enumWeights(values, cmap.ValueCounts); config.Distribution == enumObserved && total == 0 {
+			return fmt.Errorf("%s Processors[%d]: Processor EnumRandom requires ValueCounts for the %s distribution, "+
+				"see map --enum-frequencies", path, i, enumObserved)
+		}
+	}
+	return nil
+}
+
+// parseInListCheck returns the values of a CHECK constraint definition of the form CHECK (column IN (...)) on the given
+// column. ok is false for any other kind of constraint.
+func parseInListCheck(columnName, definition string) (values []string, ok bool) {
+	submatch := inListCheckRegex.FindStringSubmatch(strings.TrimSpace(definition))
+	if submatch == nil {
+		return nil, false
+	}
+
+	// the left side is the column, possibly quoted, wrapped in parentheses and cast to text
+	column := submatch[1]
+	if i := strings.Index(column, "::"); i >= 0 {
+		column = column[:i]
+	}
+	column = strings.Trim(column, "()")
+	if column != columnName && column != pq.QuoteIdentifier(columnName) {
+		return nil, false
+	}
+
+	rest := submatch[2]
+	for {
+		rest = strings.TrimLeft(rest, " ")
+		var value string
+		if strings.HasPrefix(rest, "'") {
+			end := 1
+			for {
+				i := strings.Index(rest[end:], "'")
+				if i < 0 {
+					return nil, false
+				}
+				end += i + 1
+				if !strings.HasPrefix(rest[end:], "'") {
+					break
+				}
+				end++
+			}
+			value = strings.Replace(rest[1:end-1], "''", "'", -1)
+			rest = rest[end:]
+		} else {
+			i := strings.IndexAny(rest, ":,")
+			if i < 0 {
+				i = len(rest)
+			}
+			value = strings.TrimSpace(rest[:i])
+			if value == "" || strings.ContainsAny(value, "()'") {
+				return nil, false
+			}
+			rest = rest[i:]
+		}
+
+		// drop the cast of the element
+		if strings.HasPrefix(rest, "::") {
+			i := strings.Index(rest, ",")
+			if i < 0 {
+				i = len(rest)
+			}
+			rest = rest[i:]
+		}
+		values = append(values, value)
+
+		if rest == "" {
+			return values, true
+		}
+		if !strings.HasPrefix(rest, ",") {
+			return nil, false
+		}
+		rest = rest[1:]
+	}
+}
+
+// matchingColumns returns the columns of a table in the map, including columns of sharded schemas mapped as prefix*.
+func matchingColumns(columns []ColumnMapper, schemaName, tableName, columnName string) []*ColumnMapper {
+	var matches []*ColumnMapper
+	for i := range columns {
+		col := &columns[i]
+		if col.TableName != tableName || col.ColumnName != columnName {
+			continue
+		}
+		if col.TableSchema == schemaName ||
+			(strings.HasSuffix(col.TableSchema, "*") && strings.HasPrefix(schemaName, strings.TrimSuffix(col.TableSchema, "*"))) {
+			matches = append(matches, col)
+		}
+	}
+	return matches
+}
+
+// addAllowedValue adds a value to the column's AllowedValues unless it is already there.
+func addAllowedValue(col *ColumnMapper, value string) {
+	for _, allowed := range col.AllowedValues {
+		if allowed == value {
+			return
+		}
+	}
+	col.AllowedValues = append(col.AllowedValues, value)
+}
+
+// captureAllowedValues fills in the AllowedValues of enum columns and of columns with a CHECK (column IN (...))
+// constraint.
+func captureAllowedValues(db *sql.DB, columns []ColumnMapper) error {
+	rows, err := GetEnumLabels(db)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	enums := make(map[*ColumnMapper]bool)
+	for rows.Next() {
+		var schemaName, tableName, columnName, label string
+		if err = rows.Scan(&schemaName, &tableName, &columnName, &label); err != nil {
+			return err
+		}
+		for _, col := range matchingColumns(columns, schemaName, tableName, columnName) {
+			addAllowedValue(col, label)
+			enums[col] = true
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	checks, err := GetColumnCheckConstraints(db)
+	if err != nil {
+		return err
+	}
+	defer checks.Close()
+
+	for checks.Next() {
+		var schemaName, tableName, columnName, definition string
+		if err = checks.Scan(&schemaName, &tableName, &columnName, &definition); err != nil {
+			return err
+		}
+		values, ok := parseInListCheck(columnName, definition)
+		if !ok {
+			continue
+		}
+		for _, col := range matchingColumns(columns, schemaName, tableName, columnName) {
+			if enums[col] {
+				continue
+			}
+			for _, value := range values {
+				addAllowedValue(col, value)
+			}
+		}
+	}
+	return checks.Err()
+}
+
+// CaptureValueCounts counts how often each of the AllowedValues is used by every column that has them, so EnumRandom
+// can follow the observed distribution. Columns of sharded schemas are skipped.
+func CaptureValueCounts(conf PGConfig, dbMap *DBMapper) error {
+	db, err := OpenDB(conf)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for i := range dbMap.ColumnMaps {
+		col := &dbMap.ColumnMaps[i]
+		if len(col.AllowedValues) == 0 {
+			continue
+		}
+		if strings.HasSuffix(col.TableSchema, "*") {
+			log.Warnf("Skipping value counts of sharded column %s.%s.%s", col.TableSchema, col.TableName, col.ColumnName)
+			continue
+		}
+
+		query := fmt.Sprintf("SELECT %[1]s::text, count(*) FROM %[2]s.%[3]s WHERE %[1]s IS NOT NULL GROUP BY 1",
+			pq.QuoteIdentifier(col.ColumnName), pq.QuoteIdentifier(col.TableSchema), pq.QuoteIdentifier(col.TableName))
+		if err = countValues(db, query, col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countValues runs a value count query and stores the counts in the column's ValueCounts.
+func countValues(db *sql.DB, query string, col *ColumnMapper) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer rows.Close()
+
+	col.ValueCounts = make(map[string]int64)
+	for rows.Next() {
+		var (
+			value string
+			count int64
+		)
+		if err = rows.Scan(&value, &count); err != nil {
+			return err
+		}
+		col.ValueCounts[value] = count
+	}
+	if len(col.ValueCounts) == 0 {
+		col.ValueCounts = nil
+	}
+	return rows.Err()
+}
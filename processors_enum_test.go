@@ -0,0 +1,102 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInListCheck(t *testing.T) {
+	values, ok := parseInListCheck("status", "CHECK ((status = ANY (ARRAY['new'::text, 'done'::text])))")
+	require.True(t, ok)
+	require.Equal(t, []string{"new", "done"}, values)
+
+	values, ok = parseInListCheck("status", "CHECK (((status)::text = ANY ((ARRAY['new'::character varying, "+
+		"'it''s done'::character varying])::text[])))")
+	require.True(t, ok)
+	require.Equal(t, []string{"new", "it's done"}, values)
+
+	values, ok = parseInListCheck("level", "CHECK ((level = ANY (ARRAY[1, 2, 3])))")
+	require.True(t, ok)
+	require.Equal(t, []string{"1", "2", "3"}, values)
+
+	values, ok = parseInListCheck("Kind", `CHECK (("Kind" = ANY (ARRAY['a'::text, 'b'::text])))`)
+	require.True(t, ok)
+	require.Equal(t, []string{"a", "b"}, values)
+
+	_, ok = parseInListCheck("other", "CHECK ((status = ANY (ARRAY['new'::text, 'done'::text])))")
+	require.False(t, ok)
+	_, ok = parseInListCheck("price", "CHECK ((price > (0)::numeric))")
+	require.False(t, ok)
+	_, ok = parseInListCheck("level", "CHECK ((level = ANY (ARRAY[lower(name), 'b'::text])))")
+	require.False(t, ok)
+}
+
+func TestProcessorEnumRandom(t *testing.T) {
+	cmap := ColumnMapper{
+		AllowedValues: []string{"new", "open", "closed"},
+		Processors:    []ProcessorDefinition{{Name: "EnumRandom"}},
+	}
+	for i := 0; i < 20; i++ {
+		output, err := ProcessorEnumRandom(&cmap, "open")
+		require.Nil(t, err)
+		require.Contains(t, cmap.AllowedValues, output)
+	}
+
+	// the observed distribution never picks values that were not counted
+	cmap.Processors = []ProcessorDefinition{
+		{Name: "EnumRandom", Params: map[string]interface{}{"Distribution": "observed"}},
+	}
+	cmap.ValueCounts = map[string]int64{"closed": 10}
+	for i := 0; i < 20; i++ {
+		output, err := ProcessorEnumRandom(&cmap, "open")
+		require.Nil(t, err)
+		require.Equal(t, "closed", output)
+	}
+
+	// Values take the place of the column's AllowedValues
+	cmap.Processors = []ProcessorDefinition{
+		{Name: "EnumRandom", Params: map[string]interface{}{"Values": []interface{}{"a\tb"}}},
+	}
+	output, err := ProcessorEnumRandom(&cmap, "open")
+	require.Nil(t, err)
+	require.Equal(t, "a\\tb", output)
+
+	_, err = ProcessorEnumRandom(&ColumnMapper{Processors: []ProcessorDefinition{{Name: "EnumRandom"}}}, "open")
+	require.NotNil(t, err)
+
+	cmap.Processors = []ProcessorDefinition{
+		{Name: "EnumRandom", Params: map[string]interface{}{"Distribution": "normal"}},
+	}
+	_, err = ProcessorEnumRandom(&cmap, "open")
+	require.NotNil(t, err)
+}
+
+func TestValidateEnums(t *testing.T) {
+	enumRandom := func(params map[string]interface{}) []ProcessorDefinition {
+		return []ProcessorDefinition{{Name: "EnumRandom", Params: params}}
+	}
+
+	valid := []ColumnMapper{
+		{Processors: []ProcessorDefinition{{Name: "Identity"}}},
+		{AllowedValues: []string{"a"}, Processors: enumRandom(nil)},
+		{Processors: enumRandom(map[string]interface{}{"Values": []interface{}{"a"}})},
+		{
+			AllowedValues: []string{"a", "b"},
+			ValueCounts:   map[string]int64{"b": 3},
+			Processors:    enumRandom(map[string]interface{}{"Distribution": "observed"}),
+		},
+	}
+	for _, cmap := range valid {
+		require.Nil(t, validateEnums("s.t.c", cmap))
+	}
+
+	invalid := []ColumnMapper{
+		{Processors: enumRandom(nil)},
+		{AllowedValues: []string{"a"}, Processors: enumRandom(map[string]interface{}{"Distribution": "observed"})},
+		{AllowedValues: []string{"a"}, Processors: enumRandom(map[string]interface{}{"Distribution": "normal"})},
+	}
+	for _, cmap := range invalid {
+		require.NotNil(t, validateEnums("s.t.c", cmap))
+	}
+}
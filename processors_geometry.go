@@ -0,0 +1,561 @@
+package gonymizer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// PostGIS geometry and geography columns are written by pg_dump as hex encoded EWKB, I.E.
+// 0101000020E6100000000000000000F03F0000000000000040 is SRID=4326;POINT(1 2). Hand written or text columns may instead
+// contain (E)WKT. The processors in this file decode either format, move the coordinates, and write the result back in
+// the same format with the same SRID.
+//
+// The Variance of the ProcessorDefinition is the distance in meters. For geographic coordinates (geography columns and
+// SRIDs using degrees) meters are converted to degrees at the latitude of the geometry, otherwise the coordinates are
+// assumed to already be in meters.
+
+// metersPerDegree is the approximate length of one degree of latitude.
+const metersPerDegree = 111320.0
+
+const (
+	wkbPoint              = 1
+	wkbLineString         = 2
+	wkbPolygon            = 3
+	wkbMultiPoint         = 4
+	wkbMultiLineString    = 5
+	wkbMultiPolygon       = 6
+	wkbGeometryCollection = 7
+
+	ewkbZFlag    = 0x80000000
+	ewkbMFlag    = 0x40000000
+	ewkbSRIDFlag = 0x20000000
+)
+
+// geographicSRIDs are spatial reference systems that use longitude/latitude in degrees.
+var geographicSRIDs = map[uint32]bool{
+	4326: true, // WGS 84
+	4269: true, // NAD83
+	4258: true, // ETRS89
+	4283: true, // GDA94
+	4674: true, // SIRGAS 2000
+	4019: true, // GRS 1980
+}
+
+// geometry is a decoded WKB/WKT geometry. Points and line strings keep their coordinates in rings[0], polygons keep
+// one entry per ring, and multi geometries and collections keep their members in children.
+type geometry struct {
+	typeCode  uint32
+	srid      uint32
+	hasSRID   bool
+	dims      int
+	byteOrder binary.ByteOrder
+	rings     [][][]float64
+	children  []*geometry
+}
+
+// ProcessorJitterGeometry will move a geometry or geography by a random distance of up to Variance meters. The whole
+// geometry is moved by the same offset so line strings and polygons keep their shape.
+func ProcessorJitterGeometry(cmap *ColumnMapper, input string) (string, error) {
+	return runConstructed(cmap, input, "JitterGeometry", newJitterGeometry)
+}
+
+// newJitterGeometry is the constructor for JitterGeometry.
+func newJitterGeometry(procDef ProcessorDefinition) (ProcessorFunc, error) {
+	radius := math.Abs(procDef.Variance)
+
+	return func(cmap *ColumnMapper, input string) (string, error) {
+		return transformGeometry(cmap, input, func(g *geometry, geographic bool) {
+			origin := g.firstCoordinate()
+			if origin == nil {
+				return
+			}
+			// sqrt keeps the points uniformly distributed over the area of the circle
+			distance := radius * math.Sqrt(rand.Float64())
+			bearing := rand.Float64() * 2 * math.Pi
+			dx, dy := distance*math.Sin(bearing), distance*math.Cos(bearing)
+			if geographic {
+				dx, dy = metersToDegrees(dx, dy, origin[1])
+			}
+			g.eachCoordinate(func(c []float64) {
+				c[0] += dx
+				c[1] += dy
+				if geographic {
+					normalizeDegrees(c)
+				}
+			})
+		})
+	}, nil
+}
+
+// ProcessorSnapGeometry will snap every coordinate of a geometry or geography to a grid with cells of Variance meters.
+func ProcessorSnapGeometry(cmap *ColumnMapper, input string) (string, error) {
+	return runConstructed(cmap, input, "SnapGeometry", newSnapGeometry)
+}
+
+// newSnapGeometry is the constructor for SnapGeometry.
+func newSnapGeometry(procDef ProcessorDefinition) (ProcessorFunc, error) {
+	cell := math.Abs(procDef.Variance)
+	if cell == 0 {
+		return nil, errors.New("SnapGeometry requires a Variance (grid cell size in meters)")
+	}
+
+	return func(cmap *ColumnMapper, input string) (string, error) {
+		return transformGeometry(cmap, input, func(g *geometry, geographic bool) {
+			g.eachCoordinate(func(c []float64) {
+				if !geographic {
+					c[0] = snapToGrid(c[0], cell)
+					c[1] = snapToGrid(c[1], cell)
+					return
+				}
+				_, latCell := metersToDegrees(0, cell, 0)
+				c[1] = snapToGrid(c[1], latCell)
+				lonCell, _ := metersToDegrees(cell, 0, c[1])
+				c[0] = snapToGrid(c[0], lonCell)
+				normalizeDegrees(c)
+			})
+		})
+	}, nil
+}
+
+// transformGeometry decodes the input as EWKB or EWKT, applies the transform, and encodes it back in the same format.
+func transformGeometry(cmap *ColumnMapper, input string, transform func(g *geometry, geographic bool)) (string, error) {
+	trimmed := strings.TrimSpace(input)
+	if trimmed == "" {
+		return input, nil
+	}
+
+	if isHexString(trimmed) {
+		raw, err := hex.DecodeString(trimmed)
+		if err != nil {
+			return "", err
+		}
+		g, err := decodeWKB(bytes.NewReader(raw))
+		if err != nil {
+			return "", err
+		}
+		transform(g, isGeographic(cmap, g))
+
+		var buf bytes.Buffer
+		if err = g.encodeWKB(&buf); err != nil {
+			return "", err
+		}
+		output := hex.EncodeToString(buf.Bytes())
+		if strings.ToUpper(trimmed) == trimmed {
+			output = strings.ToUpper(output)
+		}
+		return output, nil
+	}
+
+	g, err := parseWKT(trimmed)
+	if err != nil {
+		return "", err
+	}
+	transform(g, isGeographic(cmap, g))
+	return g.WKT(), nil
+}
+
+// isGeographic returns true if the coordinates of the geometry are in degrees.
+func isGeographic(cmap *ColumnMapper, g *geometry) bool {
+	if cmap.UdtName == "geography" || strings.HasPrefix(strings.ToLower(cmap.DataType), "geography") {
+		return true
+	}
+	if g.hasSRID {
+		return geographicSRIDs[g.srid]
+	}
+	return strings.Contains(strings.ToLower(cmap.DataType), "4326")
+}
+
+// metersToDegrees converts an east/west and north/south distance in meters to degrees at the given latitude.
+func metersToDegrees(dx, dy, latitude float64) (float64, float64) {
+	cos := math.Cos(latitude * math.Pi / 180)
+	if cos < 1e-6 {
+		cos = 1e-6
+	}
+	return dx / (metersPerDegree * cos), dy / metersPerDegree
+}
+
+// normalizeDegrees keeps a coordinate in degrees valid for PostGIS: the latitude is clamped to [-90, 90] and the
+// longitude is wrapped around the antimeridian to [-180, 180).
+func normalizeDegrees(c []float64) {
+	c[1] = math.Max(-90, math.Min(90, c[1]))
+	if c[0] < -180 || c[0] >= 180 {
+		c[0] = math.Mod(math.Mod(c[0]+180, 360)+360, 360) - 180
+	}
+}
+
+// snapToGrid rounds the value to the nearest multiple of cell.
+func snapToGrid(value, cell float64) float64 {
+	snapped := math.Round(value/cell) * cell
+	if snapped == 0 {
+		// Avoid writing -0
+		return 0
+	}
+	return snapped
+}
+
+// isHexString returns true if the input has an even number of characters that are all hexadecimal digits.
+func isHexString(input string) bool {
+	if len(input)%2 != 0 {
+		return false
+	}
+	for i := 0; i < len(input); i++ {
+		if !isHexDigit(input[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// baseType returns the geometry type without any EWKB flags or ISO dimension offsets.
+func (g *geometry) baseType() uint32 {
+	return (g.typeCode &^ (ewkbZFlag | ewkbMFlag | ewkbSRIDFlag)) % 1000
+}
+
+// firstCoordinate returns the first coordinate of the geometry or nil if the geometry is empty.
+func (g *geometry) firstCoordinate() []float64 {
+	var first []float64
+	g.eachCoordinate(func(c []float64) {
+		if first == nil && !math.IsNaN(c[0]) {
+			first = c
+		}
+	})
+	return first
+}
+
+// eachCoordinate calls fn for every coordinate in the geometry, skipping the NaN coordinates of empty points.
+func (g *geometry) eachCoordinate(fn func(c []float64)) {
+	for _, ring := range g.rings {
+		for _, c := range ring {
+			if !math.IsNaN(c[0]) {
+				fn(c)
+			}
+		}
+	}
+	for _, child := range g.children {
+		child.eachCoordinate(fn)
+	}
+}
+
+// decodeWKB decodes a (E)WKB geometry. Both the PostGIS flag bits and the ISO dimension offsets are understood.
+func decodeWKB(r *bytes.Reader) (*geometry, error) {
+	g := new(geometry)
+
+	order, err := r.ReadByte()
+	if err != nil {
+		return nil, errors.New("Unexpected end of WKB")
+	}
+	switch order {
+	case 0:
+		g.byteOrder = binary.BigEndian
+	case 1:
+		g.byteOrder = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("Invalid WKB byte order: %d", order)
+	}
+
+	if err = binary.Read(r, g.byteOrder, &g.typeCode); err != nil {
+		return nil, errors.New("Unexpected end of WKB")
+	}
+	g.dims = 2
+	if g.typeCode&ewkbZFlag != 0 {
+		g.dims++
+	}
+	if g.typeCode&ewkbMFlag != 0 {
+		g.dims++
+	}
+	switch (g.typeCode &^ (ewkbZFlag | ewkbMFlag | ewkbSRIDFlag)) / 1000 {
+	case 1, 2:
+		g.dims++
+	case 3:
+		g.dims += 2
+	}
+	if g.typeCode&ewkbSRIDFlag != 0 {
+		g.hasSRID = true
+		if err = binary.Read(r, g.byteOrder, &g.srid); err != nil {
+			return nil, errors.New("Unexpected end of WKB")
+		}
+	}
+
+	readCount := func() (int, error) {
+		var n uint32
+		if err := binary.Read(r, g.byteOrder, &n); err != nil {
+			return 0, errors.New("Unexpected end of WKB")
+		}
+		if int(n) > r.Len() {
+			return 0, errors.New("Invalid WKB element count")
+		}
+		return int(n), nil
+	}
+	readPoints := func(n int) ([][]float64, error) {
+		points := make([][]float64, n)
+		for i := range points {
+			points[i] = make([]float64, g.dims)
+			if err := binary.Read(r, g.byteOrder, points[i]); err != nil {
+				return nil, errors.New("Unexpected end of WKB")
+			}
+		}
+		return points, nil
+	}
+
+	switch g.baseType() {
+	case wkbPoint:
+		points, err := readPoints(1)
+		if err != nil {
+			return nil, err
+		}
+		g.rings = [][][]float64{points}
+	case wkbLineString:
+		n, err := readCount()
+		if err != nil {
+			return nil, err
+		}
+		points, err := readPoints(n)
+		if err != nil {
+			return nil, err
+		}
+		g.rings = [][][]float64{points}
+	case wkbPolygon:
+		numRings, err := readCount()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < numRings; i++ {
+			n, err := readCount()
+			if err != nil {
+				return nil, err
+			}
+			points, err := readPoints(n)
+			if err != nil {
+				return nil, err
+			}
+			g.rings = append(g.rings, points)
+		}
+	case wkbMultiPoint, wkbMultiLineString, wkbMultiPolygon, wkbGeometryCollection:
+		n, err := readCount()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			child, err := decodeWKB(r)
+			if err != nil {
+				return nil, err
+			}
+			g.children = append(g.children, child)
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported WKB geometry type: %d", g.baseType())
+	}
+	return g, nil
+}
+
+// encodeWKB writes the geometry back out using the same byte order and type code it was decoded with.
+func (g *geometry) encodeWKB(buf *bytes.Buffer) error {
+	order := byte(1)
+	if g.byteOrder == binary.BigEndian {
+		order = 0
+	}
+	buf.WriteByte(order)
+
+	write := func(v interface{}) error {
+		return binary.Write(buf, g.byteOrder, v)
+	}
+	if err := write(g.typeCode); err != nil {
+		return err
+	}
+	if g.hasSRID {
+		if err := write(g.srid); err != nil {
+			return err
+		}
+	}
+
+	switch g.baseType() {
+	case wkbPoint:
+		return write(g.rings[0][0])
+	case wkbLineString, wkbPolygon:
+		if g.baseType() == wkbPolygon {
+			if err := write(uint32(len(g.rings))); err != nil {
+				return err
+			}
+		}
+		for _, ring := range g.rings {
+			if err := write(uint32(len(ring))); err != nil {
+				return err
+			}
+			for _, c := range ring {
+				if err := write(c); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		if err := write(uint32(len(g.children))); err != nil {
+			return err
+		}
+		for _, child := range g.children {
+			if err := child.encodeWKB(buf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// wktTypes maps the WKT keywords we support to their WKB type.
+var wktTypes = map[string]uint32{
+	"POINT":      wkbPoint,
+	"LINESTRING": wkbLineString,
+	"POLYGON":    wkbPolygon,
+}
+
+// parseWKT parses a POINT, LINESTRING, or POLYGON in WKT or EWKT (SRID=4326;POINT(1 2)) format.
+func parseWKT(input string) (*geometry, error) {
+	g := &geometry{dims: 2}
+	text := input
+
+	if strings.HasPrefix(strings.ToUpper(text), "SRID=") {
+		semicolon := strings.Index(text, ";")
+		if semicolon < 0 {
+			return nil, fmt.Errorf("Invalid EWKT: %q", input)
+		}
+		srid, err := strconv.ParseUint(text[5:semicolon], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid EWKT SRID: %q", input)
+		}
+		g.hasSRID = true
+		g.srid = uint32(srid)
+		text = text[semicolon+1:]
+	}
+
+	open := strings.Index(text, "(")
+	header := strings.Fields(strings.ToUpper(text))
+	if open >= 0 {
+		header = strings.Fields(strings.ToUpper(text[:open]))
+	}
+	if len(header) == 0 {
+		return nil, fmt.Errorf("Invalid WKT: %q", input)
+	}
+	geomType, ok := wktTypes[header[0]]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported WKT geometry type: %q", input)
+	}
+	g.typeCode = geomType
+
+	empty := false
+	for _, modifier := range header[1:] {
+		switch modifier {
+		case "Z":
+			g.typeCode |= ewkbZFlag
+			g.dims++
+		case "M":
+			g.typeCode |= ewkbMFlag
+			g.dims++
+		case "ZM":
+			g.typeCode |= ewkbZFlag | ewkbMFlag
+			g.dims += 2
+		case "EMPTY":
+			empty = true
+		default:
+			return nil, fmt.Errorf("Invalid WKT: %q", input)
+		}
+	}
+	if empty {
+		return g, nil
+	}
+	if open < 0 || !strings.HasSuffix(text, ")") {
+		return nil, fmt.Errorf("Invalid WKT: %q", input)
+	}
+
+	body := strings.TrimSpace(text[open+1 : len(text)-1])
+	var ringTexts []string
+	if geomType == wkbPolygon {
+		for _, part := range strings.Split(body, "),") {
+			ringTexts = append(ringTexts, strings.Trim(strings.TrimSpace(part), "()"))
+		}
+	} else {
+		ringTexts = []string{body}
+	}
+
+	for _, ringText := range ringTexts {
+		var ring [][]float64
+		for _, pointText := range strings.Split(ringText, ",") {
+			fields := strings.Fields(pointText)
+			// Z is implied when a point has three ordinates and no dimension modifier was given
+			if len(header) == 1 && len(fields) > g.dims && len(fields) <= 4 {
+				g.dims = len(fields)
+				g.typeCode |= ewkbZFlag
+				if g.dims == 4 {
+					g.typeCode |= ewkbMFlag
+				}
+			}
+			if len(fields) != g.dims {
+				return nil, fmt.Errorf("Invalid WKT coordinate %q in %q", pointText, input)
+			}
+			c := make([]float64, g.dims)
+			for i, field := range fields {
+				value, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid WKT coordinate %q in %q", pointText, input)
+				}
+				c[i] = value
+			}
+			ring = append(ring, c)
+		}
+		g.rings = append(g.rings, ring)
+	}
+	return g, nil
+}
+
+// WKT formats the geometry as WKT, or EWKT if it has an SRID.
+func (g *geometry) WKT() string {
+	var b strings.Builder
+
+	if g.hasSRID {
+		fmt.Fprintf(&b, "SRID=%d;", g.srid)
+	}
+	for name, geomType := range wktTypes {
+		if geomType == g.baseType() {
+			b.WriteString(name)
+		}
+	}
+	switch {
+	case g.typeCode&ewkbZFlag != 0 && g.typeCode&ewkbMFlag != 0:
+		b.WriteString(" ZM ")
+	case g.typeCode&ewkbZFlag != 0:
+		b.WriteString(" Z ")
+	case g.typeCode&ewkbMFlag != 0:
+		b.WriteString(" M ")
+	}
+	if len(g.rings) == 0 {
+		return strings.TrimSpace(b.String()) + " EMPTY"
+	}
+
+	formatRing := func(ring [][]float64) string {
+		points := make([]string, len(ring))
+		for i, c := range ring {
+			ordinates := make([]string, len(c))
+			for j, v := range c {
+				ordinates[j] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+			points[i] = strings.Join(ordinates, " ")
+		}
+		return strings.Join(points, ",")
+	}
+
+	if g.baseType() == wkbPolygon {
+		rings := make([]string, len(g.rings))
+		for i, ring := range g.rings {
+			rings[i] = "(" + formatRing(ring) + ")"
+		}
+		b.WriteString("(" + strings.Join(rings, ",") + ")")
+	} else {
+		b.WriteString("(" + formatRing(g.rings[0]) + ")")
+	}
+	return b.String()
+}
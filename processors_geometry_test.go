@@ -0,0 +1,156 @@
+package gonymizer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// SRID=4326;POINT(-122.4194 37.7749)
+const testEWKBPoint = "0101000020E610000050FC1873D79A5EC0D0D556EC2FE34240"
+
+func TestDecodeWKB(t *testing.T) {
+	raw, err := hex.DecodeString(testEWKBPoint)
+	require.Nil(t, err)
+	g, err := decodeWKB(bytes.NewReader(raw))
+	require.Nil(t, err)
+	require.True(t, g.hasSRID)
+	require.Equal(t, uint32(4326), g.srid)
+	require.Equal(t, uint32(wkbPoint), g.baseType())
+	require.InDelta(t, -122.4194, g.rings[0][0][0], 1e-9)
+	require.InDelta(t, 37.7749, g.rings[0][0][1], 1e-9)
+
+	var buf bytes.Buffer
+	require.Nil(t, g.encodeWKB(&buf))
+	require.Equal(t, testEWKBPoint, strings.ToUpper(hex.EncodeToString(buf.Bytes())))
+
+	_, err = decodeWKB(bytes.NewReader(raw[:10]))
+	require.NotNil(t, err)
+}
+
+func TestParseWKT(t *testing.T) {
+	inputs := []string{
+		"POINT(1 2)",
+		"SRID=4326;POINT(-122.4194 37.7749)",
+		"POINT Z (1 2 3)",
+		"LINESTRING(0 0,1 1,2 2)",
+		"SRID=3857;POLYGON((0 0,10 0,10 10,0 10,0 0),(2 2,3 2,3 3,2 2))",
+		"POINT EMPTY",
+	}
+	for _, input := range inputs {
+		g, err := parseWKT(input)
+		require.Nil(t, err, input)
+		require.Equal(t, input, g.WKT())
+	}
+
+	for _, input := range []string{"CIRCLE(1 2)", "POINT(1)", "POINT(a b)", "SRID=x;POINT(1 2)"} {
+		_, err := parseWKT(input)
+		require.NotNil(t, err, input)
+	}
+}
+
+func TestProcessorJitterGeometry(t *testing.T) {
+	cmap := ColumnMapper{
+		DataType:   "USER-DEFINED",
+		Processors: []ProcessorDefinition{{Name: "JitterGeometry", Variance: 1000}},
+	}
+
+	for i := 0; i < 50; i++ {
+		output, err := ProcessorJitterGeometry(&cmap, testEWKBPoint)
+		require.Nil(t, err)
+		require.Len(t, output, len(testEWKBPoint))
+		require.True(t, strings.HasPrefix(output, "0101000020E6100000"), output)
+
+		raw, _ := hex.DecodeString(output)
+		g, err := decodeWKB(bytes.NewReader(raw))
+		require.Nil(t, err)
+		dx, dy := metersToDegrees(1000, 1000, 37.7749)
+		require.True(t, math.Abs(g.rings[0][0][0]+122.4194) <= dx)
+		require.True(t, math.Abs(g.rings[0][0][1]-37.7749) <= dy)
+	}
+
+	// Polygons are moved as a whole so rings stay closed
+	output, err := ProcessorJitterGeometry(&cmap, "SRID=3857;POLYGON((0 0,10 0,10 10,0 10,0 0))")
+	require.Nil(t, err)
+	g, err := parseWKT(output)
+	require.Nil(t, err)
+	ring := g.rings[0]
+	require.Equal(t, ring[0], ring[len(ring)-1])
+	require.InDelta(t, 10, ring[1][0]-ring[0][0], 1e-6)
+
+	_, err = ProcessorJitterGeometry(&cmap, "NOT A GEOMETRY")
+	require.NotNil(t, err)
+
+	// geographic coordinates stay valid near the poles and the antimeridian
+	cmap.Processors = []ProcessorDefinition{{Name: "JitterGeometry", Variance: 500000}}
+	for i := 0; i < 50; i++ {
+		output, err := ProcessorJitterGeometry(&cmap, "SRID=4326;POINT(179.999 89.999)")
+		require.Nil(t, err)
+		g, err := parseWKT(output)
+		require.Nil(t, err)
+		c := g.rings[0][0]
+		require.True(t, c[0] >= -180 && c[0] < 180, output)
+		require.True(t, c[1] >= -90 && c[1] <= 90, output)
+	}
+}
+
+func TestIsGeographic(t *testing.T) {
+	g, err := parseWKT("POINT(-122.4194 37.7749)")
+	require.Nil(t, err)
+
+	// PostGIS columns are USER-DEFINED, the type is in the UdtName
+	require.True(t, isGeographic(&ColumnMapper{DataType: "USER-DEFINED", UdtName: "geography"}, g))
+	require.False(t, isGeographic(&ColumnMapper{DataType: "USER-DEFINED", UdtName: "geometry"}, g))
+	require.False(t, isGeographic(&ColumnMapper{DataType: "USER-DEFINED"}, g))
+
+	// values of geography columns without an SRID are in degrees too
+	cmap := ColumnMapper{
+		DataType:   "USER-DEFINED",
+		UdtName:    "geography",
+		Processors: []ProcessorDefinition{{Name: "JitterGeometry", Variance: 1000}},
+	}
+	dx, dy := metersToDegrees(1000, 1000, 37.7749)
+	for i := 0; i < 50; i++ {
+		output, err := ProcessorJitterGeometry(&cmap, "POINT(-122.4194 37.7749)")
+		require.Nil(t, err)
+		g, err := parseWKT(output)
+		require.Nil(t, err)
+		require.True(t, math.Abs(g.rings[0][0][0]+122.4194) <= dx, output)
+		require.True(t, math.Abs(g.rings[0][0][1]-37.7749) <= dy, output)
+	}
+}
+
+func TestNormalizeDegrees(t *testing.T) {
+	for _, tc := range []struct{ in, out []float64 }{
+		{[]float64{10, 20}, []float64{10, 20}},
+		{[]float64{181, 91}, []float64{-179, 90}},
+		{[]float64{-190, -95}, []float64{170, -90}},
+		{[]float64{540, 0}, []float64{-180, 0}},
+	} {
+		normalizeDegrees(tc.in)
+		require.InDelta(t, tc.out[0], tc.in[0], 1e-9)
+		require.InDelta(t, tc.out[1], tc.in[1], 1e-9)
+	}
+}
+
+func TestProcessorSnapGeometry(t *testing.T) {
+	cmap := ColumnMapper{
+		Processors: []ProcessorDefinition{{Name: "SnapGeometry", Variance: 100}},
+	}
+
+	output, err := ProcessorSnapGeometry(&cmap, "SRID=3857;LINESTRING(149 51,260 -49)")
+	require.Nil(t, err)
+	require.Equal(t, "SRID=3857;LINESTRING(100 100,300 0)", output)
+
+	output, err = ProcessorSnapGeometry(&cmap, testEWKBPoint)
+	require.Nil(t, err)
+	require.NotEqual(t, testEWKBPoint, output)
+
+	cmap.Processors = []ProcessorDefinition{{Name: "SnapGeometry"}}
+	_, err = ProcessorSnapGeometry(&cmap, testEWKBPoint)
+	require.NotNil(t, err)
+}
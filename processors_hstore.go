@@ -0,0 +1,148 @@
+package gonymizer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// hstore values are written as a comma separated list of "key"=>"value" pairs where NULL values are unquoted, I.E.
+// "email"=>"rick@example.com", "nickname"=>NULL. Inside of the quotes \" and \\ are escaped with a backslash. Inside
+// of a COPY block each of those backslashes is escaped again.
+
+// hstorePair is a single key/value pair. value is nil for NULL values.
+type hstorePair struct {
+	key   string
+	value *string
+}
+
+// ProcessorHstoreKeys will apply the SubProcessors of the ProcessorDefinition to the hstore values whose key matches.
+// Keys without sub-processors, and NULL values, are left as-is.
+func ProcessorHstoreKeys(cmap *ColumnMapper, input string) (string, error) {
+	return runConstructed(cmap, input, "HstoreKeys", newHstoreKeys)
+}
+
+// newHstoreKeys is the constructor for HstoreKeys.
+func newHstoreKeys(procDef ProcessorDefinition) (ProcessorFunc, error) {
+	return func(cmap *ColumnMapper, input string) (string, error) {
+		pairs, err := parseHstore(unescapeCopyText(input))
+		if err != nil {
+			return "", err
+		}
+
+		for i, pair := range pairs {
+			subProcessors, ok := procDef.SubProcessors[pair.key]
+			if !ok || pair.value == nil {
+				continue
+			}
+			output, err := processSubValue(cmap, subProcessors, *pair.value)
+			if err != nil {
+				return "", fmt.Errorf("hstore key %q: %s", pair.key, err)
+			}
+			pairs[i].value = output
+		}
+
+		return escapeCopyText(formatHstore(pairs)), nil
+	}, nil
+}
+
+// processSubValue runs the sub-processors against a part of a structured value. Processors expect COPY escaped text so
+// the value is escaped before and unescaped after processing. The output is nil if the sub-processors wrote NULL.
+func processSubValue(cmap *ColumnMapper, subProcessors []ProcessorDefinition, value string) (*string, error) {
+	subMap := *cmap
+	subMap.Processors = subProcessors
+
+	output, err := processValue(&subMap, escapeCopyText(value))
+	if err != nil {
+		return nil, err
+	}
+	if output == copyNull {
+		return nil, nil
+	}
+	output = unescapeCopyText(output)
+	return &output, nil
+}
+
+// parseHstore parses the text output of an hstore value.
+func parseHstore(input string) ([]hstorePair, error) {
+	var pairs []hstorePair
+
+	i := 0
+	skipSpace := func() {
+		for i < len(input) && (input[i] == ' ' || input[i] == '\t' || input[i] == '\n' || input[i] == '\r') {
+			i++
+		}
+	}
+	readQuoted := func() (string, error) {
+		if i >= len(input) || input[i] != '"' {
+			return "", errors.New("Invalid hstore: expected '\"'")
+		}
+		var b strings.Builder
+		for i++; i < len(input); i++ {
+			switch input[i] {
+			case '\\':
+				i++
+				if i < len(input) {
+					b.WriteByte(input[i])
+				}
+			case '"':
+				i++
+				return b.String(), nil
+			default:
+				b.WriteByte(input[i])
+			}
+		}
+		return "", errors.New("Invalid hstore: unterminated string")
+	}
+
+	for skipSpace(); i < len(input); skipSpace() {
+		key, err := readQuoted()
+		if err != nil {
+			return nil, err
+		}
+		skipSpace()
+		if !strings.HasPrefix(input[i:], "=>") {
+			return nil, errors.New("Invalid hstore: expected '=>'")
+		}
+		i += 2
+		skipSpace()
+
+		pair := hstorePair{key: key}
+		if strings.HasPrefix(strings.ToUpper(input[i:]), "NULL") {
+			i += 4
+		} else {
+			value, err := readQuoted()
+			if err != nil {
+				return nil, err
+			}
+			pair.value = &value
+		}
+		pairs = append(pairs, pair)
+
+		skipSpace()
+		if i < len(input) {
+			if input[i] != ',' {
+				return nil, errors.New("Invalid hstore: expected ','")
+			}
+			i++
+		}
+	}
+	return pairs, nil
+}
+
+// formatHstore formats pairs the same way PostgreSQL does.
+func formatHstore(pairs []hstorePair) string {
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+
+	parts := make([]string, len(pairs))
+	for i, pair := range pairs {
+		value := "NULL"
+		if pair.value != nil {
+			value = quote(*pair.value)
+		}
+		parts[i] = quote(pair.key) + "=>" + value
+	}
+	return strings.Join(parts, ", ")
+}
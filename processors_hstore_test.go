@@ -0,0 +1,68 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHstore(t *testing.T) {
+	pairs, err := parseHstore(`"a"=>"1", "b"=>NULL, "quote\"d"=>"back\\slash"`)
+	require.Nil(t, err)
+	require.Len(t, pairs, 3)
+	require.Equal(t, "a", pairs[0].key)
+	require.Equal(t, "1", *pairs[0].value)
+	require.Nil(t, pairs[1].value)
+	require.Equal(t, `quote"d`, pairs[2].key)
+	require.Equal(t, `back\slash`, *pairs[2].value)
+	require.Equal(t, `"a"=>"1", "b"=>NULL, "quote\"d"=>"back\\slash"`, formatHstore(pairs))
+
+	pairs, err = parseHstore("")
+	require.Nil(t, err)
+	require.Len(t, pairs, 0)
+
+	for _, input := range []string{`"a"`, `"a"=>`, `"a"=>"1" "b"=>"2"`, `a=>1`, `"a"=>"1`} {
+		_, err = parseHstore(input)
+		require.NotNil(t, err, input)
+	}
+}
+
+func TestProcessorHstoreKeys(t *testing.T) {
+	cmap := ColumnMapper{
+		Processors: []ProcessorDefinition{
+			{
+				Name: "HstoreKeys",
+				SubProcessors: map[string][]ProcessorDefinition{
+					"email":    {{Name: "ScrubString"}},
+					"nickname": {{Name: "ScrubString"}},
+				},
+			},
+		},
+	}
+
+	// Backslashes are doubled inside of a COPY block
+	input := `"email"=>"rick@example.com", "nickname"=>NULL, "note"=>"C:\\\\temp"`
+	output, err := ProcessorHstoreKeys(&cmap, input)
+	require.Nil(t, err)
+	require.Equal(t, `"email"=>"****************", "nickname"=>NULL, "note"=>"C:\\\\temp"`, output)
+
+	_, err = ProcessorHstoreKeys(&cmap, `"email"=>`)
+	require.NotNil(t, err)
+
+	// a NULL written by the sub-processors is an hstore NULL, not the text "N"
+	cmap = ColumnMapper{
+		IsNullable: true,
+		Processors: []ProcessorDefinition{
+			{
+				Name: "HstoreKeys",
+				SubProcessors: map[string][]ProcessorDefinition{
+					"email":    {{Name: "Expression", Params: map[string]interface{}{"Expression": "null"}}},
+					"nickname": {{Name: "ScrubString"}},
+				},
+			},
+		},
+	}
+	output, err = ProcessorHstoreKeys(&cmap, `"email"=>"rick@example.com", "nickname"=>"rick"`)
+	require.Nil(t, err)
+	require.Equal(t, `"email"=>NULL, "nickname"=>"****"`, output)
+}
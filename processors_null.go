@@ -0,0 +1,68 @@
+package gonymizer
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// constantConfig is the Params of the Constant processor.
+type constantConfig struct {
+	Value string
+}
+
+// nullProcessors only write NULL and can only be used on nullable columns.
+var nullProcessors = map[string]bool{
+	"NullBytea": true,
+	"SetNull":   true,
+}
+
+// ProcessorSetNull will replace a value with NULL. The column must be nullable.
+func ProcessorSetNull(cmap *ColumnMapper, input string) (string, error) {
+	if !cmap.IsNullable {
+		return "", fmt.Errorf("Column %s.%s.%s is not nullable", cmap.TableSchema, cmap.TableName, cmap.ColumnName)
+	}
+	return copyNull, nil
+}
+
+// ProcessorConstant will replace a value with the Value in the column's Params.
+func ProcessorConstant(cmap *ColumnMapper, input string) (string, error) {
+	return runConstructed(cmap, input, "Constant", newConstant)
+}
+
+// newConstant is the constructor for the Constant processor.
+func newConstant(procDef ProcessorDefinition) (ProcessorFunc, error) {
+	var config constantConfig
+	if err := procDef.DecodeParams(&config); err != nil {
+		return nil, err
+	}
+	output := escapeCopyText(config.Value)
+
+	return func(cmap *ColumnMapper, input string) (string, error) {
+		return output, nil
+	}, nil
+}
+
+// injectNull returns true for the fraction of values, given by the column's NullRate, that are replaced with NULL.
+func injectNull(cmap *ColumnMapper) bool {
+	return cmap.NullRate > 0 && rand.Float64() < cmap.NullRate
+}
+
+// validateNulls checks the NULL options of a column, and that processors that only write NULL are used on nullable
+// columns.
+func validateNulls(path string, cmap ColumnMapper) error {
+	if cmap.NullRate < 0 || cmap.NullRate > 1 {
+		return fmt.Errorf("%s: NullRate must be between 0 and 1", path)
+	}
+	if cmap.IsNullable {
+		return nil
+	}
+	if cmap.NullRate > 0 {
+		return fmt.Errorf("%s: NullRate requires a nullable column", path)
+	}
+	for i, procDef := range cmap.Processors {
+		if nullProcessors[procDef.Name] {
+			return fmt.Errorf("%s Processors[%d]: Processor %s requires a nullable column", path, i, procDef.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package gonymizer
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessorSetNull(t *testing.T) {
+	output, err := ProcessorSetNull(&ColumnMapper{IsNullable: true}, "secret")
+	require.Nil(t, err)
+	require.Equal(t, copyNull, output)
+
+	_, err = ProcessorSetNull(&ColumnMapper{}, "secret")
+	require.NotNil(t, err)
+}
+
+func TestProcessorConstant(t *testing.T) {
+	cmap := ColumnMapper{
+		Processors: []ProcessorDefinition{{Name: "Constant", Params: map[string]interface{}{"Value": "n/a\tnone"}}},
+	}
+	output, err := ProcessorConstant(&cmap, "secret")
+	require.Nil(t, err)
+	require.Equal(t, "n/a\\tnone", output)
+
+	require.Nil(t, validateProcessorDefinition(cmap.Processors[0]))
+	require.NotNil(t, validateProcessorDefinition(ProcessorDefinition{Name: "Constant"}))
+	require.NotNil(t, validateProcessorDefinition(ProcessorDefinition{
+		Name:   "Constant",
+		Params: map[string]interface{}{"Value": 0.0},
+	}))
+}
+
+func TestValidateNulls(t *testing.T) {
+	valid := []ColumnMapper{
+		{IsNullable: true, NullRate: 0.5},
+		{IsNullable: true, Processors: []ProcessorDefinition{{Name: "SetNull"}}},
+		{Processors: []ProcessorDefinition{{Name: "Identity"}}},
+	}
+	for i, cmap := range valid {
+		require.Nil(t, validateNulls("public.people.name", cmap), i)
+	}
+
+	invalid := []ColumnMapper{
+		{IsNullable: true, NullRate: 1.5},
+		{IsNullable: true, NullRate: -0.1},
+		{NullRate: 0.1},
+		{Processors: []ProcessorDefinition{{Name: "Identity"}, {Name: "SetNull"}}},
+	}
+	for i, cmap := range invalid {
+		require.NotNil(t, validateNulls("public.people.name", cmap), i)
+	}
+	err := validateNulls("public.people.name", invalid[3])
+	require.Equal(t, "public.people.name Processors[1]: Processor SetNull requires a nullable column", err.Error())
+}
+
+func TestNullRate(t *testing.T) {
+	rand.Seed(42)
+
+	cmap := ColumnMapper{IsNullable: true, NullRate: 0.25, Processors: []ProcessorDefinition{{Name: "ScrubString"}}}
+	inputs := make([]string, 4000)
+	for i := range inputs {
+		inputs[i] = "secret"
+	}
+	outputs, err := processValues(&cmap, inputs)
+	require.Nil(t, err)
+
+	nulls := 0
+	for _, output := range outputs {
+		if output == copyNull {
+			nulls++
+		} else {
+			require.Equal(t, "******", output)
+		}
+	}
+	require.InDelta(t, 1000, nulls, 150)
+
+	// NULL values stay NULL
+	rows := processRowsFromChunk([]*ColumnMapper{&cmap}, []string{"\\N\n", "\\N\n"}, Chunk{ColumnNames: []string{"a"}})
+	require.Equal(t, []string{"\\N\n", "\\N\n"}, rows)
+}
+
+func TestProcessNulls(t *testing.T) {
+	cmap := ColumnMapper{
+		IsNullable:   true,
+		ProcessNulls: true,
+		Processors:   []ProcessorDefinition{expressionStep(`input == null ? "was null" : input`)},
+	}
+	rows := processRowsFromChunk([]*ColumnMapper{&cmap}, []string{"\\N\n", "kept\n"}, Chunk{ColumnNames: []string{"a"}})
+	require.Equal(t, []string{"was null\n", "kept\n"}, rows)
+	require.Equal(t, "was null\n", processRawValue("\\N\n", "a", &cmap))
+
+	dbMap := DBMapper{ColumnMaps: []ColumnMapper{cmap}}
+	dbMap.ColumnMaps[0].TableSchema = "public"
+	dbMap.ColumnMaps[0].TableName = "people"
+	dbMap.ColumnMaps[0].ColumnName = "a"
+	state := LineState{SchemaName: "public", TableName: "people", ColumnNames: []string{"a"}}
+	_, output, err := processRow(&dbMap, &state, "\\N\n")
+	require.Nil(t, err)
+	require.Equal(t, "was null\n", output)
+
+	cmap.ProcessNulls = false
+	rows = processRowsFromChunk([]*ColumnMapper{&cmap}, []string{"\\N\n"}, Chunk{ColumnNames: []string{"a"}})
+	require.Equal(t, []string{"\\N\n"}, rows)
+}
@@ -0,0 +1,285 @@
+package gonymizer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The OrderPreservingToken processor replaces identifiers with tokens that sort in the same order as the originals, so
+// range queries and ORDER BY behave the same on the processed data. Tokens are derived from a key and are the same in
+// every run that uses the key. No two identifiers get the same token.
+//
+// The token of a value is found by walking a binary tree over the input space. Each node splits its part of the input
+// space in half and, using an HMAC of the node, picks where to split its part of the output space. Both halves of the
+// output space are at least as large as their input halves, so the mapping is strictly increasing and every value gets
+// a token of its own.
+
+// Character sets of the OrderPreservingToken processor, in byte order
+var orderedCharsets = map[string]string{
+	"alphanumeric": "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	"uppercase":    "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"digits":       "0123456789",
+}
+
+// orderedTokenConfig is the Params of the OrderPreservingToken processor.
+type orderedTokenConfig struct {
+	Key        string
+	KeyEnv     string
+	Expansion  int64
+	Charset    string
+	ExtraWidth int
+}
+
+// ProcessorOrderPreservingToken will replace an integer or a fixed-width identifier with a token that sorts in the same
+// order.
+//
+// Example, with Charset digits:
+// "INV-420017" < "INV-541290" = ProcessorOrderPreservingToken("INV-0017") < ProcessorOrderPreservingToken("INV-0018")
+func ProcessorOrderPreservingToken(cmap *ColumnMapper, input string) (string, error) {
+	return runConstructed(cmap, input, "OrderPreservingToken", newOrderPreservingToken)
+}
+
+// integerBitSizes are the sizes in bits of the integer data types.
+var integerBitSizes = map[string]uint{"smallint": 16, "integer": 32, "bigint": 64}
+
+// newOrderPreservingToken is the constructor for the OrderPreservingToken processor.
+func newOrderPreservingToken(procDef ProcessorDefinition) (ProcessorFunc, error) {
+	config := orderedTokenConfig{Expansion: 16, Charset: "alphanumeric", ExtraWidth: 2}
+	if err := procDef.DecodeParams(&config); err != nil {
+		return nil, err
+	}
+
+	key := config.Key
+	if config.KeyEnv != "" {
+		if key != "" {
+			return nil, errors.New("Params Key and KeyEnv can not both be set")
+		}
+		key = os.Getenv(config.KeyEnv)
+		if key == "" {
+			return nil, fmt.Errorf("Environment variable %s is not set", config.KeyEnv)
+		}
+	}
+	if key == "" {
+		return nil, errors.New("Requires Params Key or KeyEnv")
+	}
+
+	charset, ok := orderedCharsets[config.Charset]
+	if !ok {
+		return nil, fmt.Errorf("Unknown Charset %q. Expected one of: alphanumeric, uppercase, digits", config.Charset)
+	}
+	if config.Expansion < 2 {
+		return nil, errors.New("Expansion must be at least 2")
+	}
+	if config.ExtraWidth < 1 {
+		return nil, errors.New("ExtraWidth must be at least 1")
+	}
+
+	// the input range is only needed for integer columns, which is checked when the processor runs
+	var minimum, maximum int64
+	if procDef.Max != 0 || procDef.Min != 0 {
+		if procDef.Min != math.Trunc(procDef.Min) || procDef.Max != math.Trunc(procDef.Max) || procDef.Max <= procDef.Min {
+			return nil, fmt.Errorf("Min (%v) and Max (%v) must be integers with Min < Max", procDef.Min, procDef.Max)
+		}
+		if procDef.Min < math.MinInt64 || procDef.Max >= math.MaxInt64 {
+			return nil, fmt.Errorf("Min (%v) and Max (%v) must fit a bigint", procDef.Min, procDef.Max)
+		}
+		minimum, maximum = int64(procDef.Min), int64(procDef.Max)
+		if err := checkOrderedRange(minimum, maximum, config.Expansion, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(cmap *ColumnMapper, input string) (string, error) {
+		tokenKey := hmacSum([]byte(key), []byte(consistencyKey(cmap)))
+
+		if bitSize, ok := integerBitSizes[cmap.DataType]; ok {
+			if minimum == maximum {
+				return "", errors.New("Requires Min and Max for integer columns")
+			}
+			if err := checkOrderedRange(minimum, maximum, config.Expansion, bitSize); err != nil {
+				return "", err
+			}
+			return orderedInteger(tokenKey, minimum, maximum, config.Expansion, input)
+		}
+		return orderedString(tokenKey, charset, config.ExtraWidth, input)
+	}, nil
+}
+
+// checkOrderedRange returns an error if the tokens of the integers in [minimum, maximum] do not fit an integer of the
+// given size in bits.
+func checkOrderedRange(minimum, maximum, expansion int64, bitSize uint) error {
+	limit := new(big.Int).Lsh(big.NewInt(1), bitSize-1)
+	last := new(big.Int).Sub(big.NewInt(maximum), big.NewInt(minimum))
+	last.Add(last, big.NewInt(1))
+	last.Mul(last, big.NewInt(expansion))
+	last.Add(last, big.NewInt(minimum-1))
+	if big.NewInt(minimum).Cmp(new(big.Int).Neg(limit)) < 0 || last.Cmp(limit) >= 0 {
+		return fmt.Errorf("Tokens of Min (%d) to Max (%d) with Expansion %d go up to %s, which does not fit a %d bit "+
+			"integer", minimum, maximum, expansion, last, bitSize)
+	}
+	return nil
+}
+
+// validateOrderedRanges checks that the tokens of the OrderPreservingToken processors of an integer column fit its data
+// type.
+func validateOrderedRanges(path string, cmap ColumnMapper) error {
+	bitSize, ok := integerBitSizes[cmap.DataType]
+	if !ok {
+		return nil
+	}
+	for i, procDef := range cmap.Processors {
+		if procDef.Name != "OrderPreservingToken" || procDef.Max <= procDef.Min {
+			continue
+		}
+		// the Params were checked when the processors were validated
+		config := orderedTokenConfig{Expansion: 16}
+		_ = procDef.DecodeParams(&config)
+		if err := checkOrderedRange(int64(procDef.Min), int64(procDef.Max), config.Expansion, bitSize); err != nil {
+			return fmt.Errorf("%s[%d]: %s", path, i, err)
+		}
+	}
+	return nil
+}
+
+// consistencyKey returns the column whose values a column shares, which is its parent column if it has one. Columns that
+// share values get the same tokens.
+func consistencyKey(cmap *ColumnMapper) string {
+	if cmap.ParentSchema != "" && cmap.ParentTable != "" && cmap.ParentColumn != "" {
+		return fmt.Sprintf("%s.%s.%s", cmap.ParentSchema, cmap.ParentTable, cmap.ParentColumn)
+	}
+	return fmt.Sprintf("%s.%s.%s", cmap.TableSchema, cmap.TableName, cmap.ColumnName)
+}
+
+// orderedInteger maps an integer in [minimum, maximum] to [minimum, minimum + (maximum - minimum + 1) * expansion).
+func orderedInteger(key []byte, minimum, maximum, expansion int64, input string) (string, error) {
+	value, err := strconv.ParseInt(strings.TrimSpace(input), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%q is not an integer", input)
+	}
+	if value < minimum || value > maximum {
+		return "", fmt.Errorf("%d is outside of Min (%d) and Max (%d)", value, minimum, maximum)
+	}
+
+	base := big.NewInt(minimum)
+	domain := new(big.Int).Sub(big.NewInt(maximum), base)
+	domain.Add(domain, big.NewInt(1))
+	space := new(big.Int).Mul(domain, big.NewInt(expansion))
+
+	token := orderedEncode(treeKey(key, "integer"), domain, space, new(big.Int).Sub(big.NewInt(value), base))
+	return token.Add(token, base).String(), nil
+}
+
+// orderedString maps the characters of the input that are in the charset to a token with extraWidth more characters.
+// The other characters are kept in place and the extra characters are put before the first tokenized character, so
+// values with the same format keep their order.
+func orderedString(key []byte, charset string, extraWidth int, input string) (string, error) {
+	input = unescapeCopyText(input)
+
+	var positions []int
+	value := new(big.Int)
+	radix := big.NewInt(int64(len(charset)))
+	for i := 0; i < len(input); i++ {
+		if digit := strings.IndexByte(charset, input[i]); digit >= 0 {
+			positions = append(positions, i)
+			value.Mul(value, radix)
+			value.Add(value, big.NewInt(int64(digit)))
+		}
+	}
+	if len(positions) == 0 {
+		return escapeCopyText(input), nil
+	}
+
+	width := len(positions)
+	domain := new(big.Int).Exp(radix, big.NewInt(int64(width)), nil)
+	space := new(big.Int).Exp(radix, big.NewInt(int64(width+extraWidth)), nil)
+
+	// the tree depends on the width, so identifiers of different widths get unrelated tokens
+	token := orderedEncode(treeKey(key, "string"+strconv.Itoa(width)), domain, space, value)
+
+	digits := make([]byte, width+extraWidth)
+	remainder := new(big.Int)
+	for i := len(digits) - 1; i >= 0; i-- {
+		token.QuoRem(token, radix, remainder)
+		digits[i] = charset[remainder.Int64()]
+	}
+
+	var output strings.Builder
+	output.WriteString(input[:positions[0]])
+	output.Write(digits[:extraWidth])
+	next := extraWidth
+	for i := positions[0]; i < len(input); i++ {
+		if next < len(digits) && strings.IndexByte(charset, input[i]) >= 0 {
+			output.WriteByte(digits[next])
+			next++
+		} else {
+			output.WriteByte(input[i])
+		}
+	}
+	return escapeCopyText(output.String()), nil
+}
+
+// orderedEncode maps a value in [0, domain) to [0, space) with a strictly increasing function that is chosen by the key.
+// space must not be smaller than domain.
+func orderedEncode(key []byte, domain, space, value *big.Int) *big.Int {
+	one := big.NewInt(1)
+	dlo, dhi := new(big.Int), new(big.Int).Sub(domain, one)
+	rlo, rhi := new(big.Int), new(big.Int).Sub(space, one)
+
+	for dlo.Cmp(dhi) < 0 {
+		middle := new(big.Int).Add(dlo, dhi)
+		middle.Rsh(middle, 1)
+
+		// the split leaves room for every input of both halves
+		low := new(big.Int).Sub(middle, dlo)
+		low.Add(low, rlo)
+		high := new(big.Int).Sub(dhi, middle)
+		high.Sub(rhi, high)
+		choices := new(big.Int).Sub(high, low)
+		split := orderedPick(key, dlo, dhi, choices.Add(choices, one))
+		split.Add(split, low)
+
+		if value.Cmp(middle) <= 0 {
+			dhi, rhi = middle, split
+		} else {
+			dlo, rlo = middle.Add(middle, one), split.Add(split, one)
+		}
+	}
+
+	choices := new(big.Int).Sub(rhi, rlo)
+	token := orderedPick(key, dlo, dlo, choices.Add(choices, one))
+	return token.Add(token, rlo)
+}
+
+// orderedPick returns a number in [0, n) that is chosen by the key and the node [dlo, dhi] of the tree.
+func orderedPick(key []byte, dlo, dhi, n *big.Int) *big.Int {
+	node := []byte(dlo.String() + ":" + dhi.String())
+
+	// 8 more bytes than n needs keep the bias of the modulo negligible
+	var stream []byte
+	counter := make([]byte, 4)
+	for i := uint32(0); len(stream) < len(n.Bytes())+8; i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		stream = append(stream, hmacSum(key, append(counter, node...))...)
+	}
+	return new(big.Int).Mod(new(big.Int).SetBytes(stream), n)
+}
+
+// treeKey returns the key of the tree used for a kind of input.
+func treeKey(key []byte, kind string) []byte {
+	return hmacSum(key, []byte(kind))
+}
+
+// hmacSum returns the HMAC-SHA256 of data.
+func hmacSum(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,153 @@
+package gonymizer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func orderedTokenColumn(dataType string, params map[string]interface{}, min, max float64) ColumnMapper {
+	return ColumnMapper{
+		TableSchema: "public",
+		TableName:   "invoices",
+		ColumnName:  "number",
+		DataType:    dataType,
+		Processors: []ProcessorDefinition{
+			{Name: "OrderPreservingToken", Min: min, Max: max, Params: params},
+		},
+	}
+}
+
+func TestProcessorOrderPreservingTokenInteger(t *testing.T) {
+	cmap := orderedTokenColumn("integer", map[string]interface{}{"Key": "secret"}, -50, 1000)
+
+	previous := int64(-51)
+	seen := make(map[string]bool)
+	for value := -50; value <= 1000; value++ {
+		output, err := ProcessorOrderPreservingToken(&cmap, strconv.Itoa(value))
+		require.Nil(t, err)
+		token, err := strconv.ParseInt(output, 10, 64)
+		require.Nil(t, err)
+		require.True(t, token > previous, "%d maps to %d, which is not larger than %d", value, token, previous)
+		require.True(t, token < -50+1051*16)
+		require.False(t, seen[output])
+		seen[output] = true
+		previous = token
+	}
+
+	// the same key gives the same tokens, another key gives others
+	first, _ := ProcessorOrderPreservingToken(&cmap, "500")
+	again, _ := ProcessorOrderPreservingToken(&cmap, "500")
+	require.Equal(t, first, again)
+	other := orderedTokenColumn("integer", map[string]interface{}{"Key": "other"}, -50, 1000)
+	differs := false
+	for value := 0; value < 10; value++ {
+		a, _ := ProcessorOrderPreservingToken(&cmap, strconv.Itoa(value))
+		b, _ := ProcessorOrderPreservingToken(&other, strconv.Itoa(value))
+		differs = differs || a != b
+	}
+	require.True(t, differs)
+
+	_, err := ProcessorOrderPreservingToken(&cmap, "1001")
+	require.NotNil(t, err)
+	_, err = ProcessorOrderPreservingToken(&cmap, "1.5")
+	require.NotNil(t, err)
+	noRange := orderedTokenColumn("integer", map[string]interface{}{"Key": "secret"}, 0, 0)
+	_, err = ProcessorOrderPreservingToken(&noRange, "1")
+	require.NotNil(t, err)
+}
+
+func TestProcessorOrderPreservingTokenString(t *testing.T) {
+	cmap := orderedTokenColumn("character varying", map[string]interface{}{"Key": "secret", "Charset": "digits"}, 0, 0)
+
+	var outputs []string
+	for value := 0; value < 300; value++ {
+		input := fmt.Sprintf("INV-%04d", value*7)
+		output, err := ProcessorOrderPreservingToken(&cmap, input)
+		require.Nil(t, err)
+		require.Regexp(t, `^INV-\d{6}$`, output)
+		outputs = append(outputs, output)
+	}
+	require.True(t, sort.StringsAreSorted(outputs))
+	for i := 1; i < len(outputs); i++ {
+		require.NotEqual(t, outputs[i-1], outputs[i])
+	}
+
+	cmap = orderedTokenColumn("text", map[string]interface{}{"Key": "secret"}, 0, 0)
+	var tokens []string
+	for _, input := range []string{"A0z", "A1a", "B00", "Ba0", "b00"} {
+		output, err := ProcessorOrderPreservingToken(&cmap, input)
+		require.Nil(t, err)
+		require.Len(t, output, 5)
+		tokens = append(tokens, output)
+	}
+	require.True(t, sort.StringsAreSorted(tokens))
+
+	output, err := ProcessorOrderPreservingToken(&cmap, "--")
+	require.Nil(t, err)
+	require.Equal(t, "--", output)
+}
+
+func TestProcessorOrderPreservingTokenParent(t *testing.T) {
+	params := map[string]interface{}{"Key": "secret"}
+	parent := orderedTokenColumn("bigint", params, 1, 100000)
+	child := orderedTokenColumn("bigint", params, 1, 100000)
+	child.TableName = "payments"
+	child.ColumnName = "invoice_number"
+	child.ParentSchema, child.ParentTable, child.ParentColumn = "public", "invoices", "number"
+
+	for _, value := range []string{"1", "42", "99999"} {
+		fromParent, err := ProcessorOrderPreservingToken(&parent, value)
+		require.Nil(t, err)
+		fromChild, err := ProcessorOrderPreservingToken(&child, value)
+		require.Nil(t, err)
+		require.Equal(t, fromParent, fromChild)
+	}
+}
+
+func TestNewOrderPreservingToken(t *testing.T) {
+	valid := []ProcessorDefinition{
+		{Name: "OrderPreservingToken", Params: map[string]interface{}{"Key": "secret"}},
+		{Name: "OrderPreservingToken", Min: 1, Max: 10, Params: map[string]interface{}{"Key": "secret", "Expansion": 4}},
+		{Name: "OrderPreservingToken", Params: map[string]interface{}{"KeyEnv": "PATH"}},
+	}
+	for _, procDef := range valid {
+		require.Nil(t, validateProcessorDefinition(procDef))
+	}
+
+	invalid := []ProcessorDefinition{
+		{Name: "OrderPreservingToken"},
+		{Name: "OrderPreservingToken", Params: map[string]interface{}{"Key": "secret", "KeyEnv": "PATH"}},
+		{Name: "OrderPreservingToken", Params: map[string]interface{}{"KeyEnv": "GONYMIZER_UNSET_TOKEN_KEY"}},
+		{Name: "OrderPreservingToken", Params: map[string]interface{}{"Key": "secret", "Charset": "hex"}},
+		{Name: "OrderPreservingToken", Params: map[string]interface{}{"Key": "secret", "Expansion": 1}},
+		{Name: "OrderPreservingToken", Params: map[string]interface{}{"Key": "secret", "ExtraWidth": 0}},
+		{Name: "OrderPreservingToken", Min: 10, Max: 1, Params: map[string]interface{}{"Key": "secret"}},
+		{Name: "OrderPreservingToken", Min: 0.5, Max: 10, Params: map[string]interface{}{"Key": "secret"}},
+		{Name: "OrderPreservingToken", Min: 0, Max: 1e18, Params: map[string]interface{}{"Key": "secret"}},
+		{Name: "OrderPreservingToken", Min: 0, Max: 1e19, Params: map[string]interface{}{"Key": "secret"}},
+	}
+	for _, procDef := range invalid {
+		require.NotNil(t, validateProcessorDefinition(procDef), "%+v", procDef)
+	}
+
+	// the tokens must fit the column's integer type
+	dbMap := DBMapper{DBName: "test", ColumnMaps: []ColumnMapper{
+		orderedTokenColumn("smallint", map[string]interface{}{"Key": "secret"}, 0, 2047),
+		orderedTokenColumn("integer", map[string]interface{}{"Key": "secret"}, 0, 2047),
+	}}
+	require.Nil(t, dbMap.Validate())
+	dbMap.ColumnMaps[0].Processors[0].Max = 2048
+	err := dbMap.Validate()
+	require.NotNil(t, err)
+	require.Equal(t, "public.invoices.number Processors[0]: Tokens of Min (0) to Max (2048) with Expansion 16 go up "+
+		"to 32783, which does not fit a 16 bit integer", err.Error())
+	_, err = ProcessorOrderPreservingToken(&dbMap.ColumnMaps[0], "1")
+	require.NotNil(t, err)
+
+	require.Nil(t, checkOrderedRange(-32768, -32768+2047, 16, 16))
+	require.NotNil(t, checkOrderedRange(-32769, 0, 2, 16))
+}
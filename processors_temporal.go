@@ -0,0 +1,524 @@
+package gonymizer
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The processors in this file understand the text formats that pg_dump writes for date, timestamp, timestamptz, time,
+// timetz, and interval columns. pg_dump always runs with DateStyle=ISO and IntervalStyle=postgres so those are the only
+// styles we need to parse and re-emit:
+//
+//   date:        2018-08-28, 0044-03-15 BC, infinity, -infinity
+//   timestamp:   2018-08-28 13:45:12, 2018-08-28 13:45:12.123456, 0044-03-15 12:00:00 BC
+//   timestamptz: 2018-08-28 13:45:12.5-07, 1890-01-01 00:00:00+00:53:28
+//   time:        13:45:12, 13:45:12.25, 24:00:00
+//   timetz:      13:45:12+05:30
+//   interval:    1 year 2 mons -3 days +04:05:06.789, -00:00:01, 00:00:00
+//
+// Values that are infinity or -infinity are passed through untouched since they are sentinels and not PII.
+//
+// All Min, Max, and Variance values in the ProcessorDefinition are expressed in seconds. For timestamps Min and Max are
+// Unix epoch seconds, for time columns they are seconds since midnight, and for intervals they are the interval length.
+
+const (
+	microsPerSecond = int64(1000000)
+	microsPerHour   = 3600 * microsPerSecond
+	microsPerDay    = 24 * microsPerHour
+)
+
+// temporalKind is the family of PostgreSQL date/time type a value belongs to.
+type temporalKind int
+
+const (
+	temporalTimestamp temporalKind = iota // date, timestamp, and timestamptz
+	temporalTime                          // time and timetz
+	temporalInterval                      // interval
+)
+
+var (
+	pgTimestampRegex = regexp.MustCompile(
+		`^(\d{4,})-(\d{2})-(\d{2})(?: (\d{2}):(\d{2}):(\d{2})(?:\.(\d{1,6}))?([+-]\d{2}(?::\d{2}(?::\d{2})?)?)?)?( BC)?$`)
+	pgTimeRegex = regexp.MustCompile(
+		`^(\d{2}):(\d{2}):(\d{2})(?:\.(\d{1,6}))?([+-]\d{2}(?::\d{2}(?::\d{2})?)?)?$`)
+	pgIntervalTimeRegex = regexp.MustCompile(`^([+-])?(\d+):(\d{2}):(\d{2})(?:\.(\d{1,6}))?$`)
+)
+
+// pgTimestamp is a parsed date, timestamp, or timestamptz value.
+type pgTimestamp struct {
+	t         time.Time
+	hasTime   bool
+	hasOffset bool
+	precision int
+}
+
+// pgTime is a parsed time or timetz value. micros is the time of day in microseconds and may be equal to microsPerDay
+// to represent 24:00:00.
+type pgTime struct {
+	micros    int64
+	offset    int
+	hasOffset bool
+	precision int
+}
+
+// pgInterval is a parsed interval value using the same month, day, and microsecond fields as PostgreSQL.
+type pgInterval struct {
+	months    int64
+	days      int64
+	micros    int64
+	precision int
+}
+
+// ProcessorRandomTimestamp will replace a date, timestamp, time, or interval with a random value of the same type. If
+// Min and Max are set the value is picked uniformly from that range (in seconds), otherwise timestamps keep their year,
+// times are picked from the whole day, and intervals are picked between zero and twice their original length.
+func ProcessorRandomTimestamp(cmap *ColumnMapper, input string) (string, error) {
+	return runConstructed(cmap, input, "RandomTimestamp", newRandomTimestamp)
+}
+
+// newRandomTimestamp is the constructor for RandomTimestamp.
+func newRandomTimestamp(procDef ProcessorDefinition) (ProcessorFunc, error) {
+	rangeMin, rangeMax := int64(procDef.Min*float64(microsPerSecond)), int64(procDef.Max*float64(microsPerSecond))
+
+	return func(cmap *ColumnMapper, input string) (string, error) {
+		if isPgInfinity(input) {
+			return input, nil
+		}
+		min, max := rangeMin, rangeMax
+
+		switch temporalKindOf(cmap, input) {
+		case temporalTime:
+			tm, err := parsePgTime(input)
+			if err != nil {
+				return "", err
+			}
+			if max <= min {
+				min, max = 0, microsPerDay-1
+			} else if max > microsPerDay {
+				max = microsPerDay
+			}
+			tm.micros = randomInt64Between(min, max)
+			return tm.String(), nil
+		case temporalInterval:
+			iv, err := parsePgInterval(input)
+			if err != nil {
+				return "", err
+			}
+			if max <= min {
+				min, max = 0, 2*iv.approximateMicros()
+				if max < 0 {
+					min, max = max, 0
+				}
+			}
+			iv.months, iv.days, iv.micros = 0, 0, randomInt64Between(min, max)
+			return iv.String(), nil
+		default:
+			ts, err := parsePgTimestamp(input)
+			if err != nil {
+				return "", err
+			}
+			loc := ts.t.Location()
+			if max <= min {
+				// NOTE: Like RandomDate we keep the year the same (See: HIPAA rules)
+				start := time.Date(ts.t.Year(), time.January, 1, 0, 0, 0, 0, loc)
+				min, max = start.UnixMicro(), start.AddDate(1, 0, 0).UnixMicro()-1
+			}
+			ts.t = time.UnixMicro(randomInt64Between(min, max)).In(loc)
+			return ts.String(), nil
+		}
+	}, nil
+}
+
+// ProcessorJitterTimestamp will shift a date, timestamp, time, or interval by a random amount of up to ±Variance
+// seconds. Times wrap around midnight and dates are shifted by whole days.
+func ProcessorJitterTimestamp(cmap *ColumnMapper, input string) (string, error) {
+	return runConstructed(cmap, input, "JitterTimestamp", newJitterTimestamp)
+}
+
+// newJitterTimestamp is the constructor for JitterTimestamp.
+func newJitterTimestamp(procDef ProcessorDefinition) (ProcessorFunc, error) {
+	variance := int64(procDef.Variance * float64(microsPerSecond))
+	if variance < 0 {
+		variance = -variance
+	}
+
+	return func(cmap *ColumnMapper, input string) (string, error) {
+		if isPgInfinity(input) {
+			return input, nil
+		}
+		delta := randomInt64Between(-variance, variance)
+
+		switch temporalKindOf(cmap, input) {
+		case temporalTime:
+			tm, err := parsePgTime(input)
+			if err != nil {
+				return "", err
+			}
+			tm.micros = ((tm.micros+delta)%microsPerDay + microsPerDay) % microsPerDay
+			return tm.String(), nil
+		case temporalInterval:
+			iv, err := parsePgInterval(input)
+			if err != nil {
+				return "", err
+			}
+			iv.micros += delta
+			return iv.String(), nil
+		default:
+			ts, err := parsePgTimestamp(input)
+			if err != nil {
+				return "", err
+			}
+			ts.t = ts.t.Add(time.Duration(delta) * time.Microsecond)
+			return ts.String(), nil
+		}
+	}, nil
+}
+
+// ProcessorTruncateToDay will truncate a timestamp or time to midnight and drop the time portion of an interval.
+func ProcessorTruncateToDay(cmap *ColumnMapper, input string) (string, error) {
+	return truncateTemporal(cmap, input, microsPerDay)
+}
+
+// ProcessorTruncateToHour will truncate a timestamp, time, or interval to the start of the hour.
+func ProcessorTruncateToHour(cmap *ColumnMapper, input string) (string, error) {
+	return truncateTemporal(cmap, input, microsPerHour)
+}
+
+// truncateTemporal truncates the time of day portion of the input to a multiple of unit microseconds.
+func truncateTemporal(cmap *ColumnMapper, input string, unit int64) (string, error) {
+	if isPgInfinity(input) {
+		return input, nil
+	}
+
+	switch temporalKindOf(cmap, input) {
+	case temporalTime:
+		tm, err := parsePgTime(input)
+		if err != nil {
+			return "", err
+		}
+		tm.micros -= tm.micros % unit
+		return tm.String(), nil
+	case temporalInterval:
+		iv, err := parsePgInterval(input)
+		if err != nil {
+			return "", err
+		}
+		iv.micros -= iv.micros % unit
+		return iv.String(), nil
+	default:
+		ts, err := parsePgTimestamp(input)
+		if err != nil {
+			return "", err
+		}
+		wall := time.Date(ts.t.Year(), ts.t.Month(), ts.t.Day(), 0, 0, 0, 0, ts.t.Location())
+		sinceMidnight := int64(ts.t.Hour())*microsPerHour + int64(ts.t.Minute()*60+ts.t.Second())*microsPerSecond
+		ts.t = wall.Add(time.Duration(sinceMidnight-sinceMidnight%unit) * time.Microsecond)
+		return ts.String(), nil
+	}
+}
+
+// temporalKindOf decides how to parse the input. The column's DataType is used when it is known, otherwise the format
+// of the input itself is used.
+func temporalKindOf(cmap *ColumnMapper, input string) temporalKind {
+	dataType := strings.ToLower(cmap.DataType)
+	switch {
+	case strings.HasPrefix(dataType, "interval"):
+		return temporalInterval
+	case strings.HasPrefix(dataType, "timestamp") || dataType == "date":
+		return temporalTimestamp
+	case strings.HasPrefix(dataType, "time"):
+		return temporalTime
+	}
+
+	if pgTimestampRegex.MatchString(input) {
+		return temporalTimestamp
+	} else if pgTimeRegex.MatchString(input) {
+		return temporalTime
+	}
+	return temporalInterval
+}
+
+// isPgInfinity returns true if the input is one of PostgreSQL's special infinite date/time values.
+func isPgInfinity(input string) bool {
+	return input == "infinity" || input == "-infinity"
+}
+
+// randomInt64Between returns a random number in the closed range [min, max].
+func randomInt64Between(min, max int64) int64 {
+	if max <= min {
+		return min
+	}
+	return min + rand.Int63n(max-min+1)
+}
+
+// parsePgTimestamp parses a date, timestamp, or timestamptz in the ISO DateStyle.
+func parsePgTimestamp(input string) (pgTimestamp, error) {
+	var ts pgTimestamp
+
+	m := pgTimestampRegex.FindStringSubmatch(input)
+	if m == nil {
+		return ts, fmt.Errorf("Timestamp format is not ISO-8601: %q", input)
+	}
+
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	day, _ := strconv.Atoi(m[3])
+	if m[9] != "" {
+		// There is no year 0 in PostgreSQL, 1 BC is astronomical year 0
+		year = 1 - year
+	}
+
+	var hour, minute, second, micros int
+	if m[4] != "" {
+		ts.hasTime = true
+		hour, _ = strconv.Atoi(m[4])
+		minute, _ = strconv.Atoi(m[5])
+		second, _ = strconv.Atoi(m[6])
+		micros, ts.precision = parsePgFraction(m[7])
+	}
+
+	loc := time.UTC
+	if m[8] != "" {
+		offset, err := parsePgOffset(m[8])
+		if err != nil {
+			return ts, err
+		}
+		ts.hasOffset = true
+		loc = time.FixedZone("", offset)
+	}
+
+	ts.t = time.Date(year, time.Month(month), day, hour, minute, second, micros*1000, loc)
+	if ts.t.Month() != time.Month(month) || hour > 23 || minute > 59 || second > 59 {
+		return ts, fmt.Errorf("Timestamp is out of range: %q", input)
+	}
+	return ts, nil
+}
+
+// String formats the timestamp the same way PostgreSQL would with DateStyle=ISO.
+func (ts pgTimestamp) String() string {
+	var b strings.Builder
+
+	year := ts.t.Year()
+	bc := year <= 0
+	if bc {
+		year = 1 - year
+	}
+	fmt.Fprintf(&b, "%04d-%02d-%02d", year, ts.t.Month(), ts.t.Day())
+
+	if ts.hasTime {
+		fmt.Fprintf(&b, " %02d:%02d:%02d", ts.t.Hour(), ts.t.Minute(), ts.t.Second())
+		b.WriteString(formatPgFraction(int64(ts.t.Nanosecond()/1000), ts.precision))
+		if ts.hasOffset {
+			_, offset := ts.t.Zone()
+			b.WriteString(formatPgOffset(offset))
+		}
+	}
+
+	if bc {
+		b.WriteString(" BC")
+	}
+	return b.String()
+}
+
+// parsePgTime parses a time or timetz value.
+func parsePgTime(input string) (pgTime, error) {
+	var tm pgTime
+
+	m := pgTimeRegex.FindStringSubmatch(input)
+	if m == nil {
+		return tm, fmt.Errorf("Time format is not ISO-8601: %q", input)
+	}
+
+	hour, _ := strconv.ParseInt(m[1], 10, 64)
+	minute, _ := strconv.ParseInt(m[2], 10, 64)
+	second, _ := strconv.ParseInt(m[3], 10, 64)
+	micros, precision := parsePgFraction(m[4])
+
+	tm.precision = precision
+	tm.micros = hour*microsPerHour + (minute*60+second)*microsPerSecond + int64(micros)
+	if minute > 59 || second > 59 || tm.micros > microsPerDay {
+		return tm, fmt.Errorf("Time is out of range: %q", input)
+	}
+
+	if m[5] != "" {
+		offset, err := parsePgOffset(m[5])
+		if err != nil {
+			return tm, err
+		}
+		tm.hasOffset = true
+		tm.offset = offset
+	}
+	return tm, nil
+}
+
+// String formats the time the same way PostgreSQL would.
+func (tm pgTime) String() string {
+	micros := tm.micros
+	seconds := micros / microsPerSecond
+	output := fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60) +
+		formatPgFraction(micros%microsPerSecond, tm.precision)
+	if tm.hasOffset {
+		output += formatPgOffset(tm.offset)
+	}
+	return output
+}
+
+// parsePgInterval parses an interval in the postgres IntervalStyle.
+func parsePgInterval(input string) (pgInterval, error) {
+	var iv pgInterval
+
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return iv, fmt.Errorf("Interval format is not supported: %q", input)
+	}
+
+	for i := 0; i < len(fields); i++ {
+		if m := pgIntervalTimeRegex.FindStringSubmatch(fields[i]); m != nil {
+			hours, _ := strconv.ParseInt(m[2], 10, 64)
+			minutes, _ := strconv.ParseInt(m[3], 10, 64)
+			seconds, _ := strconv.ParseInt(m[4], 10, 64)
+			micros, precision := parsePgFraction(m[5])
+
+			total := hours*microsPerHour + (minutes*60+seconds)*microsPerSecond + int64(micros)
+			if m[1] == "-" {
+				total = -total
+			}
+			iv.micros += total
+			iv.precision = precision
+			continue
+		}
+
+		if i+1 >= len(fields) {
+			return iv, fmt.Errorf("Interval format is not supported: %q", input)
+		}
+		value, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return iv, fmt.Errorf("Interval format is not supported: %q", input)
+		}
+		i++
+		switch fields[i] {
+		case "year", "years":
+			iv.months += value * 12
+		case "mon", "mons":
+			iv.months += value
+		case "day", "days":
+			iv.days += value
+		default:
+			return iv, fmt.Errorf("Interval format is not supported: %q", input)
+		}
+	}
+	return iv, nil
+}
+
+// approximateMicros returns the length of the interval assuming 30 day months like PostgreSQL's justify functions.
+func (iv pgInterval) approximateMicros() int64 {
+	return (iv.months*30+iv.days)*microsPerDay + iv.micros
+}
+
+// String formats the interval the same way PostgreSQL would with IntervalStyle=postgres.
+func (iv pgInterval) String() string {
+	var b strings.Builder
+	isZero, isBefore := true, false
+
+	addPart := func(value int64, unit string) {
+		if value == 0 {
+			return
+		}
+		if !isZero {
+			b.WriteString(" ")
+		}
+		if isBefore && value > 0 {
+			b.WriteString("+")
+		}
+		fmt.Fprintf(&b, "%d %s", value, unit)
+		if value != 1 {
+			b.WriteString("s")
+		}
+		isBefore = value < 0
+		isZero = false
+	}
+	addPart(iv.months/12, "year")
+	addPart(iv.months%12, "mon")
+	addPart(iv.days, "day")
+
+	if isZero || iv.micros != 0 {
+		micros := iv.micros
+		sign := ""
+		if micros < 0 {
+			sign = "-"
+			micros = -micros
+		} else if isBefore {
+			sign = "+"
+		}
+		if !isZero {
+			b.WriteString(" ")
+		}
+		seconds := micros / microsPerSecond
+		fmt.Fprintf(&b, "%s%02d:%02d:%02d", sign, seconds/3600, seconds/60%60, seconds%60)
+		b.WriteString(formatPgFraction(micros%microsPerSecond, iv.precision))
+	}
+	return b.String()
+}
+
+// parsePgFraction converts the digits after the decimal point into microseconds and returns the number of digits.
+func parsePgFraction(digits string) (int, int) {
+	if digits == "" {
+		return 0, 0
+	}
+	micros, _ := strconv.Atoi(digits + strings.Repeat("0", 6-len(digits)))
+	return micros, len(digits)
+}
+
+// formatPgFraction formats microseconds with at most precision digits and trailing zeros removed like PostgreSQL.
+func formatPgFraction(micros int64, precision int) string {
+	if precision <= 0 {
+		return ""
+	}
+	digits := strings.TrimRight(fmt.Sprintf("%06d", micros)[:precision], "0")
+	if digits == "" {
+		return ""
+	}
+	return "." + digits
+}
+
+// parsePgOffset converts a UTC offset such as -07, +05:30, or +00:53:28 into seconds east of UTC.
+func parsePgOffset(offset string) (int, error) {
+	parts := strings.Split(offset[1:], ":")
+	seconds := 0
+	for i, multiplier := range []int{3600, 60, 1} {
+		if i >= len(parts) {
+			break
+		}
+		value, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, errors.New("Unable to parse UTC offset: " + offset)
+		}
+		seconds += value * multiplier
+	}
+	if offset[0] == '-' {
+		seconds = -seconds
+	}
+	return seconds, nil
+}
+
+// formatPgOffset formats seconds east of UTC the same way PostgreSQL does, omitting minutes and seconds when zero.
+func formatPgOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	output := fmt.Sprintf("%s%02d", sign, seconds/3600)
+	if seconds%3600 != 0 {
+		output += fmt.Sprintf(":%02d", seconds/60%60)
+		if seconds%60 != 0 {
+			output += fmt.Sprintf(":%02d", seconds%60)
+		}
+	}
+	return output
+}
@@ -0,0 +1,164 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgTemporalRoundTrip(t *testing.T) {
+	timestamps := []string{
+		"2018-08-28",
+		"0044-03-15 BC",
+		"2018-08-28 13:45:12",
+		"2018-08-28 13:45:12.123456",
+		"2018-08-28 13:45:12.5-07",
+		"2018-08-28 13:45:12+05:30",
+		"1890-01-01 00:00:00+00:53:28",
+		"0044-03-15 12:00:00 BC",
+		"0001-01-01 00:00:00+00 BC",
+		"12345-06-07 08:09:10",
+	}
+	for _, input := range timestamps {
+		ts, err := parsePgTimestamp(input)
+		require.Nil(t, err, input)
+		require.Equal(t, input, ts.String())
+	}
+
+	times := []string{"13:45:12", "13:45:12.25", "24:00:00", "13:45:12+05:30", "00:00:00.000001-03"}
+	for _, input := range times {
+		tm, err := parsePgTime(input)
+		require.Nil(t, err, input)
+		require.Equal(t, input, tm.String())
+	}
+
+	intervals := []string{
+		"00:00:00",
+		"-00:00:01",
+		"1 day",
+		"3 days",
+		"1 mon",
+		"1 year 2 mons 3 days 04:05:06.789",
+		"-1 years -2 mons +3 days -04:05:06",
+		"-1 days +02:03:00",
+		"100:00:00",
+	}
+	for _, input := range intervals {
+		iv, err := parsePgInterval(input)
+		require.Nil(t, err, input)
+		require.Equal(t, input, iv.String())
+	}
+
+	for _, input := range []string{"", "2018/08/28", "2018-13-01 00:00:00", "1 fortnight", "P1Y2M"} {
+		_, err := parsePgTimestamp(input)
+		require.NotNil(t, err, input)
+		_, err = parsePgInterval(input)
+		require.NotNil(t, err, input)
+	}
+}
+
+func TestProcessorRandomTimestamp(t *testing.T) {
+	tsMap := ColumnMapper{
+		DataType:   "timestamp with time zone",
+		Processors: []ProcessorDefinition{{Name: "RandomTimestamp"}},
+	}
+
+	output, err := ProcessorRandomTimestamp(&tsMap, "2018-08-28 13:45:12.5-07")
+	require.Nil(t, err)
+	ts, err := parsePgTimestamp(output)
+	require.Nil(t, err)
+	require.Equal(t, 2018, ts.t.Year())
+	_, offset := ts.t.Zone()
+	require.Equal(t, -7*3600, offset)
+
+	output, err = ProcessorRandomTimestamp(&tsMap, "0044-03-15 12:00:00 BC")
+	require.Nil(t, err)
+	require.Regexp(t, `^0044-\d{2}-\d{2} \d{2}:\d{2}:\d{2} BC$`, output)
+
+	// Epoch seconds for 2000-01-01 and 2000-01-02
+	tsMap.Processors = []ProcessorDefinition{{Name: "RandomTimestamp", Min: 946684800, Max: 946771199}}
+	output, err = ProcessorRandomTimestamp(&tsMap, "2018-08-28 13:45:12+00")
+	require.Nil(t, err)
+	require.Regexp(t, `^2000-01-01 \d{2}:\d{2}:\d{2}\+00$`, output)
+
+	for _, input := range []string{"infinity", "-infinity"} {
+		output, err = ProcessorRandomTimestamp(&tsMap, input)
+		require.Nil(t, err)
+		require.Equal(t, input, output)
+	}
+
+	timeMap := ColumnMapper{DataType: "time without time zone"}
+	output, err = ProcessorRandomTimestamp(&timeMap, "13:45:12")
+	require.Nil(t, err)
+	require.Regexp(t, `^\d{2}:\d{2}:\d{2}$`, output)
+
+	intervalMap := ColumnMapper{DataType: "interval"}
+	output, err = ProcessorRandomTimestamp(&intervalMap, "-1 days")
+	require.Nil(t, err)
+	require.Regexp(t, `^-\d{2}:\d{2}:\d{2}$|^00:00:00$`, output)
+
+	_, err = ProcessorRandomTimestamp(&tsMap, "I AM THE FAIL BOAT!")
+	require.NotNil(t, err)
+}
+
+func TestProcessorJitterTimestamp(t *testing.T) {
+	cmap := ColumnMapper{
+		Processors: []ProcessorDefinition{{Name: "JitterTimestamp", Variance: 3600}},
+	}
+
+	for i := 0; i < 100; i++ {
+		output, err := ProcessorJitterTimestamp(&cmap, "2018-08-28 13:45:12-07")
+		require.Nil(t, err)
+		ts, err := parsePgTimestamp(output)
+		require.Nil(t, err)
+		original, _ := parsePgTimestamp("2018-08-28 13:45:12-07")
+		diff := ts.t.Sub(original.t).Seconds()
+		require.True(t, diff >= -3600 && diff <= 3600, output)
+	}
+
+	output, err := ProcessorJitterTimestamp(&cmap, "23:59:59")
+	require.Nil(t, err)
+	require.Regexp(t, `^\d{2}:\d{2}:\d{2}$`, output)
+
+	cmap.DataType = "interval"
+	output, err = ProcessorJitterTimestamp(&cmap, "1 mon 2 days")
+	require.Nil(t, err)
+	require.Regexp(t, `^1 mon 2 days( -?\d{2}:\d{2}:\d{2})?$`, output)
+
+	output, err = ProcessorJitterTimestamp(&cmap, "infinity")
+	require.Nil(t, err)
+	require.Equal(t, "infinity", output)
+}
+
+func TestProcessorTruncateTimestamp(t *testing.T) {
+	var cmap ColumnMapper
+
+	output, err := ProcessorTruncateToDay(&cmap, "2018-08-28 13:45:12.123-07")
+	require.Nil(t, err)
+	require.Equal(t, "2018-08-28 00:00:00-07", output)
+
+	output, err = ProcessorTruncateToHour(&cmap, "2018-08-28 13:45:12.123-07")
+	require.Nil(t, err)
+	require.Equal(t, "2018-08-28 13:00:00-07", output)
+
+	output, err = ProcessorTruncateToHour(&cmap, "0044-03-15 12:34:56 BC")
+	require.Nil(t, err)
+	require.Equal(t, "0044-03-15 12:00:00 BC", output)
+
+	output, err = ProcessorTruncateToHour(&cmap, "13:45:12.5+05:30")
+	require.Nil(t, err)
+	require.Equal(t, "13:00:00+05:30", output)
+
+	cmap.DataType = "interval"
+	output, err = ProcessorTruncateToDay(&cmap, "1 year 3 days 04:05:06")
+	require.Nil(t, err)
+	require.Equal(t, "1 year 3 days", output)
+
+	output, err = ProcessorTruncateToHour(&cmap, "-1 days -04:05:06")
+	require.Nil(t, err)
+	require.Equal(t, "-1 days -04:00:00", output)
+
+	output, err = ProcessorTruncateToDay(&cmap, "-infinity")
+	require.Nil(t, err)
+	require.Equal(t, "-infinity", output)
+}
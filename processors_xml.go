@@ -0,0 +1,294 @@
+package gonymizer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The XmlPaths processor selects parts of an xml document using a small subset of XPath and applies sub-processors to
+// them. Everything that is not selected is copied to the output byte for byte. Supported expressions are made of
+// element name steps separated by / (child) or // (descendant), where a step may be * to match any element, and the
+// last step may be @name or @* to select attributes instead of the element's text. Element names are matched against
+// their local name, I.E. /patient/name, //address/*, //contact/@email
+
+// xpathStep is a single step of a compiled XPath expression.
+type xpathStep struct {
+	name       string
+	descendant bool
+	attribute  bool
+}
+
+// xpathExpr is a compiled XPath expression.
+type xpathExpr []xpathStep
+
+// xmlEdit replaces input[start:end] with value.
+type xmlEdit struct {
+	start, end int
+	value      string
+}
+
+// ProcessorXmlPaths will apply the SubProcessors of the ProcessorDefinition to the xml text nodes and attributes that
+// are selected by their XPath keys. Unselected parts of the document are preserved.
+func ProcessorXmlPaths(cmap *ColumnMapper, input string) (string, error) {
+	return runConstructed(cmap, input, "XmlPaths", newXmlPaths)
+}
+
+// newXmlPaths is the constructor for XmlPaths and compiles every XPath key.
+func newXmlPaths(procDef ProcessorDefinition) (ProcessorFunc, error) {
+	paths := sortedSubProcessorKeys(procDef.SubProcessors)
+	exprs := make([]xpathExpr, len(paths))
+	for i, path := range paths {
+		expr, err := compileXPath(path)
+		if err != nil {
+			return nil, err
+		}
+		exprs[i] = expr
+	}
+
+	return func(cmap *ColumnMapper, input string) (string, error) {
+		document := unescapeCopyText(input)
+		decoder := xml.NewDecoder(strings.NewReader(document))
+		decoder.Strict = true
+
+		var (
+			stack []string
+			edits []xmlEdit
+		)
+		offset := 0
+		for {
+			token, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", fmt.Errorf("Invalid xml: %s", err)
+			}
+			start, end := offset, int(decoder.InputOffset())
+			offset = end
+
+			switch t := token.(type) {
+			case xml.StartElement:
+				stack = append(stack, t.Name.Local)
+				for i, expr := range exprs {
+					if !expr.matchesAttribute() || !expr.matches(stack) {
+						continue
+					}
+					for _, attr := range findXMLAttributes(document[start:end]) {
+						if !expr.matchesAttributeName(attr.name) {
+							continue
+						}
+						value := xmlUnescape(document[start+attr.start : start+attr.end])
+						output, err := processSubValue(cmap, procDef.SubProcessors[paths[i]], value)
+						if err != nil {
+							return "", fmt.Errorf("xml path %q: %s", paths[i], err)
+						}
+						edits = append(edits, xmlEdit{start + attr.start, start + attr.end, xmlSubValue(output)})
+					}
+				}
+			case xml.EndElement:
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			case xml.CharData:
+				if len(stack) == 0 || len(bytes.TrimSpace(t)) == 0 {
+					continue
+				}
+				for i, expr := range exprs {
+					if expr.matchesAttribute() || !expr.matches(stack) {
+						continue
+					}
+					output, err := processSubValue(cmap, procDef.SubProcessors[paths[i]], string(t))
+					if err != nil {
+						return "", fmt.Errorf("xml path %q: %s", paths[i], err)
+					}
+					edits = append(edits, xmlEdit{start, end, xmlSubValue(output)})
+					break
+				}
+			}
+		}
+
+		// Apply edits back to front so earlier offsets stay valid. An attribute can be selected by more than one path, in
+		// which case the first (sorted) path wins.
+		sort.SliceStable(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+		output := document
+		lastStart := len(document) + 1
+		for _, edit := range edits {
+			if edit.end > lastStart {
+				continue
+			}
+			output = output[:edit.start] + edit.value + output[edit.end:]
+			lastStart = edit.start
+		}
+		return escapeCopyText(output), nil
+	}, nil
+}
+
+// compileXPath compiles the supported subset of XPath.
+func compileXPath(path string) (xpathExpr, error) {
+	var expr xpathExpr
+
+	rest := path
+	if !strings.HasPrefix(rest, "/") {
+		rest = "/" + rest
+	}
+	for len(rest) > 0 {
+		step := xpathStep{}
+		if strings.HasPrefix(rest, "//") {
+			step.descendant = true
+			rest = rest[2:]
+		} else if strings.HasPrefix(rest, "/") {
+			rest = rest[1:]
+		} else {
+			return nil, fmt.Errorf("Unsupported XPath %q", path)
+		}
+
+		end := strings.Index(rest, "/")
+		if end < 0 {
+			end = len(rest)
+		}
+		step.name, rest = rest[:end], rest[end:]
+		if strings.HasPrefix(step.name, "@") {
+			step.attribute = true
+			step.name = step.name[1:]
+			if rest != "" {
+				return nil, fmt.Errorf("Attribute must be the last step of XPath %q", path)
+			}
+		}
+		if step.name == "" || strings.ContainsAny(step.name, "[]()=@ ") {
+			return nil, fmt.Errorf("Unsupported XPath %q", path)
+		}
+		expr = append(expr, step)
+	}
+	return expr, nil
+}
+
+// matchesAttribute returns true if the expression selects attributes.
+func (expr xpathExpr) matchesAttribute() bool {
+	return len(expr) > 0 && expr[len(expr)-1].attribute
+}
+
+// matchesAttributeName returns true if the attribute step matches the (possibly prefixed) attribute name.
+func (expr xpathExpr) matchesAttributeName(name string) bool {
+	if colon := strings.Index(name, ":"); colon >= 0 {
+		name = name[colon+1:]
+	}
+	step := expr[len(expr)-1]
+	return step.name == "*" || step.name == name
+}
+
+// matches returns true if the element steps of the expression match the stack of open element names.
+func (expr xpathExpr) matches(stack []string) bool {
+	steps := expr
+	if expr.matchesAttribute() {
+		steps = expr[:len(expr)-1]
+	}
+	return matchXPathSteps(steps, stack)
+}
+
+// matchXPathSteps matches steps against names from the root element down.
+func matchXPathSteps(steps []xpathStep, names []string) bool {
+	if len(steps) == 0 {
+		return len(names) == 0
+	}
+	if len(names) == 0 {
+		return false
+	}
+
+	step := steps[0]
+	if step.name == "*" || step.name == names[0] {
+		if matchXPathSteps(steps[1:], names[1:]) {
+			return true
+		}
+	}
+	// A descendant step may skip over any number of elements
+	return step.descendant && matchXPathSteps(steps, names[1:])
+}
+
+// xmlAttribute is the position of an attribute value relative to the start of its tag.
+type xmlAttribute struct {
+	name       string
+	start, end int
+}
+
+// findXMLAttributes scans a raw start tag such as <a href="x" b='y'> and returns where each attribute value is.
+func findXMLAttributes(tag string) []xmlAttribute {
+	var attrs []xmlAttribute
+
+	i := 1
+	for i < len(tag) && !isXMLSpace(tag[i]) && tag[i] != '>' && tag[i] != '/' {
+		i++
+	}
+	for i < len(tag) {
+		for i < len(tag) && isXMLSpace(tag[i]) {
+			i++
+		}
+		nameStart := i
+		for i < len(tag) && !isXMLSpace(tag[i]) && tag[i] != '=' && tag[i] != '>' && tag[i] != '/' {
+			i++
+		}
+		if nameStart == i {
+			break
+		}
+		name := tag[nameStart:i]
+		for i < len(tag) && (isXMLSpace(tag[i]) || tag[i] == '=') {
+			i++
+		}
+		if i >= len(tag) || (tag[i] != '"' && tag[i] != '\'') {
+			break
+		}
+		quote := tag[i]
+		valueStart := i + 1
+		valueEnd := strings.IndexByte(tag[valueStart:], quote)
+		if valueEnd < 0 {
+			break
+		}
+		attrs = append(attrs, xmlAttribute{name: name, start: valueStart, end: valueStart + valueEnd})
+		i = valueStart + valueEnd + 1
+	}
+	return attrs
+}
+
+// isXMLSpace returns true for the whitespace characters allowed between xml attributes.
+func isXMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// xmlEscape escapes text so it can be used as xml character data or a quoted attribute value.
+func xmlEscape(text string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// xmlSubValue escapes the output of sub-processors. xml has no NULL, so a NULL output empties the text or attribute.
+func xmlSubValue(output *string) string {
+	if output == nil {
+		return ""
+	}
+	return xmlEscape(*output)
+}
+
+// xmlUnescape decodes the entities in an attribute value.
+func xmlUnescape(text string) string {
+	var value struct {
+		Value string `xml:"v,attr"`
+	}
+	if err := xml.Unmarshal([]byte(`<a v="`+strings.Replace(text, `"`, "&quot;", -1)+`"/>`), &value); err != nil {
+		return text
+	}
+	return value.Value
+}
+
+// sortedSubProcessorKeys returns the keys of a SubProcessors map in a stable order.
+func sortedSubProcessorKeys(subProcessors map[string][]ProcessorDefinition) []string {
+	keys := make([]string, 0, len(subProcessors))
+	for key := range subProcessors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
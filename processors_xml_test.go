@@ -0,0 +1,95 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileXPath(t *testing.T) {
+	expr, err := compileXPath("/patient//name/@first")
+	require.Nil(t, err)
+	require.Equal(t, xpathExpr{
+		{name: "patient"},
+		{name: "name", descendant: true},
+		{name: "first", attribute: true},
+	}, expr)
+
+	require.True(t, expr.matches([]string{"patient", "name"}))
+	require.True(t, expr.matches([]string{"patient", "contact", "name"}))
+	require.False(t, expr.matches([]string{"doctor", "name"}))
+
+	for _, path := range []string{"", "/", "/a/@b/c", "/a[1]", "//a/text()"} {
+		_, err = compileXPath(path)
+		require.NotNil(t, err, path)
+	}
+}
+
+func TestProcessorXmlPaths(t *testing.T) {
+	cmap := ColumnMapper{
+		Processors: []ProcessorDefinition{
+			{
+				Name: "XmlPaths",
+				SubProcessors: map[string][]ProcessorDefinition{
+					"/patient/name":    {{Name: "ScrubString"}},
+					"//contact/@email": {{Name: "ScrubString"}},
+				},
+			},
+		},
+	}
+
+	input := "<?xml version=\"1.0\"?>\\n<patient id=\"7\">\\n  <name>Rick &amp; Morty</name>\\n" +
+		"  <contact email='rick@example.com' type=\"home\"/>\\n  <note>keep me</note>\\n</patient>"
+	expected := "<?xml version=\"1.0\"?>\\n<patient id=\"7\">\\n  <name>************</name>\\n" +
+		"  <contact email='****************' type=\"home\"/>\\n  <note>keep me</note>\\n</patient>"
+
+	output, err := ProcessorXmlPaths(&cmap, input)
+	require.Nil(t, err)
+	require.Equal(t, expected, output)
+
+	_, err = ProcessorXmlPaths(&cmap, "<patient><name>unterminated</patient>")
+	require.NotNil(t, err)
+
+	// xml has no NULL, a NULL written by the sub-processors empties the text
+	cmap = ColumnMapper{
+		IsNullable: true,
+		Processors: []ProcessorDefinition{
+			{
+				Name: "XmlPaths",
+				SubProcessors: map[string][]ProcessorDefinition{
+					"/patient/name": {{Name: "Expression", Params: map[string]interface{}{"Expression": "null"}}},
+				},
+			},
+		},
+	}
+	output, err = ProcessorXmlPaths(&cmap, "<patient><name>Rick</name></patient>")
+	require.Nil(t, err)
+	require.Equal(t, "<patient><name></name></patient>", output)
+}
+
+func TestValidateXmlPaths(t *testing.T) {
+	dbMap := DBMapper{
+		DBName: "test",
+		ColumnMaps: []ColumnMapper{
+			{
+				Processors: []ProcessorDefinition{
+					{
+						Name: "XmlPaths",
+						SubProcessors: map[string][]ProcessorDefinition{
+							"/patient/name": {{Name: "ScrubString"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	require.Nil(t, dbMap.Validate())
+
+	dbMap.ColumnMaps[0].Processors[0].SubProcessors["/patient/name"] = []ProcessorDefinition{{Name: "NotAProcessor"}}
+	require.NotNil(t, dbMap.Validate())
+
+	dbMap.ColumnMaps[0].Processors[0].SubProcessors = map[string][]ProcessorDefinition{
+		"/patient[1]": {{Name: "ScrubString"}},
+	}
+	require.NotNil(t, dbMap.Validate())
+}
@@ -0,0 +1,401 @@
+package gonymizer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// ParameterType is the type of a processor parameter.
+type ParameterType string
+
+const (
+	// ParameterNumber is a number such as Max, Min or Variance.
+	ParameterNumber ParameterType = "number"
+	// ParameterString is free-form text.
+	ParameterString ParameterType = "string"
+	// ParameterBool is true or false.
+	ParameterBool ParameterType = "bool"
+	// ParameterStringList is a list of strings.
+	ParameterStringList ParameterType = "string-list"
+	// ParameterRegex is a regular expression that must compile.
+	ParameterRegex ParameterType = "regex"
+	// ParameterLocale is the name of a bundled locale.
+	ParameterLocale ParameterType = "locale"
+	// ParameterSubProcessors is a map of keys to lists of ProcessorDefinitions.
+	ParameterSubProcessors ParameterType = "sub-processors"
+)
+
+// ParameterSchema describes a single parameter accepted by a processor. Name is either the ProcessorDefinition field that
+// holds the parameter, I.E. Max or SubProcessors, or a key of the ProcessorDefinition's Params.
+type ParameterSchema struct {
+	Name        string
+	Type        ParameterType
+	Description string
+	Required    bool
+}
+
+// ProcessorConstructor creates the ProcessorFunc for a ProcessorDefinition. It returns an error if the definition's
+// parameters can not be used by the processor.
+type ProcessorConstructor func(procDef ProcessorDefinition) (ProcessorFunc, error)
+
+// BatchProcessorFunc processes many values of a column at once and returns one output per input. Processors that have
+// a large per-call overhead, such as plugins, implement it.
+type BatchProcessorFunc func(cmap *ColumnMapper, inputs []string) ([]string, error)
+
+// BatchProcessorConstructor creates the BatchProcessorFunc for a ProcessorDefinition.
+type BatchProcessorConstructor func(procDef ProcessorDefinition) (BatchProcessorFunc, error)
+
+// RowProcessorFunc processes a value with access to the rest of its row. row maps every column name of the table to its
+// original COPY escaped value.
+type RowProcessorFunc func(cmap *ColumnMapper, input string, row map[string]string) (string, error)
+
+// RowProcessorConstructor creates the RowProcessorFunc for a ProcessorDefinition.
+type RowProcessorConstructor func(procDef ProcessorDefinition) (RowProcessorFunc, error)
+
+// ProcessorInfo is the registry entry for a processor.
+type ProcessorInfo struct {
+	Name        string
+	Description string
+
+	// DataTypes are the PostgreSQL data types (as found in information_schema.columns) the processor supports. An empty
+	// list means any data type.
+	DataTypes []string
+
+	// Parameters are the ProcessorDefinition fields and Params keys the processor accepts. Exemptions, ShortCircuit and
+	// Comment are accepted by every processor and are not listed.
+	Parameters []ParameterSchema
+
+	New ProcessorConstructor
+
+	// NewBatch is optional. When it is set, the batch processor is used to process many rows at once.
+	NewBatch BatchProcessorConstructor
+
+	// NewRow is optional. When it is set, the row processor is used so the processor can read the other columns of the
+	// row.
+	NewRow RowProcessorConstructor
+}
+
+// registry contains every registered processor by name.
+var registry = struct {
+	mux        sync.RWMutex
+	processors map[string]ProcessorInfo
+}{
+	processors: make(map[string]ProcessorInfo),
+}
+
+// Data types shared by many processors
+var (
+	textDataTypes     = []string{"text", "character varying", "character"}
+	temporalDataTypes = []string{"date", "timestamp without time zone", "timestamp with time zone",
+		"time without time zone", "time with time zone", "interval"}
+	timestampDataTypes = []string{"timestamp without time zone", "timestamp with time zone", "time without time zone",
+		"time with time zone", "interval"}
+	integerDataTypes = []string{"smallint", "integer", "bigint"}
+	numericDataTypes = []string{"smallint", "integer", "bigint", "numeric", "real", "double precision"}
+	spatialDataTypes = []string{"USER-DEFINED"}
+)
+
+// localeParameter is the Locale parameter accepted by the locale-aware Fake* processors.
+var localeParameter = ParameterSchema{
+	Name:        "Locale",
+	Type:        ParameterLocale,
+	Description: "Locale of the generated values, overrides the table and map locale",
+}
+
+// RegisterProcessor adds a processor to the registry and the ProcessorCatalog. Processors should be registered from an
+// init function so they are available before any map file is loaded or validated. Registering the same name twice is an
+// error.
+func RegisterProcessor(info ProcessorInfo) error {
+	if info.Name == "" {
+		return errors.New("Processor name must not be empty")
+	}
+	if info.New == nil {
+		return fmt.Errorf("Processor %s has no constructor", info.Name)
+	}
+	seen := make(map[string]bool)
+	for _, param := range info.Parameters {
+		if param.Name == "" {
+			return fmt.Errorf("Processor %s: parameter name must not be empty", info.Name)
+		}
+		if seen[param.Name] {
+			return fmt.Errorf("Processor %s: duplicate parameter %s", info.Name, param.Name)
+		}
+		seen[param.Name] = true
+	}
+
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+
+	if _, ok := registry.processors[info.Name]; ok {
+		return fmt.Errorf("Processor %s is already registered", info.Name)
+	}
+	registry.processors[info.Name] = info
+	ProcessorCatalog[info.Name] = catalogFunc(info)
+	return nil
+}
+
+// MustRegisterProcessor is the same as RegisterProcessor but panics on error. It is meant to be used in init functions.
+func MustRegisterProcessor(info ProcessorInfo) {
+	if err := RegisterProcessor(info); err != nil {
+		panic(err)
+	}
+}
+
+// LookupProcessor returns the registry entry for the named processor.
+func LookupProcessor(name string) (ProcessorInfo, bool) {
+	registry.mux.RLock()
+	defer registry.mux.RUnlock()
+
+	info, ok := registry.processors[name]
+	return info, ok
+}
+
+// RegisteredProcessors returns every registered processor sorted by name.
+func RegisteredProcessors() []ProcessorInfo {
+	registry.mux.RLock()
+	defer registry.mux.RUnlock()
+
+	infos := make([]ProcessorInfo, 0, len(registry.processors))
+	for _, info := range registry.processors {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// staticProcessor is the constructor for processors without parameters, or that read them from the ColumnMapper on
+// every call.
+func staticProcessor(pfunc ProcessorFunc) ProcessorConstructor {
+	return func(procDef ProcessorDefinition) (ProcessorFunc, error) {
+		return pfunc, nil
+	}
+}
+
+// DecodeParams decodes the Params of the ProcessorDefinition into a processor specific config struct. It is meant to be
+// used by processor constructors. Keys that are not fields of the config are an error.
+func (procDef ProcessorDefinition) DecodeParams(config interface{}) error {
+	if len(procDef.Params) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(procDef.Params)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("Invalid Params: %s", err)
+	}
+	return nil
+}
+
+// runConstructed runs the processor constructed from the column's ProcessorDefinition. The exported Processor
+// functions of processors that parse their parameters in a constructor use this.
+func runConstructed(cmap *ColumnMapper, input, name string, constructor ProcessorConstructor) (string, error) {
+	var (
+		procDef ProcessorDefinition
+		key     interface{} = name
+	)
+	for i := range cmap.Processors {
+		if cmap.Processors[i].Name == name {
+			procDef, key = cmap.Processors[i], &cmap.Processors[i]
+			break
+		}
+	}
+	constructed, err := constructDefinition(key, procDef, constructor)
+	if err != nil {
+		return "", err
+	}
+	return constructed.pfunc(cmap, input)
+}
+
+// catalogFunc adapts a registered processor to the ProcessorCatalog by constructing it from the column's
+// ProcessorDefinition.
+func catalogFunc(info ProcessorInfo) ProcessorFunc {
+	return func(cmap *ColumnMapper, input string) (string, error) {
+		return runConstructed(cmap, input, info.Name, info.New)
+	}
+}
+
+// constructedDefinitions caches the definitions of maps built in code, which are not constructed by
+// constructProcessors, by the address of the definition. A definition is constructed the first time it is used, so
+// changes to it after that are not seen; use a new definition instead.
+var constructedDefinitions sync.Map
+
+// constructDefinition returns the definition with its processor constructed the way constructProcessors does, without
+// its sub-processors. The definition is constructed once, not for every value.
+func constructDefinition(key interface{}, procDef ProcessorDefinition, constructor ProcessorConstructor) (
+	ProcessorDefinition, error) {
+	if procDef.pfunc != nil {
+		return procDef, nil
+	}
+	if cached, ok := constructedDefinitions.Load(key); ok {
+		return cached.(ProcessorDefinition), nil
+	}
+	source := procDef
+	source.batch, source.row, source.exemptions = nil, nil, nil
+
+	var err error
+	constructed := source
+	if constructed.pfunc, err = constructor(source); err != nil {
+		return procDef, fmt.Errorf("Processor %s: %s", procDef.Name, err)
+	}
+	if info, ok := LookupProcessor(procDef.Name); ok {
+		if info.NewBatch != nil {
+			if constructed.batch, err = info.NewBatch(source); err != nil {
+				return procDef, fmt.Errorf("Processor %s: %s", procDef.Name, err)
+			}
+		}
+		if info.NewRow != nil {
+			if constructed.row, err = info.NewRow(source); err != nil {
+				return procDef, fmt.Errorf("Processor %s: %s", procDef.Name, err)
+			}
+		}
+	}
+	if procDef.Exemptions != "" {
+		if constructed.exemptions, err = regexp.Compile(procDef.Exemptions); err != nil {
+			return procDef, err
+		}
+	}
+	constructedDefinitions.Store(key, constructed)
+	return constructed, nil
+}
+
+// definitionFields returns the value of each parameter field of a ProcessorDefinition and whether it is set.
+var definitionFields = map[string]func(ProcessorDefinition) (interface{}, bool){
+	"Max":           func(p ProcessorDefinition) (interface{}, bool) { return p.Max, p.Max != 0 },
+	"Min":           func(p ProcessorDefinition) (interface{}, bool) { return p.Min, p.Min != 0 },
+	"Variance":      func(p ProcessorDefinition) (interface{}, bool) { return p.Variance, p.Variance != 0 },
+	"Locale":        func(p ProcessorDefinition) (interface{}, bool) { return p.Locale, p.Locale != "" },
+	"SubProcessors": func(p ProcessorDefinition) (interface{}, bool) { return p.SubProcessors, len(p.SubProcessors) > 0 },
+}
+
+// validateProcessorDefinition type-checks the parameters of a ProcessorDefinition against the processor's schema and
+// makes sure the processor can be constructed from it.
+func validateProcessorDefinition(procDef ProcessorDefinition) error {
+	info, ok := LookupProcessor(procDef.Name)
+	if !ok {
+		return fmt.Errorf("Unrecognized Processor %s", procDef.Name)
+	}
+
+	if procDef.Exemptions != "" {
+		if _, err := regexp.Compile(procDef.Exemptions); err != nil {
+			return fmt.Errorf("Processor %s: invalid Exemptions: %s", procDef.Name, err)
+		}
+	} else if procDef.ShortCircuit {
+		return fmt.Errorf("Processor %s: ShortCircuit requires Exemptions", procDef.Name)
+	}
+
+	accepted := make(map[string]ParameterSchema)
+	for _, param := range info.Parameters {
+		accepted[param.Name] = param
+	}
+	names := make([]string, 0, len(definitionFields))
+	for name := range definitionFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, set := definitionFields[name](procDef)
+		param, ok := accepted[name]
+		if !ok {
+			if set {
+				return fmt.Errorf("Processor %s does not accept parameter %s", procDef.Name, name)
+			}
+			continue
+		}
+		if !set {
+			if param.Required {
+				return fmt.Errorf("Processor %s requires parameter %s", procDef.Name, name)
+			}
+			continue
+		}
+		if err := checkParameter(param, value); err != nil {
+			return fmt.Errorf("Processor %s: %s", procDef.Name, err)
+		}
+	}
+
+	keys := make([]string, 0, len(procDef.Params))
+	for key := range procDef.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		param, ok := accepted[key]
+		if _, isField := definitionFields[key]; !ok || isField {
+			return fmt.Errorf("Processor %s does not accept parameter %s", procDef.Name, key)
+		}
+		if err := checkParameter(param, procDef.Params[key]); err != nil {
+			return fmt.Errorf("Processor %s: %s", procDef.Name, err)
+		}
+	}
+	for _, param := range info.Parameters {
+		if _, isField := definitionFields[param.Name]; isField || !param.Required {
+			continue
+		}
+		if _, ok := procDef.Params[param.Name]; !ok {
+			return fmt.Errorf("Processor %s requires parameter %s", procDef.Name, param.Name)
+		}
+	}
+
+	if _, err := info.New(procDef); err != nil {
+		return fmt.Errorf("Processor %s: %s", procDef.Name, err)
+	}
+	return nil
+}
+
+// checkParameter checks that a parameter value has the type given by its schema.
+func checkParameter(param ParameterSchema, value interface{}) error {
+	switch param.Type {
+	case ParameterNumber:
+		switch value.(type) {
+		case float64, float32, int, int64, json.Number:
+			return nil
+		}
+	case ParameterString:
+		if _, ok := value.(string); ok {
+			return nil
+		}
+	case ParameterBool:
+		if _, ok := value.(bool); ok {
+			return nil
+		}
+	case ParameterStringList:
+		switch list := value.(type) {
+		case []string:
+			return nil
+		case []interface{}:
+			for _, item := range list {
+				if _, ok := item.(string); !ok {
+					return fmt.Errorf("parameter %s must be a %s, got %T item", param.Name, param.Type, item)
+				}
+			}
+			return nil
+		}
+	case ParameterRegex:
+		if s, ok := value.(string); ok {
+			if _, err := regexp.Compile(s); err != nil {
+				return fmt.Errorf("invalid %s: %s", param.Name, err)
+			}
+			return nil
+		}
+	case ParameterLocale:
+		if s, ok := value.(string); ok {
+			_, err := normalizeLocale(s)
+			return err
+		}
+	case ParameterSubProcessors:
+		if _, ok := value.(map[string][]ProcessorDefinition); ok {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown type %s for parameter %s", param.Type, param.Name)
+	}
+	return fmt.Errorf("parameter %s must be a %s, got %T", param.Name, param.Type, value)
+}
@@ -0,0 +1,222 @@
+package gonymizer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// unregisterProcessor removes a processor registered by a test.
+func unregisterProcessor(name string) {
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+
+	delete(registry.processors, name)
+	delete(ProcessorCatalog, name)
+}
+
+func TestRegisterProcessor(t *testing.T) {
+	defer unregisterProcessor("TestUpper")
+
+	info := ProcessorInfo{
+		Name:        "TestUpper",
+		Description: "Test processor",
+		DataTypes:   textDataTypes,
+		Parameters: []ParameterSchema{
+			{Name: "Max", Type: ParameterNumber, Description: "Must be positive"},
+		},
+		New: func(procDef ProcessorDefinition) (ProcessorFunc, error) {
+			if procDef.Max < 0 {
+				return nil, errors.New("Max must be positive")
+			}
+			return func(cmap *ColumnMapper, input string) (string, error) {
+				return "UPPER", nil
+			}, nil
+		},
+	}
+	require.Nil(t, RegisterProcessor(info))
+	require.NotNil(t, RegisterProcessor(info))
+
+	registered, ok := LookupProcessor("TestUpper")
+	require.True(t, ok)
+	require.Equal(t, "Test processor", registered.Description)
+
+	output, err := ProcessorCatalog["TestUpper"](&ColumnMapper{}, "lower")
+	require.Nil(t, err)
+	require.Equal(t, "UPPER", output)
+
+	cmap := ColumnMapper{Processors: []ProcessorDefinition{{Name: "TestUpper", Max: -1}}}
+	_, err = ProcessorCatalog["TestUpper"](&cmap, "lower")
+	require.NotNil(t, err)
+
+	require.NotNil(t, RegisterProcessor(ProcessorInfo{New: staticProcessor(ProcessorIdentity)}))
+	require.NotNil(t, RegisterProcessor(ProcessorInfo{Name: "TestNoConstructor"}))
+	require.NotNil(t, RegisterProcessor(ProcessorInfo{
+		Name:       "TestDuplicateParameter",
+		Parameters: []ParameterSchema{{Name: "Color", Type: ParameterString}, {Name: "Color", Type: ParameterString}},
+		New:        staticProcessor(ProcessorIdentity),
+	}))
+	_, ok = LookupProcessor("TestDuplicateParameter")
+	require.False(t, ok)
+}
+
+func TestRegisteredProcessors(t *testing.T) {
+	infos := RegisteredProcessors()
+	require.Equal(t, len(ProcessorCatalog), len(infos))
+	for i := 1; i < len(infos); i++ {
+		require.True(t, infos[i-1].Name < infos[i].Name)
+	}
+	for _, info := range infos {
+		require.NotEmpty(t, info.Description, info.Name)
+	}
+}
+
+func TestValidateProcessorDefinition(t *testing.T) {
+	valid := []ProcessorDefinition{
+		{Name: "Identity"},
+		{Name: "Identity", Exemptions: "^test"},
+		{Name: "RandomTimestamp", Min: 0, Max: 3600},
+		{Name: "FakeCity", Locale: "fr"},
+		{Name: "SnapGeometry", Variance: 100},
+		{Name: "PlaceholderBytea", Params: map[string]interface{}{"Placeholder": "GONE"}},
+	}
+	for _, procDef := range valid {
+		require.Nil(t, validateProcessorDefinition(procDef), procDef.Name)
+	}
+
+	invalid := []ProcessorDefinition{
+		{Name: "NotAProcessor"},
+		{Name: "Identity", Exemptions: "(unclosed"},
+		{Name: "Identity", Max: 10},
+		{Name: "ScrubString", Locale: "de"},
+		{Name: "FakeCity", Locale: "xx"},
+		{Name: "SnapGeometry"},
+		{Name: "HstoreKeys"},
+		{Name: "PlaceholderBytea", Params: map[string]interface{}{"Placeholder": 7.0}},
+		{Name: "PlaceholderBytea", Params: map[string]interface{}{"Color": "red"}},
+		{Name: "JitterTimestamp", Params: map[string]interface{}{"Variance": 10.0}},
+		{Name: "XmlPaths", SubProcessors: map[string][]ProcessorDefinition{"/a[1]": {{Name: "Identity"}}}},
+	}
+	for _, procDef := range invalid {
+		require.NotNil(t, validateProcessorDefinition(procDef), procDef.Name)
+	}
+}
+
+func TestCheckParameter(t *testing.T) {
+	require.Nil(t, checkParameter(ParameterSchema{Name: "Max", Type: ParameterNumber}, 1.5))
+	require.NotNil(t, checkParameter(ParameterSchema{Name: "Max", Type: ParameterNumber}, "1.5"))
+	require.Nil(t, checkParameter(ParameterSchema{Name: "Pattern", Type: ParameterRegex}, "^[a-z]+$"))
+	require.NotNil(t, checkParameter(ParameterSchema{Name: "Pattern", Type: ParameterRegex}, "[a-z"))
+	require.Nil(t, checkParameter(ParameterSchema{Name: "Locale", Type: ParameterLocale}, "pt_BR"))
+	require.NotNil(t, checkParameter(ParameterSchema{Name: "Locale", Type: ParameterLocale}, "pt_PT"))
+	require.NotNil(t, checkParameter(ParameterSchema{Name: "SubProcessors", Type: ParameterSubProcessors}, "x"))
+	require.NotNil(t, checkParameter(ParameterSchema{Name: "Max", Type: "complex"}, 1.5))
+}
+
+func TestDecodeParams(t *testing.T) {
+	var config struct {
+		Length  int
+		Pattern string
+	}
+
+	procDef := ProcessorDefinition{Params: map[string]interface{}{"Length": 12.0, "Pattern": "^x"}}
+	require.Nil(t, procDef.DecodeParams(&config))
+	require.Equal(t, 12, config.Length)
+	require.Equal(t, "^x", config.Pattern)
+
+	procDef.Params = map[string]interface{}{"Length": "twelve"}
+	require.NotNil(t, procDef.DecodeParams(&config))
+
+	procDef.Params = map[string]interface{}{"Color": "red"}
+	require.NotNil(t, procDef.DecodeParams(&config))
+}
+
+func TestConstructProcessors(t *testing.T) {
+	processors := []ProcessorDefinition{
+		{Name: "PlaceholderBytea", Params: map[string]interface{}{"Placeholder": "GONE"}, Exemptions: "^$"},
+	}
+	require.Nil(t, constructProcessors(processors))
+	require.NotNil(t, processors[0].pfunc)
+	require.NotNil(t, processors[0].exemptions)
+
+	cmap := ColumnMapper{Processors: processors}
+	output, err := processValue(&cmap, "\\\\x00")
+	require.Nil(t, err)
+	require.Equal(t, encodeBytea([]byte("GONE")), output)
+
+	require.NotNil(t, constructProcessors([]ProcessorDefinition{{Name: "SnapGeometry"}}))
+}
+
+func TestConstructDefinition(t *testing.T) {
+	// each step of a map built in code runs with its own definition
+	cmap := ColumnMapper{Processors: []ProcessorDefinition{
+		{Name: "Constant", Params: map[string]interface{}{"Value": "a"}},
+		{Name: "Constant", Params: map[string]interface{}{"Value": "b"}},
+	}}
+	output, err := processValue(&cmap, "secret")
+	require.Nil(t, err)
+	require.Equal(t, "b", output)
+
+	// and is constructed once, not for every value
+	constructed := 0
+	require.Nil(t, RegisterProcessor(ProcessorInfo{
+		Name: "TestCountedConstant",
+		Parameters: []ParameterSchema{
+			{Name: "Value", Type: ParameterString, Required: true},
+		},
+		New: func(procDef ProcessorDefinition) (ProcessorFunc, error) {
+			constructed++
+			return newConstant(procDef)
+		},
+	}))
+	defer unregisterProcessor("TestCountedConstant")
+
+	cmap = ColumnMapper{Processors: []ProcessorDefinition{
+		{Name: "TestCountedConstant", Params: map[string]interface{}{"Value": "a"}},
+	}}
+	for i := 0; i < 3; i++ {
+		output, err = processValue(&cmap, "secret")
+		require.Nil(t, err)
+		require.Equal(t, "a", output)
+		output, err = ProcessorCatalog["TestCountedConstant"](&cmap, "secret")
+		require.Nil(t, err)
+		require.Equal(t, "a", output)
+	}
+	require.Equal(t, 1, constructed)
+
+	// a new definition is constructed again
+	cmap.Processors = []ProcessorDefinition{
+		{Name: "TestCountedConstant", Params: map[string]interface{}{"Value": "b"}},
+	}
+	output, err = processValue(&cmap, "secret")
+	require.Nil(t, err)
+	require.Equal(t, "b", output)
+	require.Equal(t, 2, constructed)
+}
+
+func TestValidateProcessorsPath(t *testing.T) {
+	dbMap := DBMapper{
+		DBName: "test",
+		ColumnMaps: []ColumnMapper{
+			{
+				TableSchema: "public",
+				TableName:   "patients",
+				ColumnName:  "record",
+				Processors: []ProcessorDefinition{
+					{Name: "Identity"},
+					{
+						Name: "XmlPaths",
+						SubProcessors: map[string][]ProcessorDefinition{
+							"/patient/name": {{Name: "ScrubString"}, {Name: "ScrubString", Max: 1}},
+						},
+					},
+				},
+			},
+		},
+	}
+	err := dbMap.Validate()
+	require.NotNil(t, err)
+	require.Equal(t, `public.patients.record Processors[1].SubProcessors["/patient/name"][1]: `+
+		`Processor ScrubString does not accept parameter Max`, err.Error())
+}
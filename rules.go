@@ -0,0 +1,283 @@
+package gonymizer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Rules apply the same settings to every column that matches their patterns, I.E. FakeEmailAddress to any column named
+// email. A column is resolved in this order:
+//
+//  1. an entry of ColumnMaps with Processors
+//  2. the matching rule with the highest Priority, or the first one in the map file if several have the same Priority
+//  3. an entry of ColumnMaps without Processors, which is left as it is
+//
+// An entry of ColumnMaps gives a rule the DataType it matches against. Columns without an entry have no DataType, so
+// rules with a DataType pattern never match them. Since only the entries tell whether a column is nullable, rules that
+// write NULL need a DataType pattern.
+
+// ColumnRule applies its processors to every column whose schema, table, column name and data type match its patterns.
+// Patterns are globs (*, ? and [...]) unless Regex is set. A pattern that is empty matches anything.
+type ColumnRule struct {
+	Name     string
+	Comment  string `json:",omitempty"`
+	Priority int    `json:",omitempty"`
+	Regex    bool   `json:",omitempty"`
+
+	TableSchema string `json:",omitempty"`
+	TableName   string `json:",omitempty"`
+	ColumnName  string `json:",omitempty"`
+	DataType    string `json:",omitempty"`
+
+	NullRate     float64 `json:",omitempty"`
+	ProcessNulls bool    `json:",omitempty"`
+	Processors   []ProcessorDefinition
+	OnError      *ErrorPolicy `json:",omitempty"`
+
+	// compiled patterns when Regex is set, in the order of the fields above
+	regexes []*regexp.Regexp
+}
+
+// RuleMatch tells where the settings of a column come from. Rule is nil unless the column was resolved through a rule,
+// which is Rules[RuleIndex] of the map.
+type RuleMatch struct {
+	Column    ColumnMapper
+	Exact     bool
+	Rule      *ColumnRule
+	RuleIndex int
+}
+
+// ruleIndex holds the order of the rules and the columns resolved so far, which are looked up for every row.
+type ruleIndex struct {
+	order    []int
+	resolved sync.Map
+}
+
+// label returns the name of a rule for messages.
+func (rule ColumnRule) label(i int) string {
+	if rule.Name != "" {
+		return fmt.Sprintf("Rules[%d] (%s)", i, rule.Name)
+	}
+	return fmt.Sprintf("Rules[%d]", i)
+}
+
+// patterns returns the patterns of the rule.
+func (rule ColumnRule) patterns() []string {
+	return []string{rule.TableSchema, rule.TableName, rule.ColumnName, rule.DataType}
+}
+
+// compile checks the patterns of the rule and compiles them if they are regular expressions.
+func (rule *ColumnRule) compile() error {
+	patterns := rule.patterns()
+	empty := true
+	rule.regexes = nil
+	for _, pattern := range patterns {
+		if pattern != "" {
+			empty = false
+		}
+		if !rule.Regex {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("Invalid pattern %q: %s", pattern, err)
+			}
+			continue
+		}
+		regex, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("Invalid pattern %q: %s", pattern, err)
+		}
+		rule.regexes = append(rule.regexes, regex)
+	}
+	if empty {
+		return fmt.Errorf("Requires at least one of TableSchema, TableName, ColumnName or DataType")
+	}
+	return nil
+}
+
+// matches returns true if a column matches every pattern of the rule.
+func (rule ColumnRule) matches(schemaName, tableName, columnName, dataType string) bool {
+	values := []string{schemaName, tableName, columnName, dataType}
+	for i := range values {
+		if !rule.matchesPattern(i, values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesPattern returns true if a value matches the pattern of the rule at the same position as in patterns.
+func (rule ColumnRule) matchesPattern(i int, value string) bool {
+	pattern := rule.patterns()[i]
+	if pattern == "" {
+		return true
+	}
+	if rule.Regex {
+		return rule.regexes[i].MatchString(value)
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+// writesNull returns what makes the rule write NULL, or an empty string if it does not.
+func (rule ColumnRule) writesNull() string {
+	if rule.NullRate > 0 {
+		return "NullRate"
+	}
+	if rule.OnError != nil && rule.OnError.Action == OnErrorNull {
+		return "OnError " + OnErrorNull
+	}
+	for i, procDef := range rule.Processors {
+		if nullProcessors[procDef.Name] {
+			return fmt.Sprintf("Processors[%d] (%s)", i, procDef.Name)
+		}
+		if procDef.OnError != nil && procDef.OnError.Action == OnErrorNull {
+			return fmt.Sprintf("Processors[%d].OnError %s", i, OnErrorNull)
+		}
+	}
+	return ""
+}
+
+// apply returns the column with the settings of the rule.
+func (rule ColumnRule) apply(cmap ColumnMapper) ColumnMapper {
+	cmap.Processors = rule.Processors
+	cmap.OnError = rule.OnError
+	cmap.NullRate = rule.NullRate
+	cmap.ProcessNulls = rule.ProcessNulls
+	return cmap
+}
+
+// validateRules checks the patterns and processors of every rule, and the columns of ColumnMaps that the rules apply
+// to.
+func (dbMap *DBMapper) validateRules() error {
+	for i := range dbMap.Rules {
+		rule := &dbMap.Rules[i]
+		label := rule.label(i)
+		if err := rule.compile(); err != nil {
+			return fmt.Errorf("%s: %s", label, err)
+		}
+		if len(rule.Processors) == 0 {
+			return fmt.Errorf("%s: Requires Processors", label)
+		}
+		if err := validateProcessors(label+" Processors", rule.Processors); err != nil {
+			return err
+		}
+		if rule.NullRate < 0 || rule.NullRate > 1 {
+			return fmt.Errorf("%s: NullRate must be between 0 and 1", label)
+		}
+		// whether a column is nullable is checked against the columns the rule applies to, which must all have an entry
+		if cause := rule.writesNull(); cause != "" && rule.matchesPattern(3, "") {
+			return fmt.Errorf("%s: %s writes NULL, which requires a DataType pattern so the rule only applies to "+
+				"columns of ColumnMaps", label, cause)
+		}
+		if rule.OnError != nil {
+			if err := validateErrorPolicy(label+" OnError", rule.OnError, true); err != nil {
+				return err
+			}
+		}
+		for j, procDef := range rule.Processors {
+			if procDef.OnError != nil {
+				onErrorPath := fmt.Sprintf("%s Processors[%d].OnError", label, j)
+				if err := validateErrorPolicy(onErrorPath, procDef.OnError, true); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	dbMap.indexRules()
+
+	for _, columnMap := range dbMap.ColumnMaps {
+		if len(columnMap.Processors) > 0 {
+			continue
+		}
+		i := dbMap.matchRule(columnMap.TableSchema, columnMap.TableName, columnMap.ColumnName, columnMap.DataType)
+		if i < 0 {
+			continue
+		}
+		resolved := dbMap.Rules[i].apply(columnMap)
+		columnPath := fmt.Sprintf("%s.%s.%s (%s)", columnMap.TableSchema, columnMap.TableName, columnMap.ColumnName,
+			dbMap.Rules[i].label(i))
+		if err := validateOutputTypes(columnPath+" Processors", resolved); err != nil {
+			return err
+		}
+		if err := validateNulls(columnPath, resolved); err != nil {
+			return err
+		}
+		if err := validateEnums(columnPath, resolved); err != nil {
+			return err
+		}
+		if resolved.OnError != nil && resolved.OnError.Action == OnErrorNull && !resolved.IsNullable {
+			return fmt.Errorf("%s OnError: OnError %s requires a nullable column", columnPath, OnErrorNull)
+		}
+		for j, procDef := range resolved.Processors {
+			if procDef.OnError != nil && procDef.OnError.Action == OnErrorNull && !resolved.IsNullable {
+				return fmt.Errorf("%s Processors[%d].OnError: OnError %s requires a nullable column", columnPath, j,
+					OnErrorNull)
+			}
+		}
+	}
+	return nil
+}
+
+// indexRules orders the rules by precedence and clears the resolved columns. Maps without rules are not indexed.
+func (dbMap *DBMapper) indexRules() {
+	if len(dbMap.Rules) == 0 {
+		dbMap.rules = nil
+		return
+	}
+	index := &ruleIndex{order: make([]int, len(dbMap.Rules))}
+	for i := range index.order {
+		index.order[i] = i
+	}
+	sort.SliceStable(index.order, func(a, b int) bool {
+		return dbMap.Rules[index.order[a]].Priority > dbMap.Rules[index.order[b]].Priority
+	})
+	dbMap.rules = index
+}
+
+// matchRule returns the index of the rule that applies to a column, or -1 if none does.
+func (dbMap DBMapper) matchRule(schemaName, tableName, columnName, dataType string) int {
+	if dbMap.rules == nil {
+		return -1
+	}
+	for _, i := range dbMap.rules.order {
+		if dbMap.Rules[i].matches(schemaName, tableName, columnName, dataType) {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveColumn returns the column after the rules are applied and where its settings come from.
+func (dbMap DBMapper) resolveColumn(schemaName, tableName, columnName string) (*ColumnMapper, RuleMatch) {
+	exact := dbMap.exactColumnMapper(schemaName, tableName, columnName)
+	if exact != nil && len(exact.Processors) > 0 {
+		return exact, RuleMatch{Column: *exact, Exact: true, RuleIndex: -1}
+	}
+
+	cmap := ColumnMapper{TableSchema: schemaName, TableName: tableName, ColumnName: columnName}
+	if exact != nil {
+		cmap = *exact
+	}
+	i := dbMap.matchRule(schemaName, tableName, columnName, cmap.DataType)
+	if i < 0 {
+		return exact, RuleMatch{Column: cmap, Exact: exact != nil, RuleIndex: -1}
+	}
+
+	resolved := dbMap.Rules[i].apply(cmap)
+	resolved.locale = dbMap.tableLocale(resolved.TableSchema, resolved.TableName)
+	resolved.legacyChaining = dbMap.LegacyChaining
+	return &resolved, RuleMatch{Column: resolved, Exact: exact != nil, Rule: &dbMap.Rules[i], RuleIndex: i}
+}
+
+// RuleMatches returns where the settings of every column of ColumnMaps come from. Rules are only applied to maps that
+// were validated, I.E. by LoadConfigSkeleton.
+func (dbMap DBMapper) RuleMatches() []RuleMatch {
+	matches := make([]RuleMatch, 0, len(dbMap.ColumnMaps))
+	for _, columnMap := range dbMap.ColumnMaps {
+		_, match := dbMap.resolveColumn(columnMap.TableSchema, columnMap.TableName, columnMap.ColumnName)
+		matches = append(matches, match)
+	}
+	return matches
+}
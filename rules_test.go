@@ -0,0 +1,119 @@
+package gonymizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func rulesMap() DBMapper {
+	return DBMapper{
+		DBName: "test",
+		Rules: []ColumnRule{
+			{Name: "emails", ColumnName: "*email*", Processors: []ProcessorDefinition{{Name: "FakeEmailAddress"}}},
+			{
+				Name:       "audit emails",
+				Priority:   10,
+				TableName:  "audit_.+",
+				ColumnName: "email",
+				Regex:      true,
+				Processors: []ProcessorDefinition{{Name: "Identity"}},
+			},
+			{Name: "notes", DataType: "text", ColumnName: "note?", Processors: []ProcessorDefinition{{Name: "FakeParagraph"}}},
+		},
+		ColumnMaps: []ColumnMapper{
+			{TableSchema: "public", TableName: "users", ColumnName: "email", DataType: "text"},
+			{
+				TableSchema: "public",
+				TableName:   "admins",
+				ColumnName:  "email",
+				DataType:    "text",
+				Processors:  []ProcessorDefinition{{Name: "FakeFirstName"}},
+			},
+			{TableSchema: "public", TableName: "users", ColumnName: "notes", DataType: "text"},
+			{TableSchema: "public", TableName: "users", ColumnName: "name", DataType: "text"},
+		},
+	}
+}
+
+func TestColumnRules(t *testing.T) {
+	dbMap := rulesMap()
+	require.Nil(t, dbMap.Validate())
+
+	// an entry without processors gets the processors of the rule
+	cmap := dbMap.ColumnMapper("public", "users", "email")
+	require.NotNil(t, cmap)
+	require.Equal(t, "FakeEmailAddress", cmap.Processors[0].Name)
+	require.Equal(t, "text", cmap.DataType)
+
+	// an entry with processors wins over the rules
+	require.Equal(t, "FakeFirstName", dbMap.ColumnMapper("public", "admins", "email").Processors[0].Name)
+
+	// columns without an entry match rules without a DataType
+	cmap = dbMap.ColumnMapper("other", "contacts", "work_email")
+	require.NotNil(t, cmap)
+	require.Equal(t, "FakeEmailAddress", cmap.Processors[0].Name)
+	require.Equal(t, "contacts", cmap.TableName)
+	require.Nil(t, dbMap.ColumnMapper("other", "contacts", "notes"))
+
+	// the highest priority wins
+	require.Equal(t, "Identity", dbMap.ColumnMapper("public", "audit_log", "email").Processors[0].Name)
+
+	// the DataType pattern comes from the entry
+	require.Equal(t, "FakeParagraph", dbMap.ColumnMapper("public", "users", "notes").Processors[0].Name)
+
+	// entries that match no rule are left as they are
+	cmap = dbMap.ColumnMapper("public", "users", "name")
+	require.NotNil(t, cmap)
+	require.Empty(t, cmap.Processors)
+
+	matches := dbMap.RuleMatches()
+	require.Len(t, matches, 4)
+	require.Equal(t, 0, matches[0].RuleIndex)
+	require.Equal(t, "emails", matches[0].Rule.Name)
+	require.True(t, matches[1].Exact)
+	require.Nil(t, matches[1].Rule)
+	require.Equal(t, 2, matches[2].RuleIndex)
+	require.Nil(t, matches[3].Rule)
+	require.Equal(t, -1, matches[3].RuleIndex)
+}
+
+func TestValidateColumnRules(t *testing.T) {
+	invalid := []func(dbMap *DBMapper){
+		func(dbMap *DBMapper) { dbMap.Rules[0].ColumnName = "" },
+		func(dbMap *DBMapper) { dbMap.Rules[0].ColumnName = "[email" },
+		func(dbMap *DBMapper) { dbMap.Rules[1].TableName = "audit_(" },
+		func(dbMap *DBMapper) { dbMap.Rules[0].Processors = nil },
+		func(dbMap *DBMapper) { dbMap.Rules[0].Processors[0].Name = "Unknown" },
+		func(dbMap *DBMapper) { dbMap.Rules[0].NullRate = 2 },
+		// the columns the rule applies to are checked too
+		func(dbMap *DBMapper) { dbMap.Rules[0].NullRate = 0.5 },
+		func(dbMap *DBMapper) { dbMap.Rules[0].Processors[0].Name = "SetNull" },
+		func(dbMap *DBMapper) { dbMap.ColumnMaps[0].DataType = "integer" },
+		// rules that write NULL only apply to columns of ColumnMaps, which tell whether they are nullable
+		func(dbMap *DBMapper) {
+			dbMap.Rules[2].DataType, dbMap.Rules[2].NullRate, dbMap.ColumnMaps[2].IsNullable = "*", 0.5, true
+		},
+		func(dbMap *DBMapper) { dbMap.Rules[0].OnError = &ErrorPolicy{Action: OnErrorNull} },
+		func(dbMap *DBMapper) {
+			dbMap.Rules[0].Processors[0].OnError = &ErrorPolicy{Action: OnErrorNull}
+		},
+	}
+	for i, change := range invalid {
+		dbMap := rulesMap()
+		change(&dbMap)
+		require.NotNil(t, dbMap.Validate(), "case %d", i)
+	}
+
+	dbMap := rulesMap()
+	dbMap.Rules[0].Processors[0].Name = "SetNull"
+	require.Equal(t, "Rules[0] (emails): Processors[0] (SetNull) writes NULL, which requires a DataType pattern so the "+
+		"rule only applies to columns of ColumnMaps", dbMap.Validate().Error())
+
+	// with a DataType pattern the rule is checked against the columns it applies to
+	dbMap = rulesMap()
+	dbMap.Rules[2].NullRate = 0.5
+	require.NotNil(t, dbMap.Validate())
+	dbMap.ColumnMaps[2].IsNullable = true
+	require.Nil(t, dbMap.Validate())
+}
@@ -0,0 +1,599 @@
+package gonymizer
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+// The Subset of a map makes dump copy part of the database whose foreign keys are still valid, I.E. a small staging
+// copy of production. It starts from the rows of the root tables that match their SubsetRoot and follows the foreign
+// keys between tables:
+//
+//  1. rows that reference a row of the subset through a foreign key are added to it, and so on for their children
+//  2. rows that are referenced by a row of the subset are added to it, and so on for their parents, until every
+//     foreign key of the subset references a row of the subset
+//
+// Parents that are added for the second step do not add their other children, or most of the database would follow.
+// Tables that are connected to a root table through foreign keys only get their rows of the subset, other tables are
+// dumped in full. Rows are selected in one snapshot of the database, which is also used by pg_dump.
+//
+// The keys of the selected rows are collected in temporary tables by a psql script, in the same session that writes
+// the rows of the subset, so they are never sent to gonymizer and the rows are found by joins with the keys.
+
+// SubsetRoot selects the rows of a root table the subset starts from. Rows must match every condition that is set.
+type SubsetRoot struct {
+	TableSchema string
+	TableName   string
+
+	// percent of the rows, between 0 and 100. Rows are picked by a hash of their values and the Seed of the map, so
+	// the same rows are picked as long as they do not change
+	Percent float64 `json:",omitempty"`
+
+	// values of KeyColumn, which is id if it is not set
+	IDs       []string `json:",omitempty"`
+	KeyColumn string   `json:",omitempty"`
+
+	// an SQL condition, I.E. created_at > now() - interval '30 days'
+	Where string `json:",omitempty"`
+}
+
+// validateSubset checks the root tables of the Subset.
+func (dbMap *DBMapper) validateSubset() error {
+	for i, root := range dbMap.Subset {
+		path := fmt.Sprintf("Subset[%d]", i)
+		if root.TableSchema == "" || root.TableName == "" {
+			return fmt.Errorf("%s: Expected a TableSchema and TableName", path)
+		}
+		path = fmt.Sprintf("%s %s.%s", path, root.TableSchema, root.TableName)
+		if root.Percent < 0 || root.Percent > 100 {
+			return fmt.Errorf("%s: Percent must be between 0 and 100", path)
+		}
+		if root.Percent == 0 && len(root.IDs) == 0 && root.Where == "" {
+			return fmt.Errorf("%s: Expected a Percent, IDs or Where", path)
+		}
+		if root.KeyColumn != "" && len(root.IDs) == 0 {
+			return fmt.Errorf("%s: KeyColumn requires IDs", path)
+		}
+	}
+	return nil
+}
+
+// subsetTable is a table of the subset and the foreign keys that connect it to the others.
+type subsetTable struct {
+	schemaName string
+	tableName  string
+	root       *SubsetRoot
+
+	// foreign keys of the table, and of its children
+	parents  []*subsetEdge
+	children []*subsetEdge
+
+	// whether rows of the table can descend from the root rows, and whether they can be in the subset at all
+	descends bool
+	included bool
+}
+
+// subsetEdge is a foreign key between two tables of the subset and the temporary tables of the keys of the parent
+// table it selects. The temporary tables have the referenced columns of the parent table.
+type subsetEdge struct {
+	fk     ForeignKey
+	child  *subsetTable
+	parent *subsetTable
+
+	// keys of parent rows whose children descend from the root rows
+	descended string
+
+	// keys of parent rows that are referenced by rows of the subset
+	needed string
+}
+
+// subsetPlan is the graph of the tables that are connected to the root tables of a Subset.
+type subsetPlan struct {
+	seed   int64
+	tables []*subsetTable
+	edges  []*subsetEdge
+}
+
+// newSubsetPlan returns the tables that are connected to the root tables of the map through foreign keys.
+func newSubsetPlan(dbMap *DBMapper, foreignKeys []ForeignKey) (*subsetPlan, error) {
+	nodes := make(map[string]*subsetTable)
+	node := func(schemaName, tableName string) *subsetTable {
+		key := schemaName + "." + tableName
+		if nodes[key] == nil {
+			nodes[key] = &subsetTable{schemaName: schemaName, tableName: tableName}
+		}
+		return nodes[key]
+	}
+
+	var roots []*subsetTable
+	for i := range dbMap.Subset {
+		root := &dbMap.Subset[i]
+		table := node(root.TableSchema, root.TableName)
+		if table.root != nil {
+			return nil, fmt.Errorf("Subset: %s.%s is a root table more than once", root.TableSchema, root.TableName)
+		}
+		table.root = root
+		roots = append(roots, table)
+	}
+
+	for _, fk := range foreignKeys {
+		if len(fk.Columns) == 0 || len(fk.Columns) != len(fk.ParentColumns) {
+			log.Warnf("Skipping foreign key %s of %s.%s: its columns do not match the ones of %s.%s", fk.Name,
+				fk.TableSchema, fk.TableName, fk.ParentSchema, fk.ParentTable)
+			continue
+		}
+		edge := &subsetEdge{
+			fk:     fk,
+			child:  node(fk.TableSchema, fk.TableName),
+			parent: node(fk.ParentSchema, fk.ParentTable),
+		}
+		edge.child.parents = append(edge.child.parents, edge)
+		edge.parent.children = append(edge.parent.children, edge)
+	}
+
+	// every table that is connected to a root table, in either direction
+	connected := make(map[*subsetTable]bool)
+	queue := roots
+	for len(queue) > 0 {
+		table := queue[0]
+		queue = queue[1:]
+		if connected[table] {
+			continue
+		}
+		connected[table] = true
+		for _, edge := range table.parents {
+			queue = append(queue, edge.parent)
+		}
+		for _, edge := range table.children {
+			queue = append(queue, edge.child)
+		}
+	}
+
+	plan := &subsetPlan{seed: dbMap.Seed}
+	for table := range connected {
+		plan.tables = append(plan.tables, table)
+	}
+	sort.Slice(plan.tables, func(i, j int) bool {
+		return plan.tables[i].String() < plan.tables[j].String()
+	})
+
+	// rows descend from the root rows through the children of their tables, and rows of the subset need their parents
+	for queue = append([]*subsetTable{}, roots...); len(queue) > 0; queue = queue[1:] {
+		if table := queue[0]; !table.descends {
+			table.descends = true
+			for _, edge := range table.children {
+				queue = append(queue, edge.child)
+			}
+		}
+	}
+	for _, table := range plan.tables {
+		if table.descends {
+			queue = append(queue, table)
+		}
+	}
+	for ; len(queue) > 0; queue = queue[1:] {
+		if table := queue[0]; !table.included {
+			table.included = true
+			for _, edge := range table.parents {
+				queue = append(queue, edge.parent)
+			}
+		}
+	}
+
+	for _, table := range plan.tables {
+		for _, edge := range table.parents {
+			plan.edges = append(plan.edges, edge)
+			edge.descended = fmt.Sprintf("pg_temp.subset_descended_%d", len(plan.edges))
+			edge.needed = fmt.Sprintf("pg_temp.subset_needed_%d", len(plan.edges))
+		}
+	}
+	return plan, nil
+}
+
+// String returns the quoted name of the table.
+func (table *subsetTable) String() string {
+	return pq.QuoteIdentifier(table.schemaName) + "." + pq.QuoteIdentifier(table.tableName)
+}
+
+// rootWhere returns the condition of the root rows of the table, or false if it is not a root table.
+func (table *subsetTable) rootWhere(seed int64) string {
+	root := table.root
+	if root == nil {
+		return "false"
+	}
+
+	var conditions []string
+	if root.Percent > 0 {
+		// hashtext is an int4, the sign bit is dropped so the modulo is not negative
+		conditions = append(conditions, fmt.Sprintf(
+			"(hashtext(%s || t::text) & 2147483647) %% 10000 < %d",
+			pq.QuoteLiteral(fmt.Sprint(seed)), int64(math.Round(root.Percent*100))))
+	}
+	if len(root.IDs) > 0 {
+		keyColumn := root.KeyColumn
+		if keyColumn == "" {
+			keyColumn = "id"
+		}
+		// the array is of the type of the column, so its indexes can be used
+		array, _ := pq.Array(root.IDs).Value()
+		conditions = append(conditions, fmt.Sprintf("t.%s = ANY (%s)", pq.QuoteIdentifier(keyColumn),
+			pq.QuoteLiteral(array.(string))))
+	}
+	if root.Where != "" {
+		conditions = append(conditions, "("+root.Where+")")
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// descendedWhere returns the condition of the rows of the table that are root rows or descend from them.
+func (table *subsetTable) descendedWhere(seed int64) string {
+	var conditions []string
+	if table.root != nil {
+		conditions = append(conditions, "("+table.rootWhere(seed)+")")
+	}
+	for _, edge := range table.parents {
+		if edge.parent.descends {
+			conditions = append(conditions, keyExists(edge.descended, edge.fk.ParentColumns, edge.fk.Columns))
+		}
+	}
+	if len(conditions) == 0 {
+		return "false"
+	}
+	return strings.Join(conditions, " OR ")
+}
+
+// includedWhere returns the condition of the rows of the table that are in the subset.
+func (table *subsetTable) includedWhere(seed int64) string {
+	conditions := []string{table.descendedWhere(seed)}
+	for _, edge := range table.children {
+		if edge.child.included {
+			conditions = append(conditions, keyExists(edge.needed, edge.fk.ParentColumns, edge.fk.ParentColumns))
+		}
+	}
+	if conditions[0] == "false" {
+		conditions = conditions[1:]
+	}
+	if len(conditions) == 0 {
+		return "false"
+	}
+	return strings.Join(conditions, " OR ")
+}
+
+// insertKeys returns a statement that adds the keys of the rows of the table that match a condition to a temporary
+// table, and that are not in it yet. Rows with a NULL in any of the columns do not reference anything and are left out.
+func (table *subsetTable) insertKeys(keyTable string, keyColumns, columns []string, where string) string {
+	notNull := make([]string, len(columns))
+	for i, column := range columns {
+		notNull[i] = "t." + pq.QuoteIdentifier(column) + " IS NOT NULL"
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) SELECT DISTINCT %s FROM %s AS t WHERE %s AND NOT %s AND (%s)", keyTable,
+		strings.Join(quoteColumns("", keyColumns), ", "), strings.Join(quoteColumns("t.", columns), ", "), table,
+		strings.Join(notNull, " AND "), keyExists(keyTable, keyColumns, columns), where)
+}
+
+// keyExists returns the condition of the rows whose columns are a key of a temporary table.
+func keyExists(keyTable string, keyColumns, columns []string) string {
+	conditions := make([]string, len(columns))
+	for i, column := range columns {
+		conditions[i] = fmt.Sprintf("k.%s = t.%s", pq.QuoteIdentifier(keyColumns[i]), pq.QuoteIdentifier(column))
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s AS k WHERE %s)", keyTable, strings.Join(conditions, " AND "))
+}
+
+// quoteColumns returns the quoted names of columns with a prefix, I.E. the alias of their table.
+func quoteColumns(prefix string, columns []string) []string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = prefix + pq.QuoteIdentifier(column)
+	}
+	return quoted
+}
+
+// selectionBlock returns a DO block that fills the temporary tables of the keys: first with the rows that descend from
+// the root rows, then with the parents of every row of the subset. Both steps are repeated until no keys are added,
+// which ends as there are only so many rows.
+func (plan *subsetPlan) selectionBlock() string {
+	var block bytes.Buffer
+	block.WriteString("DO $gonymizer_subset$\nDECLARE\n\tgonymizer_added bigint;\n\tgonymizer_pass_added bigint;\n" +
+		"BEGIN\n")
+	step := func(insert func(table *subsetTable) []string) {
+		block.WriteString("\tLOOP\n\t\tgonymizer_pass_added := 0;\n")
+		for _, table := range plan.tables {
+			for _, statement := range insert(table) {
+				fmt.Fprintf(&block, "\t\t%s;\n", statement)
+				block.WriteString("\t\tGET DIAGNOSTICS gonymizer_added = ROW_COUNT;\n" +
+					"\t\tgonymizer_pass_added := gonymizer_pass_added + gonymizer_added;\n")
+			}
+		}
+		block.WriteString("\t\tEXIT WHEN gonymizer_pass_added = 0;\n\tEND LOOP;\n")
+	}
+
+	step(func(table *subsetTable) []string {
+		where := table.descendedWhere(plan.seed)
+		if where == "false" {
+			return nil
+		}
+		var statements []string
+		for _, edge := range table.children {
+			statements = append(statements, table.insertKeys(edge.descended, edge.fk.ParentColumns,
+				edge.fk.ParentColumns, where))
+		}
+		return statements
+	})
+	step(func(table *subsetTable) []string {
+		where := table.includedWhere(plan.seed)
+		if where == "false" {
+			return nil
+		}
+		var statements []string
+		for _, edge := range table.parents {
+			statements = append(statements, table.insertKeys(edge.needed, edge.fk.ParentColumns, edge.fk.Columns,
+				where))
+		}
+		return statements
+	})
+	block.WriteString("END\n$gonymizer_subset$;\n")
+	return block.String()
+}
+
+// simpleIdentifierRegex matches the names pg_dump writes without quotes.
+var simpleIdentifierRegex = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// reservedKeywords are the names pg_dump quotes although they are simple.
+var reservedKeywords = map[string]bool{
+	"all": true, "analyse": true, "analyze": true, "and": true, "any": true, "array": true, "as": true, "asc": true,
+	"asymmetric": true, "both": true, "case": true, "cast": true, "check": true, "collate": true, "column": true,
+	"constraint": true, "create": true, "current_catalog": true, "current_date": true, "current_role": true,
+	"current_time": true, "current_timestamp": true, "current_user": true, "default": true, "deferrable": true,
+	"desc": true, "distinct": true, "do": true, "else": true, "end": true, "except": true, "false": true, "fetch": true,
+	"for": true, "foreign": true, "from": true, "grant": true, "group": true, "having": true, "in": true,
+	"initially": true, "intersect": true, "into": true, "lateral": true, "leading": true, "limit": true,
+	"localtime": true, "localtimestamp": true, "not": true, "null": true, "offset": true, "on": true, "only": true,
+	"or": true, "order": true, "placing": true, "primary": true, "references": true, "returning": true, "select": true,
+	"session_user": true, "some": true, "symmetric": true, "table": true, "then": true, "to": true, "trailing": true,
+	"true": true, "union": true, "unique": true, "user": true, "using": true, "variadic": true, "when": true,
+	"where": true, "window": true, "with": true,
+}
+
+// dumpIdentifier returns a name the way pg_dump writes it, so process reads the COPY statements of the subset like
+// the ones of pg_dump.
+func dumpIdentifier(name string) string {
+	if simpleIdentifierRegex.MatchString(name) && !reservedKeywords[name] {
+		return name
+	}
+	return pq.QuoteIdentifier(name)
+}
+
+// copyScript returns the psql script that selects the rows of the subset and writes them as the COPY statements of a
+// dump file. The temporary tables of the keys are dropped when it commits.
+func (plan *subsetPlan) copyScript(snapshot string, columns map[*subsetTable][]string) string {
+	var script bytes.Buffer
+	// not READ ONLY, which would not allow the temporary tables to be created
+	script.WriteString("BEGIN ISOLATION LEVEL REPEATABLE READ;\n")
+	if snapshot != "" {
+		fmt.Fprintf(&script, "SET TRANSACTION SNAPSHOT %s;\n", pq.QuoteLiteral(snapshot))
+	}
+	// the rows are written in the encoding of the database, like pg_dump does
+	script.WriteString("SELECT pg_catalog.set_config('client_encoding', " +
+		"pg_catalog.current_setting('server_encoding'), false) AS encoding \\gset\n")
+
+	for _, edge := range plan.edges {
+		var keyTables []string
+		if edge.parent.descends {
+			keyTables = append(keyTables, edge.descended)
+		}
+		if edge.child.included {
+			keyTables = append(keyTables, edge.needed)
+		}
+		for _, keyTable := range keyTables {
+			fmt.Fprintf(&script, "CREATE TEMPORARY TABLE %s ON COMMIT DROP AS SELECT %s FROM %s AS t WITH NO DATA;\n",
+				keyTable, strings.Join(quoteColumns("t.", edge.fk.ParentColumns), ", "), edge.parent)
+			fmt.Fprintf(&script, "CREATE INDEX ON %s (%s);\n", keyTable,
+				strings.Join(quoteColumns("", edge.fk.ParentColumns), ", "))
+		}
+	}
+	if len(plan.edges) > 0 {
+		script.WriteString(plan.selectionBlock())
+	}
+
+	for _, table := range plan.tables {
+		names := columns[table]
+		if len(names) == 0 {
+			continue
+		}
+		dumpNames := make([]string, len(names))
+		quoted := make([]string, len(names))
+		for i, name := range names {
+			dumpNames[i] = dumpIdentifier(name)
+			quoted[i] = "t." + pq.QuoteIdentifier(name)
+		}
+		header := fmt.Sprintf("COPY %s.%s (%s) FROM stdin;", dumpIdentifier(table.schemaName),
+			dumpIdentifier(table.tableName), strings.Join(dumpNames, ", "))
+
+		fmt.Fprintf(&script, "\\qecho %s\n", psqlArgument(header))
+		fmt.Fprintf(&script, "COPY (SELECT %s FROM %s AS t WHERE %s) TO STDOUT;\n", strings.Join(quoted, ", "),
+			table, table.includedWhere(plan.seed))
+		script.WriteString("\\qecho '\\\\.'\n\\qecho\n")
+	}
+	script.WriteString("COMMIT;\n")
+	return script.String()
+}
+
+// psqlArgument quotes an argument of a psql meta-command, in which backslashes are escapes.
+func psqlArgument(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+// dumpsTable returns true if the data of a table is in the dump, from the schema and exclude options of dump.
+func dumpsTable(table *subsetTable, schemaPrefix string, excludeTables, excludeDataTables, schemas []string) bool {
+	for _, excluded := range append(append([]string{}, excludeTables...), excludeDataTables...) {
+		if excluded == table.tableName || excluded == table.schemaName+"."+table.tableName {
+			return false
+		}
+	}
+	if len(schemas) == 0 {
+		return true
+	}
+	for _, schemaName := range schemas {
+		if schemaName == table.schemaName ||
+			(len(schemaPrefix) > 0 && strings.HasPrefix(schemaPrefix, schemaName) &&
+				strings.HasPrefix(table.schemaName, schemaPrefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateSubsetDumpFile creates a dump file with the Subset of the map, see SubsetRoot. pg_dump creates the schema and
+// the data of the tables that are not connected to the root tables, and the rows of the subset are added between the
+// two, so the constraints are created after they are loaded.
+func CreateSubsetDumpFile(
+	conf PGConfig,
+	dbMap *DBMapper,
+	dumpfilePath,
+	schemaPrefix string,
+	excludeTables,
+	excludeDataTables,
+	excludeCreateSchemas,
+	schemas []string,
+	oids bool,
+) error {
+	if len(dbMap.Subset) == 0 {
+		return fmt.Errorf("Expected a Subset in the map file")
+	}
+
+	db, err := OpenDB(conf)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	foreignKeys, err := GetForeignKeys(db)
+	if err != nil {
+		return err
+	}
+	plan, err := newSubsetPlan(dbMap, foreignKeys)
+	if err != nil {
+		return err
+	}
+
+	// the rows are selected and dumped in a snapshot that pg_dump and psql share, so they are consistent
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var snapshot string
+	if err = tx.QueryRowContext(ctx, "SELECT pg_catalog.pg_export_snapshot()").Scan(&snapshot); err != nil {
+		return err
+	}
+
+	columns := make(map[*subsetTable][]string)
+	var subsetTables []string
+	for _, table := range plan.tables {
+		subsetTables = append(subsetTables, table.String())
+		if !dumpsTable(table, schemaPrefix, excludeTables, excludeDataTables, schemas) {
+			continue
+		}
+		if columns[table], err = tableColumns(ctx, tx, table); err != nil {
+			return err
+		}
+		log.Infof("Dumping a subset of %s.%s", table.schemaName, table.tableName)
+	}
+
+	dumpFile, err := os.Create(dumpfilePath)
+	if err != nil {
+		return err
+	}
+	defer dumpFile.Close()
+
+	dumpSection := func(section string, excludeDataTables []string) error {
+		args := CreateDumpArgs(conf, dumpfilePath+".section", schemaPrefix, excludeTables, excludeDataTables,
+			excludeCreateSchemas, schemas, oids)
+		args = append([]string{"--section=" + section, "--snapshot=" + snapshot}, args...)
+		return runIntoFile(dumpFile, dumpfilePath+".section", "pg_dump", args...)
+	}
+
+	if err = dumpSection("pre-data", excludeDataTables); err != nil {
+		return err
+	}
+	if err = dumpSection("data", append(append([]string{}, excludeDataTables...), subsetTables...)); err != nil {
+		return err
+	}
+
+	scriptPath := dumpfilePath + ".subset.sql"
+	if err = ioutil.WriteFile(scriptPath, []byte(plan.copyScript(snapshot, columns)), 0600); err != nil {
+		return err
+	}
+	defer os.Remove(scriptPath)
+	err = runIntoFile(dumpFile, dumpfilePath+".section", "psql", conf.URI(), "-X", "-q", "-v", "ON_ERROR_STOP=1",
+		"-f", scriptPath, "-o", dumpfilePath+".section")
+	if err != nil {
+		return err
+	}
+
+	return dumpSection("post-data", excludeDataTables)
+}
+
+// tableColumns returns the columns of a table in the order of SELECT *, without generated columns which pg_dump does
+// not dump either.
+func tableColumns(ctx context.Context, tx *sql.Tx, table *subsetTable) ([]string, error) {
+	// is_generated is only there from PostgreSQL 12 on
+	rows, err := tx.QueryContext(ctx, `
+		SELECT c.column_name
+		FROM information_schema.columns AS c
+		WHERE c.table_schema = $1 AND c.table_name = $2
+			AND to_jsonb(c) ->> 'is_generated' IS DISTINCT FROM 'ALWAYS'
+		ORDER BY c.ordinal_position`, table.schemaName, table.tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// runIntoFile runs a command that writes to a temporary file and appends the file to dst.
+func runIntoFile(dst io.Writer, tempPath, name string, args ...string) error {
+	var (
+		errBuffer bytes.Buffer
+		outBuffer bytes.Buffer
+	)
+	defer os.Remove(tempPath)
+
+	if err := ExecPostgresCommandOutErr(&outBuffer, &errBuffer, name, args...); err != nil {
+		log.Error("STDOUT: ", outBuffer.String())
+		log.Error("STDERR: ", errBuffer.String())
+		return err
+	}
+
+	src, err := os.Open(tempPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = io.Copy(dst, src)
+	return err
+}
@@ -0,0 +1,147 @@
+package gonymizer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// subsetTestKeys are foreign keys of a shop: orders of accounts, their items and products, reviews of products, and a
+// table of settings that is not connected to any of them.
+var subsetTestKeys = []ForeignKey{
+	{Name: "orders_account_id_fkey", TableSchema: "public", TableName: "orders", Columns: []string{"account_id"},
+		ParentSchema: "public", ParentTable: "accounts", ParentColumns: []string{"id"}},
+	{Name: "items_order_fkey", TableSchema: "public", TableName: "items", Columns: []string{"order_id"},
+		ParentSchema: "public", ParentTable: "orders", ParentColumns: []string{"id"}},
+	{Name: "items_product_fkey", TableSchema: "public", TableName: "items",
+		Columns: []string{"product_id", "product_version"}, ParentSchema: "catalog", ParentTable: "products",
+		ParentColumns: []string{"id", "version"}},
+	{Name: "reviews_product_fkey", TableSchema: "public", TableName: "reviews",
+		Columns: []string{"product_id", "product_version"}, ParentSchema: "catalog", ParentTable: "products",
+		ParentColumns: []string{"id", "version"}},
+	{Name: "settings_parent_fkey", TableSchema: "public", TableName: "settings", Columns: []string{"parent_id"},
+		ParentSchema: "public", ParentTable: "settings", ParentColumns: []string{"id"}},
+}
+
+func subsetTestPlan(t *testing.T, roots ...SubsetRoot) *subsetPlan {
+	dbMap := &DBMapper{DBName: "test", Seed: 42, Subset: roots}
+	require.Nil(t, dbMap.Validate())
+	plan, err := newSubsetPlan(dbMap, subsetTestKeys)
+	require.Nil(t, err)
+	return plan
+}
+
+func subsetTestTable(plan *subsetPlan, name string) *subsetTable {
+	for _, table := range plan.tables {
+		if table.schemaName+"."+table.tableName == name {
+			return table
+		}
+	}
+	return nil
+}
+
+func TestSubsetPlan(t *testing.T) {
+	plan := subsetTestPlan(t, SubsetRoot{TableSchema: "public", TableName: "accounts", Percent: 1})
+
+	// tables connected to the root in either direction, but not settings
+	var names []string
+	for _, table := range plan.tables {
+		names = append(names, table.String())
+	}
+	require.Equal(t, []string{`"catalog"."products"`, `"public"."accounts"`, `"public"."items"`, `"public"."orders"`,
+		`"public"."reviews"`}, names)
+
+	// the foreign keys of the tables in order, each with temporary tables of the keys it selects
+	require.Len(t, plan.edges, 4)
+	require.Equal(t, "items_order_fkey", plan.edges[0].fk.Name)
+	require.Equal(t, "pg_temp.subset_descended_4", plan.edges[3].descended)
+	require.Equal(t, "pg_temp.subset_needed_4", plan.edges[3].needed)
+
+	accounts := subsetTestTable(plan, "public.accounts")
+	require.Equal(t, `(hashtext('42' || t::text) & 2147483647) % 10000 < 100`, accounts.rootWhere(plan.seed))
+	require.Equal(t, `EXISTS (SELECT 1 FROM pg_temp.subset_descended_3 AS k WHERE k."id" = t."account_id")`,
+		subsetTestTable(plan, "public.orders").descendedWhere(plan.seed))
+
+	// products do not descend from the accounts and reviews are not needed by anything, so they only have the
+	// products of the items
+	require.Equal(t, "false", subsetTestTable(plan, "catalog.products").descendedWhere(plan.seed))
+	require.Equal(t, `EXISTS (SELECT 1 FROM pg_temp.subset_needed_2 AS k WHERE k."id" = t."id" AND `+
+		`k."version" = t."version")`, subsetTestTable(plan, "catalog.products").includedWhere(plan.seed))
+	require.Equal(t, "false", subsetTestTable(plan, "public.reviews").includedWhere(plan.seed))
+
+	// roots must match every condition
+	plan = subsetTestPlan(t, SubsetRoot{TableSchema: "public", TableName: "accounts", IDs: []string{"3", "1"},
+		KeyColumn: "account_no", Where: "active"})
+	require.Equal(t, `t."account_no" = ANY ('{"3","1"}') AND (active)`,
+		subsetTestTable(plan, "public.accounts").rootWhere(plan.seed))
+
+	// a table is a root table once
+	dbMap := &DBMapper{DBName: "test", Subset: []SubsetRoot{
+		{TableSchema: "public", TableName: "accounts", Percent: 1},
+		{TableSchema: "public", TableName: "accounts", Percent: 2},
+	}}
+	_, err := newSubsetPlan(dbMap, subsetTestKeys)
+	require.NotNil(t, err)
+}
+
+func TestSubsetScript(t *testing.T) {
+	plan := subsetTestPlan(t, SubsetRoot{TableSchema: "public", TableName: "accounts", IDs: []string{"1"}})
+	script := plan.copyScript("00000003-1", map[*subsetTable][]string{
+		subsetTestTable(plan, "public.orders"): {"id", "account_id", "order"},
+	})
+
+	// the keys are collected in temporary tables, in the snapshot of the dump
+	require.True(t, strings.HasPrefix(script, "BEGIN ISOLATION LEVEL REPEATABLE READ;\n"+
+		"SET TRANSACTION SNAPSHOT '00000003-1';\n"))
+	require.Contains(t, script, "CREATE TEMPORARY TABLE pg_temp.subset_needed_2 ON COMMIT DROP AS "+
+		`SELECT t."id", t."version" FROM "catalog"."products" AS t WITH NO DATA;`+"\n"+
+		`CREATE INDEX ON pg_temp.subset_needed_2 ("id", "version");`+"\n")
+	require.NotContains(t, script, "subset_descended_2")
+	require.NotContains(t, script, "subset_needed_4")
+
+	// the orders of the account, then their items, descend from it
+	require.Contains(t, script, `INSERT INTO pg_temp.subset_descended_3 ("id") SELECT DISTINCT t."id" `+
+		`FROM "public"."accounts" AS t WHERE t."id" IS NOT NULL AND NOT EXISTS (SELECT 1 FROM `+
+		`pg_temp.subset_descended_3 AS k WHERE k."id" = t."id") AND ((t."id" = ANY ('{"1"}')));`)
+	require.Contains(t, script, `INSERT INTO pg_temp.subset_descended_1 ("id") SELECT DISTINCT t."id" `+
+		`FROM "public"."orders" AS t WHERE t."id" IS NOT NULL AND NOT EXISTS (SELECT 1 FROM `+
+		`pg_temp.subset_descended_1 AS k WHERE k."id" = t."id") AND (EXISTS (SELECT 1 FROM `+
+		`pg_temp.subset_descended_3 AS k WHERE k."id" = t."account_id"));`)
+
+	// the products of the items are needed
+	require.Contains(t, script, `INSERT INTO pg_temp.subset_needed_2 ("id", "version") `+
+		`SELECT DISTINCT t."product_id", t."product_version" FROM "public"."items" AS t `+
+		`WHERE t."product_id" IS NOT NULL AND t."product_version" IS NOT NULL AND NOT EXISTS (SELECT 1 FROM `+
+		`pg_temp.subset_needed_2 AS k WHERE k."id" = t."product_id" AND k."version" = t."product_version") AND `+
+		`(EXISTS (SELECT 1 FROM pg_temp.subset_descended_1 AS k WHERE k."id" = t."order_id"));`)
+	require.Equal(t, 2, strings.Count(script, "EXIT WHEN gonymizer_pass_added = 0;"))
+
+	// the rows are written after the keys are collected, and before the temporary tables are dropped
+	copyOrders := `COPY (SELECT t."id", t."account_id", t."order" FROM "public"."orders" AS t WHERE ` +
+		`EXISTS (SELECT 1 FROM pg_temp.subset_descended_3 AS k WHERE k."id" = t."account_id") OR ` +
+		`EXISTS (SELECT 1 FROM pg_temp.subset_needed_1 AS k WHERE k."id" = t."id")) TO STDOUT;` + "\n\\qecho '\\\\.'\n"
+	require.Contains(t, script, "\\qecho 'COPY public.orders (id, account_id, \"order\") FROM stdin;'\n"+copyOrders)
+	require.True(t, strings.Index(script, "$gonymizer_subset$;") < strings.Index(script, copyOrders))
+	require.True(t, strings.HasSuffix(script, "COMMIT;\n"))
+	require.NotContains(t, script, "reviews\" AS t WHERE")
+}
+
+func TestValidateSubset(t *testing.T) {
+	for _, root := range []SubsetRoot{
+		{TableName: "accounts", Percent: 1},
+		{TableSchema: "public", TableName: "accounts"},
+		{TableSchema: "public", TableName: "accounts", Percent: 101},
+		{TableSchema: "public", TableName: "accounts", Where: "active", KeyColumn: "account_no"},
+	} {
+		dbMap := &DBMapper{DBName: "test", Subset: []SubsetRoot{root}}
+		require.NotNil(t, dbMap.Validate(), "%+v", root)
+	}
+}
+
+func TestDumpIdentifier(t *testing.T) {
+	require.Equal(t, "users", dumpIdentifier("users"))
+	require.Equal(t, `"order"`, dumpIdentifier("order"))
+	require.Equal(t, `"Users"`, dumpIdentifier("Users"))
+	require.Equal(t, `'it''s \\ here'`, psqlArgument(`it's \ here`))
+}
@@ -0,0 +1,272 @@
+package gonymizer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Tables of the map can decide which rows of a table are kept while a dump file is processed, so they also apply to
+// dumps that were not created by gonymizer. Rows are filtered on their original values, before they are anonymized:
+//
+//  1. Rows none drops every row and keeps an empty COPY statement, Rows schema drops the COPY statement as well
+//  2. Where keeps only the rows for which the expression is true, see the Expression processor. Its columns are read
+//     with row.column_name
+//  3. Limit keeps at most that many of the remaining rows: the first ones, or a random sample if Sample is random
+
+// Values of TableMapper.Rows
+const (
+	TableRowsAll    = "all"
+	TableRowsNone   = "none"
+	TableRowsSchema = "schema"
+)
+
+// Values of TableMapper.Sample
+const (
+	TableSampleFirst  = "first"
+	TableSampleRandom = "random"
+)
+
+// validateTables checks the row settings of every table and compiles their Where expressions.
+func (dbMap *DBMapper) validateTables() error {
+	for i := range dbMap.Tables {
+		table := &dbMap.Tables[i]
+		path := fmt.Sprintf("%s.%s", table.TableSchema, table.TableName)
+		switch table.Rows {
+		case "", TableRowsAll, TableRowsNone, TableRowsSchema:
+		default:
+			return fmt.Errorf("%s: Unknown Rows %q, expected one of: %s, %s, %s", path, table.Rows, TableRowsAll,
+				TableRowsNone, TableRowsSchema)
+		}
+		switch table.Sample {
+		case "", TableSampleFirst, TableSampleRandom:
+		default:
+			return fmt.Errorf("%s: Unknown Sample %q, expected one of: %s, %s", path, table.Sample, TableSampleFirst,
+				TableSampleRandom)
+		}
+		if table.Limit < 0 {
+			return fmt.Errorf("%s: Limit must not be negative", path)
+		}
+		if table.Sample != "" && table.Limit == 0 {
+			return fmt.Errorf("%s: Sample requires a Limit", path)
+		}
+
+		table.where = nil
+		if table.Where != "" {
+			node, err := compileExpression(table.Where)
+			if err != nil {
+				return fmt.Errorf("%s Where: %s", path, err)
+			}
+			table.where = node
+		}
+	}
+	return nil
+}
+
+// filtersRows returns true if the table does not keep all of its rows.
+func (table TableMapper) filtersRows() bool {
+	return (table.Rows != "" && table.Rows != TableRowsAll) || table.Where != "" || table.Limit > 0
+}
+
+// tableMapper returns the entry of Tables for a table, or nil if it has none. Tables of schemas that start with the
+// SchemaPrefix match the entry of the table in any of them, like columns do.
+func (dbMap DBMapper) tableMapper(schemaName, tableName string) *TableMapper {
+	schemaName = strings.Replace(schemaName, "\"", "", -1)
+	tableName = strings.Replace(tableName, "\"", "", -1)
+	for i, table := range dbMap.Tables {
+		if table.TableName != tableName {
+			continue
+		}
+		if table.TableSchema == schemaName ||
+			(len(dbMap.SchemaPrefix) > 0 && strings.HasPrefix(schemaName, dbMap.SchemaPrefix)) {
+			return &dbMap.Tables[i]
+		}
+	}
+	return nil
+}
+
+// sampledRow is a row of a random sample and its position in the table.
+type sampledRow struct {
+	index int64
+	line  string
+}
+
+// tableFilter drops the rows of a dump file that the Tables of a map do not keep. Lines are given to it in the order
+// of the file and it returns the lines to write in their place.
+type tableFilter struct {
+	dbMap *DBMapper
+
+	// the table of the current COPY statement if it filters rows, and its columns
+	table       *TableMapper
+	schemaName  string
+	tableName   string
+	columnNames []string
+
+	seen    int64
+	matched int64
+	kept    int64
+	sample  []sampledRow
+}
+
+// newTableFilter returns a filter for the Tables of a map, or nil if none of them filters rows.
+func newTableFilter(dbMap *DBMapper) *tableFilter {
+	if dbMap == nil {
+		return nil
+	}
+	for _, table := range dbMap.Tables {
+		if table.filtersRows() {
+			return &tableFilter{dbMap: dbMap}
+		}
+	}
+	return nil
+}
+
+// filterLine returns the lines to write for a line of the dump file: none for rows that are dropped or held back for a
+// random sample, and the rows of the sample before the end of their COPY statement.
+func (f *tableFilter) filterLine(inputLine string) ([]string, error) {
+	trimmedInput := strings.TrimLeftFunc(inputLine, unicode.IsSpace)
+
+	if f.table == nil {
+		if strings.HasPrefix(trimmedInput, StateChangeTokenBeginCopy) {
+			var state LineState
+			state.parseCopyLine(inputLine)
+			table := f.dbMap.tableMapper(state.SchemaName, state.TableName)
+			if table != nil && table.filtersRows() {
+				*f = tableFilter{
+					dbMap:       f.dbMap,
+					table:       table,
+					schemaName:  state.SchemaName,
+					tableName:   state.TableName,
+					columnNames: state.ColumnNames,
+				}
+				if table.Rows == TableRowsSchema {
+					return nil, nil
+				}
+			}
+		}
+		return []string{inputLine}, nil
+	}
+
+	if strings.HasPrefix(trimmedInput, StateChangeTokenEndCopy) {
+		table := f.table
+		f.table = nil
+
+		sort.Slice(f.sample, func(i, j int) bool {
+			return f.sample[i].index < f.sample[j].index
+		})
+		lines := make([]string, 0, len(f.sample)+1)
+		for _, row := range f.sample {
+			lines = append(lines, row.line)
+		}
+		log.Infof("Kept %d of %d rows of %s.%s", f.kept+int64(len(f.sample)), f.seen, f.schemaName, f.tableName)
+
+		if table.Rows == TableRowsSchema {
+			return nil, nil
+		}
+		return append(lines, inputLine), nil
+	}
+
+	// blank lines are not rows, see processLine
+	if len(trimmedInput) == 0 {
+		return []string{inputLine}, nil
+	}
+
+	f.seen++
+	keep, err := f.keepRow(inputLine)
+	if err != nil || !keep {
+		return nil, err
+	}
+	f.kept++
+	return []string{inputLine}, nil
+}
+
+// tableFilterReader reads a dump file through a tableFilter.
+type tableFilterReader struct {
+	filter  *tableFilter
+	source  *bufio.Reader
+	pending []byte
+	err     error
+}
+
+// filterTables returns a reader of a dump file without the rows the Tables of the map do not keep, or the file itself
+// if no table filters rows.
+func filterTables(dbMap *DBMapper, file io.Reader) io.Reader {
+	filter := newTableFilter(dbMap)
+	if filter == nil {
+		return file
+	}
+	return &tableFilterReader{filter: filter, source: bufio.NewReader(file)}
+}
+
+// Read reads the lines of the dump file that are kept.
+func (r *tableFilterReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		var inputLine string
+		inputLine, r.err = r.source.ReadString('\n')
+		if inputLine == "" {
+			continue
+		}
+		lines, err := r.filter.filterLine(inputLine)
+		if err != nil {
+			r.err = err
+			continue
+		}
+		r.pending = []byte(strings.Join(lines, ""))
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// keepRow returns true if a row of the current table is kept. Rows of a random sample are held back until the end of
+// the COPY statement, when it is known which ones are kept.
+func (f *tableFilter) keepRow(inputLine string) (bool, error) {
+	table := f.table
+	if table.Rows == TableRowsNone || table.Rows == TableRowsSchema {
+		return false, nil
+	}
+
+	if table.where != nil {
+		env := exprEnv{
+			cmap: &ColumnMapper{
+				TableSchema: f.schemaName,
+				TableName:   f.tableName,
+				locale:      f.dbMap.tableLocale(table.TableSchema, table.TableName),
+			},
+			row: rowValues(f.columnNames, strings.Split(inputLine, "\t")),
+		}
+		value, err := table.where.eval(&env)
+		if err != nil {
+			return false, fmt.Errorf("%s.%s Where: %s", f.schemaName, f.tableName, err)
+		}
+		if !exprTruthy(value) {
+			return false, nil
+		}
+	}
+
+	f.matched++
+	if table.Limit == 0 {
+		return true, nil
+	}
+	if table.Sample != TableSampleRandom {
+		return f.kept < table.Limit, nil
+	}
+
+	// reservoir sampling keeps each matching row with the same probability without knowing how many there are
+	row := sampledRow{index: f.seen, line: inputLine}
+	if int64(len(f.sample)) < table.Limit {
+		f.sample = append(f.sample, row)
+	} else if i := rand.Int63n(f.matched); i < table.Limit {
+		f.sample[i] = row
+	}
+	return false, nil
+}
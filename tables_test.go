@@ -0,0 +1,103 @@
+package gonymizer
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const tablesTestDump = `SET statement_timeout = 0;
+COPY public.users (id, country, email) FROM stdin;
+1	US	a@example.com
+2	DE	b@example.com
+3	US	c@example.com
+4	US	\N
+\.
+
+COPY public.audit (id, message) FROM stdin;
+1	login
+2	logout
+\.
+
+COPY public.sessions (id, token) FROM stdin;
+1	abc
+\.
+
+COPY public.events (id) FROM stdin;
+1
+2
+3
+4
+5
+\.
+`
+
+func filterTestDump(t *testing.T, tables []TableMapper) string {
+	dbMap := &DBMapper{DBName: "test", Tables: tables}
+	require.Nil(t, dbMap.Validate())
+	output, err := ioutil.ReadAll(filterTables(dbMap, strings.NewReader(tablesTestDump)))
+	require.Nil(t, err)
+	return string(output)
+}
+
+func TestFilterTables(t *testing.T) {
+	// maps without row settings do not filter
+	require.Equal(t, tablesTestDump, filterTestDump(t, []TableMapper{{TableSchema: "public", TableName: "users",
+		Locale: "de_DE"}}))
+
+	output := filterTestDump(t, []TableMapper{
+		{TableSchema: "public", TableName: "users", Where: `row.country == "US" && !empty(row.email)`},
+		{TableSchema: "public", TableName: "audit", Rows: TableRowsNone},
+		{TableSchema: "public", TableName: "sessions", Rows: TableRowsSchema},
+		{TableSchema: "public", TableName: "events", Limit: 2},
+	})
+	require.Equal(t, `SET statement_timeout = 0;
+COPY public.users (id, country, email) FROM stdin;
+1	US	a@example.com
+3	US	c@example.com
+\.
+
+COPY public.audit (id, message) FROM stdin;
+\.
+
+
+COPY public.events (id) FROM stdin;
+1
+2
+\.
+`, output)
+
+	rand.Seed(1)
+	output = filterTestDump(t, []TableMapper{
+		{TableSchema: "public", TableName: "events", Limit: 3, Sample: TableSampleRandom},
+		{TableSchema: "public", TableName: "users", Where: `row.id > 1`, Limit: 1},
+	})
+	require.Contains(t, output, "COPY public.users (id, country, email) FROM stdin;\n2\tDE\tb@example.com\n\\.\n")
+	events := output[strings.Index(output, "COPY public.events"):]
+	rows := strings.Split(strings.TrimSuffix(events, "\\.\n"), "\n")[1:4]
+	require.Len(t, rows, 3)
+	require.True(t, rows[0] < rows[1] && rows[1] < rows[2], "sampled rows keep their order: %v", rows)
+}
+
+func TestValidateTables(t *testing.T) {
+	for _, test := range []struct {
+		table TableMapper
+		err   string
+	}{
+		{TableMapper{Rows: "some"}, `public.users: Unknown Rows "some", expected one of: all, none, schema`},
+		{TableMapper{Sample: "last", Limit: 1}, `public.users: Unknown Sample "last", expected one of: first, random`},
+		{TableMapper{Limit: -1}, "public.users: Limit must not be negative"},
+		{TableMapper{Sample: TableSampleRandom}, "public.users: Sample requires a Limit"},
+		{TableMapper{Where: "row.id >"}, "public.users Where: "},
+	} {
+		test.table.TableSchema = "public"
+		test.table.TableName = "users"
+		dbMap := DBMapper{DBName: "test", Tables: []TableMapper{test.table}}
+		err := dbMap.Validate()
+		require.NotNil(t, err)
+		require.True(t, strings.HasPrefix(err.Error(), test.err), err.Error())
+	}
+}